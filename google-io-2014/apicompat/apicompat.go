@@ -0,0 +1,149 @@
+// Package apicompat finds backward-incompatible changes to the exported API of
+// Go packages, given the defs of two versions of the packages.
+package apicompat
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/graphdiff"
+)
+
+// A Change is a breaking change to a def.
+type Change struct {
+	Old *graph.Def `json:",omitempty"` // nil for methods added to interfaces
+	New *graph.Def `json:",omitempty"` // nil for removed defs
+}
+
+// Def returns the def as it was before the change, or the added def.
+func (c *Change) Def() *graph.Def {
+	if c.Old != nil {
+		return c.Old
+	}
+	return c.New
+}
+
+func (c *Change) String() string {
+	d := c.Def()
+	what := fmt.Sprintf("%s: %s %s", d.Unit, d.Kind, d.Path)
+	switch {
+	case c.Old == nil:
+		return what + " added to interface"
+	case c.New == nil:
+		return what + " removed"
+	case c.Old.Kind != c.New.Kind:
+		return fmt.Sprintf("%s is now a %s", what, c.New.Kind)
+	default:
+		return fmt.Sprintf("%s changed from %s to %s", what, c.Old.Type, c.New.Type)
+	}
+}
+
+// Check returns the breaking changes to the exported API between the old and
+// new Go defs: removed identifiers, methods and fields, changes to their kind
+// or type, and methods added to interfaces (which break implementations of
+// the interface in other packages). Defs in _test.go files are ignored.
+//
+// Types are compared as strings, so the Types of defs should be set with
+// SetAPITypes first; otherwise, changes to the underlying types of named types
+// are missed.
+func Check(old, new []*graph.Def) []*Change {
+	old, new = exportedAPI(old), exportedAPI(new)
+	diff := graphdiff.Compute(&graphdiff.Graph{Defs: old}, &graphdiff.Graph{Defs: new})
+
+	var changes []*Change
+	removed := make(map[string]bool) // unit + "/" + path
+	for _, d := range diff.RemovedDefs {
+		removed[d.Old.Unit+"/"+d.Old.Path] = true
+	}
+	for _, d := range diff.RemovedDefs {
+		// A removed type's fields and methods go without saying.
+		if owner := ownerPath(d.Old.Path); owner != "" && removed[d.Old.Unit+"/"+owner] {
+			continue
+		}
+		changes = append(changes, &Change{Old: d.Old})
+	}
+	for _, d := range diff.ChangedDefs {
+		changes = append(changes, &Change{Old: d.Old, New: d.New})
+	}
+
+	newTypes := make(map[string]*graph.Def)
+	for _, def := range new {
+		if def.Kind == "type" {
+			newTypes[def.Unit+"/"+def.Path] = def
+		}
+	}
+	for _, d := range diff.AddedDefs {
+		owner := ownerPath(d.New.Path)
+		if d.New.Kind != "method" || owner == "" {
+			continue
+		}
+		key := d.New.Unit + "/" + owner
+		if t := newTypes[key]; t != nil && !removed[key] && declaredIn(d.New, t) && existed(old, d.New.Unit, owner) {
+			changes = append(changes, &Change{New: d.New})
+		}
+	}
+
+	sort.Sort(byDef(changes))
+	return changes
+}
+
+// exportedAPI returns the defs that other packages can use: exported
+// package-level defs and the exported members of exported types.
+func exportedAPI(defs []*graph.Def) []*graph.Def {
+	var api []*graph.Def
+	for _, def := range defs {
+		if def.UnitType != "go" || strings.HasSuffix(def.File, "_test.go") {
+			continue
+		}
+		exported := true
+		for _, name := range strings.Split(def.Path, "/") {
+			if !token.IsExported(name) {
+				exported = false
+				break
+			}
+		}
+		if exported {
+			api = append(api, def)
+		}
+	}
+	return api
+}
+
+// ownerPath returns the path of the type that the member at path belongs to,
+// or "" if path isn't a member.
+func ownerPath(path string) string {
+	if i := strings.LastIndex(path, "/"); i != -1 {
+		return path[:i]
+	}
+	return ""
+}
+
+// declaredIn reports whether member is declared inside the type literal of
+// t. Interface methods are; methods on concrete types are declared separately.
+func declaredIn(member, t *graph.Def) bool {
+	return member.File == t.File && t.DefStart <= member.DefStart && member.DefEnd <= t.DefEnd
+}
+
+func existed(defs []*graph.Def, unit, path string) bool {
+	for _, def := range defs {
+		if def.Unit == unit && def.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+type byDef []*Change
+
+func (v byDef) Len() int      { return len(v) }
+func (v byDef) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v byDef) Less(i, j int) bool {
+	a, b := v[i].Def(), v[j].Def()
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
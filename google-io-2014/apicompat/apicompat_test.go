@@ -0,0 +1,124 @@
+package apicompat
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+func goDef(path, kind, typ, file string, start, end int) *graph.Def {
+	return &graph.Def{
+		DefKey:   graph.DefKey{UnitType: "go", Unit: "pkg", Path: path},
+		Kind:     kind,
+		Type:     typ,
+		File:     file,
+		DefStart: start,
+		DefEnd:   end,
+	}
+}
+
+func TestCheck(t *testing.T) {
+	old := []*graph.Def{
+		goDef("Removed", "func", "func()", "a.go", 0, 10),
+		goDef("Gone", "type", "struct", "a.go", 20, 60),
+		goDef("Gone/F", "field", "int", "a.go", 30, 40),
+		goDef("Gone/M", "method", "func()", "a.go", 70, 80),
+		goDef("F", "func", "func(int) error", "a.go", 100, 120),
+		goDef("Moved", "func", "func(int)", "a.go", 130, 140),
+		goDef("K", "type", "int", "a.go", 150, 160),
+		goDef("V", "var", "int", "a.go", 170, 180),
+		goDef("I", "type", "interface", "b.go", 0, 50),
+		goDef("I/Do", "method", "func()", "b.go", 20, 30),
+		goDef("S", "type", "struct", "b.go", 100, 150),
+		goDef("unexported", "func", "func()", "b.go", 200, 210),
+		goDef("S/unexported", "method", "func()", "b.go", 220, 230),
+		goDef("Helper", "func", "func()", "a_test.go", 0, 10),
+	}
+	new := []*graph.Def{
+		goDef("F", "func", "func(int64) error", "a.go", 0, 20),
+		goDef("Moved", "func", "func(int)", "a.go", 30, 40),
+		goDef("K", "type", "string", "a.go", 50, 60),
+		goDef("V", "const", "int", "a.go", 70, 80),
+		goDef("I", "type", "interface", "b.go", 0, 70),
+		goDef("I/Do", "method", "func()", "b.go", 20, 30),
+		goDef("I/Undo", "method", "func()", "b.go", 40, 50),
+		goDef("S", "type", "struct", "b.go", 100, 150),
+		goDef("S/New", "method", "func()", "b.go", 160, 170),
+		goDef("T", "type", "interface", "b.go", 200, 250),
+		goDef("T/Do", "method", "func()", "b.go", 220, 230),
+	}
+
+	var got []string
+	for _, c := range Check(old, new) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"pkg: func F changed from func(int) error to func(int64) error",
+		"pkg: type Gone removed",
+		"pkg: method I/Undo added to interface",
+		"pkg: type K changed from int to string",
+		"pkg: func Removed removed",
+		"pkg: var V is now a const",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got changes\n%q\nwant\n%q", got, want)
+	}
+
+	if changes := Check(old, old); changes != nil {
+		t.Errorf("unchanged API: got changes %v", changes)
+	}
+}
+
+func TestSetAPITypes(t *testing.T) {
+	dir := t.TempDir()
+	src := `package pkg
+
+import "io"
+
+type K int
+
+type S struct{ X []string }
+
+func (s *S) M(w io.Writer, args ...interface{}) (n int, err error) { return 0, nil }
+
+type I interface{ Do(k K) <-chan K }
+
+func F(f func(a, b int) bool) map[string]*S { return nil }
+
+var V, W = 1, "w"
+`
+	if err := os.WriteFile(filepath.Join(dir, "pkg.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pkg_test.go"), []byte("package pkg\n\nfunc Helper() {}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"K":      "int",
+		"S":      "struct",
+		"S/X":    "[]string",
+		"S/M":    "func(io.Writer, ...interface{}) (int, error)",
+		"I":      "interface",
+		"I/Do":   "func(K) <-chan K",
+		"F":      "func(func(int, int) bool) map[string]*S",
+		"V":      "int",
+		"W":      "string",
+		"Helper": "unchanged",
+	}
+	var defs []*graph.Def
+	for path := range want {
+		defs = append(defs, goDef(path, "", "unchanged", "pkg.go", 0, 0))
+	}
+	if err := SetAPITypes(dir, defs); err != nil {
+		t.Fatal(err)
+	}
+	for _, def := range defs {
+		if def.Type != want[def.Path] {
+			t.Errorf("%s: got type %q, want %q", def.Path, def.Type, want[def.Path])
+		}
+	}
+}
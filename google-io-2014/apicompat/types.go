@@ -0,0 +1,151 @@
+package apicompat
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// SetAPITypes type-checks the Go package in dir (without its tests) and sets
+// the Type of each of defs, the package's defs, to the def's API type: the
+// part of its type that other packages depend on. That is the types of a
+// func's or method's parameters and results, without their names (which
+// callers don't depend on), and the underlying type of a named type (so
+// that "type K int" becoming "type K string" is a change), except for struct
+// and interface types, whose fields and methods are compared as defs of
+// their own. Defs that aren't in the package's scope keep their Type.
+func SetAPITypes(dir string, defs []*graph.Def) error {
+	fset := token.NewFileSet()
+	notTest := func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }
+	pkgs, err := parser.ParseDir(fset, dir, notTest, 0)
+	if err != nil && len(pkgs) == 0 {
+		return err
+	}
+
+	apiTypes := make(map[string]string)
+	for _, astPkg := range pkgs {
+		var files []*ast.File
+		for _, f := range astPkg.Files {
+			files = append(files, f)
+		}
+		conf := types.Config{
+			Importer: importer.ForCompiler(fset, "source", nil),
+			Error:    func(error) {}, // as in the Go analyzer, keep going after type errors
+		}
+		pkg, _ := conf.Check(dir, fset, files, nil)
+		addAPITypes(apiTypes, pkg)
+	}
+
+	for _, def := range defs {
+		if t, ok := apiTypes[def.Path]; ok {
+			def.Type = t
+		}
+	}
+	return nil
+}
+
+// addAPITypes adds the API types of pkg's package-level objects and of the
+// methods and fields of its named types to apiTypes, by def path.
+func addAPITypes(apiTypes map[string]string, pkg *types.Package) {
+	q := types.RelativeTo(pkg)
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		apiTypes[name] = apiType(obj, q)
+
+		tn, ok := obj.(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		if named, ok := tn.Type().(*types.Named); ok {
+			for i := 0; i < named.NumMethods(); i++ {
+				m := named.Method(i)
+				apiTypes[name+"/"+m.Name()] = apiType(m, q)
+			}
+		}
+		switch u := tn.Type().Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < u.NumFields(); i++ {
+				f := u.Field(i)
+				apiTypes[name+"/"+f.Name()] = apiType(f, q)
+			}
+		case *types.Interface:
+			for i := 0; i < u.NumExplicitMethods(); i++ {
+				m := u.ExplicitMethod(i)
+				apiTypes[name+"/"+m.Name()] = apiType(m, q)
+			}
+		}
+	}
+}
+
+// apiType returns the API type of obj (see SetAPITypes).
+func apiType(obj types.Object, q types.Qualifier) string {
+	tn, ok := obj.(*types.TypeName)
+	if !ok || tn.IsAlias() {
+		return typeString(obj.Type(), q)
+	}
+	switch u := obj.Type().Underlying().(type) {
+	case *types.Struct:
+		return "struct"
+	case *types.Interface:
+		return "interface"
+	default:
+		return typeString(u, q)
+	}
+}
+
+// typeString is like types.TypeString, but it omits the names of the
+// parameters and results of func types.
+func typeString(t types.Type, q types.Qualifier) string {
+	switch t := t.(type) {
+	case *types.Signature:
+		var b strings.Builder
+		b.WriteString("func")
+		writeTuple(&b, t.Params(), t.Variadic(), q)
+		switch res := t.Results(); {
+		case res.Len() == 1:
+			b.WriteString(" " + typeString(res.At(0).Type(), q))
+		case res.Len() > 1:
+			b.WriteString(" ")
+			writeTuple(&b, res, false, q)
+		}
+		return b.String()
+	case *types.Pointer:
+		return "*" + typeString(t.Elem(), q)
+	case *types.Slice:
+		return "[]" + typeString(t.Elem(), q)
+	case *types.Map:
+		return "map[" + typeString(t.Key(), q) + "]" + typeString(t.Elem(), q)
+	case *types.Chan:
+		switch t.Dir() {
+		case types.SendOnly:
+			return "chan<- " + typeString(t.Elem(), q)
+		case types.RecvOnly:
+			return "<-chan " + typeString(t.Elem(), q)
+		}
+		return "chan " + typeString(t.Elem(), q)
+	}
+	return types.TypeString(t, q)
+}
+
+func writeTuple(b *strings.Builder, t *types.Tuple, variadic bool, q types.Qualifier) {
+	b.WriteByte('(')
+	for i := 0; i < t.Len(); i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		typ := t.At(i).Type()
+		if s, ok := typ.(*types.Slice); ok && variadic && i == t.Len()-1 {
+			b.WriteString("..." + typeString(s.Elem(), q))
+			continue
+		}
+		b.WriteString(typeString(typ, q))
+	}
+	b.WriteByte(')')
+}
@@ -0,0 +1,203 @@
+// Package callgraph computes call graphs from stored defs and refs. A call
+// ref (of kind graph.RefCall) from inside one def (its Enclosing def) to a
+// callable def is a call from the former to the latter; other refs, such as
+// reading a func to pass it as a value, aren't calls. Defs are identified by
+// their keys without a CommitID (see graph.DefKey.WithoutCommit), since a
+// call graph is of a single commit.
+package callgraph
+
+import (
+	"sort"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// A Call is an edge in the call graph, with the refs that make the call (the
+// call sites).
+type Call struct {
+	Caller graph.DefKey
+	Callee graph.DefKey
+	Sites  []*graph.Ref
+}
+
+type Graph struct {
+	defs    map[graph.DefKey]*graph.Def
+	callers map[graph.DefKey][]*Call // by callee
+	callees map[graph.DefKey][]*Call // by caller
+}
+
+// New builds the call graph of the calls between defs.
+func New(defs []*graph.Def, refs []*graph.Ref) *Graph {
+	g := &Graph{
+		defs:    make(map[graph.DefKey]*graph.Def, len(defs)),
+		callers: make(map[graph.DefKey][]*Call),
+		callees: make(map[graph.DefKey][]*Call),
+	}
+	for _, def := range defs {
+		g.defs[def.DefKey.WithoutCommit()] = def
+	}
+
+	calls := make(map[[2]graph.DefKey]*Call)
+	for _, ref := range refs {
+		if ref.Enclosing == "" || ref.Kind != graph.RefCall {
+			continue
+		}
+		callee := ref.DefKey()
+		if def, ok := g.defs[callee]; !ok || !def.Callable {
+			continue
+		}
+		caller := graph.DefKey{Repo: ref.Repo, UnitType: ref.UnitType, Unit: ref.Unit, Path: ref.Enclosing}
+		k := [2]graph.DefKey{caller, callee}
+		c, ok := calls[k]
+		if !ok {
+			c = &Call{Caller: caller, Callee: callee}
+			calls[k] = c
+			g.callers[callee] = append(g.callers[callee], c)
+			g.callees[caller] = append(g.callees[caller], c)
+		}
+		c.Sites = append(c.Sites, ref)
+	}
+
+	for _, cs := range g.callers {
+		sort.Sort(callsBy{cs, func(c *Call) graph.DefKey { return c.Caller }})
+	}
+	for _, cs := range g.callees {
+		sort.Sort(callsBy{cs, func(c *Call) graph.DefKey { return c.Callee }})
+	}
+	return g
+}
+
+// Def returns the def with key k, or nil if it isn't in the graph.
+func (g *Graph) Def(k graph.DefKey) *graph.Def { return g.defs[k.WithoutCommit()] }
+
+// Callers returns the calls to k.
+func (g *Graph) Callers(k graph.DefKey) []*Call { return g.callers[k.WithoutCommit()] }
+
+// Callees returns the calls made by k.
+func (g *Graph) Callees(k graph.DefKey) []*Call { return g.callees[k.WithoutCommit()] }
+
+// A Reached def is one reachable from a starting def, at the given depth
+// (1 for direct callers or callees).
+type Reached struct {
+	Def   graph.DefKey
+	Depth int
+}
+
+// TransitiveCallers returns every def that calls k, directly or through up to
+// maxDepth calls, nearest first. A maxDepth of 0 means no limit.
+func (g *Graph) TransitiveCallers(k graph.DefKey, maxDepth int) []Reached {
+	return g.reach(k, maxDepth, func(c *Call) graph.DefKey { return c.Caller }, g.callers)
+}
+
+// TransitiveCallees returns every def that k calls, directly or through up to
+// maxDepth calls, nearest first. A maxDepth of 0 means no limit.
+func (g *Graph) TransitiveCallees(k graph.DefKey, maxDepth int) []Reached {
+	return g.reach(k, maxDepth, func(c *Call) graph.DefKey { return c.Callee }, g.callees)
+}
+
+func (g *Graph) reach(k graph.DefKey, maxDepth int, next func(*Call) graph.DefKey, edges map[graph.DefKey][]*Call) []Reached {
+	k = k.WithoutCommit()
+	var reached []Reached
+	seen := map[graph.DefKey]bool{k: true}
+	frontier := []graph.DefKey{k}
+	for depth := 1; len(frontier) > 0 && (maxDepth == 0 || depth <= maxDepth); depth++ {
+		var nextFrontier []graph.DefKey
+		for _, d := range frontier {
+			for _, c := range edges[d] {
+				n := next(c)
+				if !seen[n] {
+					seen[n] = true
+					reached = append(reached, Reached{n, depth})
+					nextFrontier = append(nextFrontier, n)
+				}
+			}
+		}
+		frontier = nextFrontier
+	}
+	return reached
+}
+
+// A Path is a sequence of calls, from the first def to the last.
+type Path []graph.DefKey
+
+// Limits on the paths returned by Paths. The number of paths can grow
+// exponentially with their length, so both are always bounded.
+const (
+	DefaultPathDepth = 6   // maximum length of paths, when no maxDepth is given
+	MaxPathDepth     = 12  // maximum length of paths, whatever maxDepth is
+	DefaultPathLimit = 100 // maximum number of paths, when no maxPaths is given
+)
+
+// Paths returns the call paths from one def to another that are at most
+// maxDepth calls long (DefaultPathDepth if it's 0, and at most MaxPathDepth),
+// shortest first. At most maxPaths paths are returned (DefaultPathLimit if
+// it's 0). Paths never visit a def twice, so recursion doesn't produce
+// infinitely many paths.
+func (g *Graph) Paths(from, to graph.DefKey, maxDepth, maxPaths int) []Path {
+	if maxDepth <= 0 {
+		maxDepth = DefaultPathDepth
+	}
+	if maxDepth > MaxPathDepth {
+		maxDepth = MaxPathDepth
+	}
+	if maxPaths <= 0 {
+		maxPaths = DefaultPathLimit
+	}
+	from, to = from.WithoutCommit(), to.WithoutCommit()
+	// Breadth-first, so that shorter paths are found (and kept) first.
+	var paths []Path
+	queue := []Path{{from}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		last := p[len(p)-1]
+		if last == to && len(p) > 1 {
+			paths = append(paths, p)
+			if len(paths) >= maxPaths {
+				break
+			}
+			continue
+		}
+		if len(p)-1 >= maxDepth {
+			continue
+		}
+		for _, c := range g.callees[last] {
+			if !p.contains(c.Callee) || c.Callee == to {
+				np := make(Path, len(p), len(p)+1)
+				copy(np, p)
+				queue = append(queue, append(np, c.Callee))
+			}
+		}
+	}
+	return paths
+}
+
+func (p Path) contains(k graph.DefKey) bool {
+	for _, d := range p {
+		if d == k {
+			return true
+		}
+	}
+	return false
+}
+
+type callsBy struct {
+	calls []*Call
+	key   func(*Call) graph.DefKey
+}
+
+func (v callsBy) Len() int      { return len(v.calls) }
+func (v callsBy) Swap(i, j int) { v.calls[i], v.calls[j] = v.calls[j], v.calls[i] }
+func (v callsBy) Less(i, j int) bool {
+	a, b := v.key(v.calls[i]), v.key(v.calls[j])
+	if a.Repo != b.Repo {
+		return a.Repo < b.Repo
+	}
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/apicompat"
+	"github.com/sourcegraph/talks/google-io-2014/golang"
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+func init() {
+	subcmds = append(subcmds, subcmd{"apicompat", "report breaking changes to exported Go APIs between two git revisions", apicompatCmd})
+}
+
+func apicompatCmd(args []string) error {
+	fs := flag.NewFlagSet("apicompat", flag.ExitOnError)
+	dir := fs.String("C", ".", "git repository `dir`")
+	jsonOut := fs.Bool("json", false, "print changes as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: srcgraph apicompat [flags] <old-rev> <new-rev>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	oldDefs, err := goDefsAtRev(*dir, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newDefs, err := goDefsAtRev(*dir, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	changes := apicompat.Check(oldDefs, newDefs)
+	if *jsonOut {
+		if changes == nil {
+			changes = []*apicompat.Change{}
+		}
+		if err := writeJSON(changes); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	}
+	if len(changes) > 0 {
+		return fmt.Errorf("%d breaking API change(s) between %s and %s", len(changes), fs.Arg(0), fs.Arg(1))
+	}
+	return nil
+}
+
+// goDefsAtRev returns the defs in the Go packages of the git repository in dir
+// at revision rev, with their API types (see apicompat.SetAPITypes).
+func goDefsAtRev(dir, rev string) ([]*graph.Def, error) {
+	tmp, err := ioutil.TempDir("", "srcgraph-apicompat-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := gitExport(dir, rev, tmp); err != nil {
+		return nil, err
+	}
+
+	var a golang.GoAnalyzer
+	pkgs, err := a.Scan(tmp)
+	if err != nil {
+		return nil, err
+	}
+	var defs []*graph.Def
+	for _, pkg := range pkgs {
+		ldefs, _, err := a.Analyze(filepath.Join(tmp, pkg))
+		if _, err = lang.SplitDiagnostics(err); err != nil {
+			return nil, err
+		}
+		for _, def := range ldefs {
+			if rel, err := filepath.Rel(tmp, def.File); err == nil {
+				def.File = filepath.ToSlash(rel)
+			}
+		}
+		pdefs, _ := lang.ToGraph("", "", "go", filepath.ToSlash(pkg), ldefs, nil)
+		if err := apicompat.SetAPITypes(filepath.Join(tmp, pkg), pdefs); err != nil {
+			return nil, err
+		}
+		defs = append(defs, pdefs...)
+	}
+	return defs, nil
+}
+
+// gitExport writes the tree of the git repository in dir at revision rev to
+// the directory dst.
+func gitExport(dir, rev, dst string) error {
+	cmd := exec.Command("git", "archive", "--format=tar", rev)
+	cmd.Dir = dir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := extractTar(out, dst); err != nil {
+		// Stop git, which would otherwise block writing the rest of the
+		// archive to the pipe.
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	// Read the padding after the end of the archive, so that git can exit.
+	if _, err := io.Copy(ioutil.Discard, out); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git archive %s: %s (%s)", rev, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// extractTar extracts the regular files and directories in a tar archive to
+// dst.
+func extractTar(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(dst, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(name, filepath.Clean(dst)+string(filepath.Separator)) {
+			return errors.New("git archive: file outside of tree: " + hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return err
+			}
+			f, err := os.Create(name)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/vcs"
+)
+
+func init() {
+	subcmds = append(subcmds, subcmd{"blame", "list defs with their authors and last commit from git blame, as JSON", blameCmd})
+}
+
+func blameCmd(args []string) error {
+	fs := flag.NewFlagSet("blame", flag.ExitOnError)
+	repo := fs.String("repo", "", "repository URI to record in the output")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	defs, _, err := analyzeDir(*repo, dir)
+	if err != nil {
+		return err
+	}
+	// Blame the working tree, since that's what was analyzed.
+	if err := vcs.BlameDefs(dir, "", defs); err != nil {
+		return err
+	}
+	if defs == nil {
+		defs = []*graph.Def{}
+	}
+	return writeJSON(defs)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/codesearch"
+)
+
+func init() {
+	subcmds = append(subcmds,
+		subcmd{"index", "add a dir's files and defs to a code search index", indexCmd},
+		subcmd{"search", "search the files in a code search index, as JSON", searchCmd},
+	)
+}
+
+func indexCmd(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	index := fs.String("index", "codesearch", "code search index dir")
+	repo := fs.String("repo", "", "repository URI to index the dir as (required)")
+	commitID := fs.String("commit", "", "commit ID that the dir is checked out at")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	if *repo == "" {
+		return errors.New("index: -repo is required")
+	}
+
+	defs, _, err := analyzeDir(*repo, dir)
+	if err != nil {
+		return err
+	}
+	return codesearch.NewIndex(*index).IndexCommit(*repo, *commitID, dir, defs)
+}
+
+func searchCmd(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	index := fs.String("index", "codesearch", "code search index dir")
+	var q codesearch.Query
+	fs.BoolVar(&q.Regexp, "regexp", false, "treat the pattern as a regexp")
+	fs.BoolVar(&q.IgnoreCase, "i", false, "ignore case")
+	fs.StringVar(&q.Repo, "repo", "", "only search this repository")
+	fs.StringVar(&q.Path, "path", "", "only search files whose path matches this regexp")
+	fs.StringVar(&q.Lang, "lang", "", `only search files of this language (e.g., "go", "js")`)
+	fs.IntVar(&q.ContextLines, "C", 0, "lines of context before and after each match")
+	fs.IntVar(&q.Limit, "limit", codesearch.DefaultLimit, "maximum number of matches")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("search: no pattern given")
+	}
+	q.Pattern = strings.Join(fs.Args(), " ")
+
+	matches, err := codesearch.NewIndex(*index).Search(&q)
+	if err != nil {
+		return err
+	}
+	if matches == nil {
+		matches = []*codesearch.Match{}
+	}
+	return writeJSON(matches)
+}
@@ -0,0 +1,83 @@
+// Command srcgraph analyzes the source code in a directory and reports on its
+// defs and refs.
+//
+// Usage:
+//
+//	srcgraph <command> [flags] [args]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/sourcegraph/talks/google-io-2014/golang"
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	_ "github.com/sourcegraph/talks/google-io-2014/html"
+	_ "github.com/sourcegraph/talks/google-io-2014/javascript"
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+type subcmd struct {
+	name string
+	desc string
+	run  func(args []string) error
+}
+
+// subcmds is populated by each subcommand's init func.
+var subcmds []subcmd
+
+func main() {
+	lang.ServeWorker()
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: srcgraph <command> [flags] [args]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "The commands are:")
+		for _, c := range subcmds {
+			fmt.Fprintf(os.Stderr, "\t%-10s %s\n", c.name, c.desc)
+		}
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, c := range subcmds {
+		if c.name == name {
+			if err := c.run(flag.Args()[1:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	log.Printf("srcgraph: unknown command %q", name)
+	flag.Usage()
+	os.Exit(2)
+}
+
+// analyzeDir analyzes the source units in dir with all registered analyzers.
+func analyzeDir(repo, dir string) ([]*graph.Def, []*graph.Ref, error) {
+	units, err := lang.AnalyzeDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var defs []*graph.Def
+	var refs []*graph.Ref
+	for _, u := range units {
+		udefs, urefs := u.ToGraph(repo, "")
+		defs = append(defs, udefs...)
+		refs = append(refs, urefs...)
+	}
+	return defs, refs, nil
+}
+
+func writeJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+func init() {
+	subcmds = append(subcmds, subcmd{"units", "list source units with their files, and files claimed by several or no units, as JSON", unitsCmd})
+}
+
+func unitsCmd(args []string) error {
+	fs := flag.NewFlagSet("units", flag.ExitOnError)
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	units, own, err := lang.ScanDir(dir)
+	if err != nil {
+		return err
+	}
+	if units == nil {
+		units = []*lang.SourceUnit{} // so that consumers see [], not null
+	}
+	return writeJSON(struct {
+		Units []*lang.SourceUnit
+		*lang.Ownership
+	}{units, own})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/unused"
+)
+
+func init() {
+	subcmds = append(subcmds, subcmd{"unused", "list unexported defs that nothing refers to, as JSON", unusedCmd})
+}
+
+func unusedCmd(args []string) error {
+	fs := flag.NewFlagSet("unused", flag.ExitOnError)
+	repo := fs.String("repo", "", "repository URI to record in the output")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	defs, refs, err := analyzeDir(*repo, dir)
+	if err != nil {
+		return err
+	}
+	found := unused.Find(defs, refs)
+	if found == nil {
+		found = []*graph.Def{} // so that consumers see [], not null
+	}
+	return writeJSON(found)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/graph/graphfile"
+)
+
+func init() {
+	subcmds = append(subcmds, subcmd{"validate", "merge the graphs of all source units and list their errors, as JSON", validateCmd})
+}
+
+func validateCmd(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	repo := fs.String("repo", "", "repository URI to record in the output")
+	commitID := fs.String("commit", "", "commit ID to record in the output")
+	printGraph := fs.Bool("graph", false, "also print the merged graph")
+	out := fs.String("o", "", "write the merged graph to this file, in the graphfile format")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	defs, refs, err := analyzeDir(*repo, dir)
+	if err != nil {
+		return err
+	}
+	// The units' declared dependencies are the units they import.
+	opt := &graph.Options{Deps: graph.ImportedUnits(refs), FileSize: graph.DirFileSize(dir)}
+	g, errs := graph.Merge(*repo, *commitID, defs, refs, opt)
+	if *out != "" {
+		if err := graphfile.WriteFile(*out, g); err != nil {
+			return err
+		}
+	}
+	if errs == nil {
+		errs = []*graph.Error{} // so that consumers see [], not null
+	}
+	if !*printGraph {
+		return writeJSON(errs)
+	}
+	return writeJSON(struct {
+		Graph  *graph.Graph
+		Errors []*graph.Error
+	}{g, errs})
+}
@@ -0,0 +1,438 @@
+// Package codesearch implements full-text code search over indexed
+// repositories, using an on-disk trigram index per repository.
+//
+// Each repository's index records the commit it was built from, the path,
+// language and hash of every text file, and a posting list of file IDs per
+// trigram. File contents are stored next to the index, one file per hash,
+// and only read to verify a search's candidate files. Re-indexing a
+// repository at a new commit only re-tokenizes files whose contents changed.
+package codesearch
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// MaxFileSize is the largest file that will be indexed. Larger files are
+// skipped, as are binary files.
+var MaxFileSize int64 = 1 << 20
+
+// MaxLoaded is the number of repository indexes kept in memory. When more
+// are loaded, the least recently used ones are dropped.
+var MaxLoaded = 16
+
+// Index is a collection of per-repository trigram indexes stored in a
+// directory.
+type Index struct {
+	Dir string
+
+	indexing sync.Mutex // held by IndexCommit
+
+	mu    sync.Mutex // guards repos and clock
+	repos map[string]*loadedIndex
+	clock uint64
+}
+
+func NewIndex(dir string) *Index {
+	return &Index{Dir: dir, repos: make(map[string]*loadedIndex)}
+}
+
+// A loadedIndex is a repository index in memory. Its repoIndex is never
+// modified once loaded, so it can be searched without holding Index.mu.
+type loadedIndex struct {
+	ri      *repoIndex
+	modTime time.Time // of the index file it was read from
+	used    uint64    // Index.clock when it was last used
+}
+
+type repoIndex struct {
+	Repo     string
+	CommitID string
+
+	// Files is indexed by file ID. Entries of deleted or changed files are
+	// nil until the index is compacted (which happens before it's saved).
+	Files    []*fileEntry
+	Postings map[trigram][]uint32 // sorted file IDs
+}
+
+type fileEntry struct {
+	Path  string
+	Lang  string // the analyzer language of the file's source unit, if any (e.g., "go", "js")
+	Class string // the file's class (lang.FileGenerated), if it isn't the repo's own source
+	Hash  [sha1.Size]byte
+	Defs  []*graph.Def // defs in this file, sorted by DefStart
+}
+
+func (x *Index) repoFile(repo string) string {
+	return filepath.Join(x.Dir, url.QueryEscape(repo)+".idx")
+}
+
+// contentsDir is the dir of the contents of repo's indexed files.
+func (x *Index) contentsDir(repo string) string {
+	return filepath.Join(x.Dir, url.QueryEscape(repo)+".files")
+}
+
+func (x *Index) contentsFile(repo string, hash [sha1.Size]byte) string {
+	return filepath.Join(x.contentsDir(repo), hex.EncodeToString(hash[:]))
+}
+
+// contents returns the contents of f, an indexed file of repo.
+func (x *Index) contents(repo string, f *fileEntry) ([]byte, error) {
+	return ioutil.ReadFile(x.contentsFile(repo, f.Hash))
+}
+
+// IndexCommit indexes the files of repo at commitID, which is checked out in
+// dir. Defs (whose File fields are relative to dir) are attached to their
+// files so that matches can link to them. Files are labeled with the
+// language of the source unit they belong to (as lang.ScanDir finds them, or
+// else the UnitType of their defs). As in lang.ScanDir, files that
+// lang.NewClassifier(dir) classifies as ignored or vendored are skipped, and
+// generated files are labeled with their class.
+//
+// If repo was already indexed, only files that were added or changed since
+// are re-indexed. If indexing fails, the previous index is left as it was.
+func (x *Index) IndexCommit(repo, commitID, dir string, defs []*graph.Def) error {
+	x.indexing.Lock()
+	defer x.indexing.Unlock()
+
+	// Update a fresh copy of the index, so that searches of the loaded one
+	// aren't affected until the new one is saved.
+	ri, _, err := x.read(repo)
+	if os.IsNotExist(err) {
+		ri = &repoIndex{Repo: repo, Postings: make(map[trigram][]uint32)}
+	} else if err != nil {
+		return err
+	}
+
+	langs, err := fileLangs(dir)
+	if err != nil {
+		return err
+	}
+
+	defsByFile := make(map[string][]*graph.Def)
+	for _, def := range defs {
+		defsByFile[def.File] = append(defsByFile[def.File], def)
+	}
+	for file, fdefs := range defsByFile {
+		sort.Sort(defsByStart(fdefs))
+		if _, ok := langs[file]; !ok {
+			langs[file] = fdefs[0].UnitType // no analyzer for it is registered in this process
+		}
+	}
+
+	existing := make(map[string]uint32, len(ri.Files))
+	for id, f := range ri.Files {
+		if f != nil {
+			existing[f.Path] = uint32(id)
+		}
+	}
+
+	if err := os.MkdirAll(x.contentsDir(repo), 0755); err != nil {
+		return err
+	}
+	c := lang.NewClassifier(dir)
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		class := ""
+		if rel != "." {
+			class = c.Classify(rel)
+		}
+		if fi.IsDir() {
+			if fi.Name() == ".git" || fi.Name() == ".hg" || class == lang.FileIgnored || class == lang.FileVendored {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() || fi.Size() > MaxFileSize || class == lang.FileIgnored || class == lang.FileVendored {
+			return nil
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if isBinary(contents) {
+			return nil
+		}
+		hash := sha1.Sum(contents)
+
+		if id, ok := existing[rel]; ok {
+			delete(existing, rel)
+			if f := ri.Files[id]; f.Hash == hash {
+				f.Lang, f.Class, f.Defs = langs[rel], class, defsByFile[rel]
+				return nil
+			}
+			if err := x.remove(ri, id); err != nil {
+				return err
+			}
+		}
+		if err := x.writeContents(repo, hash, contents); err != nil {
+			return err
+		}
+		ri.add(&fileEntry{Path: rel, Lang: langs[rel], Class: class, Hash: hash, Defs: defsByFile[rel]}, contents)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Whatever wasn't seen in this commit was deleted.
+	for _, id := range existing {
+		if err := x.remove(ri, id); err != nil {
+			return err
+		}
+	}
+	ri.CommitID = commitID
+	ri.compact()
+
+	if err := x.save(ri); err != nil {
+		return err
+	}
+	x.mu.Lock()
+	delete(x.repos, repo) // reloaded on the next search
+	x.mu.Unlock()
+	return x.removeUnusedContents(ri)
+}
+
+// fileLangs returns the language of each source file under dir (by path
+// relative to dir), which is the type of the source unit it belongs to.
+func fileLangs(dir string) (map[string]string, error) {
+	units, _, err := lang.ScanDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	langs := make(map[string]string)
+	for _, u := range units {
+		for _, f := range u.Files {
+			langs[f] = u.Type
+		}
+	}
+	return langs, nil
+}
+
+// Repos lists the repositories in the index.
+func (x *Index) Repos() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(x.Dir, "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	repos := make([]string, 0, len(names))
+	for _, name := range names {
+		repo, err := url.QueryUnescape(strings.TrimSuffix(filepath.Base(name), ".idx"))
+		if err != nil {
+			continue
+		}
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// load returns the index of repo, reading it from disk if it isn't loaded or
+// if its index file has changed since it was loaded (e.g., because another
+// process re-indexed the repo).
+func (x *Index) load(repo string) (*repoIndex, error) {
+	fi, err := os.Stat(x.repoFile(repo))
+	if err != nil {
+		return nil, err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.clock++
+	if l, ok := x.repos[repo]; ok && l.modTime.Equal(fi.ModTime()) {
+		l.used = x.clock
+		return l.ri, nil
+	}
+	ri, modTime, err := x.read(repo)
+	if err != nil {
+		return nil, err
+	}
+	x.repos[repo] = &loadedIndex{ri: ri, modTime: modTime, used: x.clock}
+	for len(x.repos) > MaxLoaded {
+		var lru string
+		for r, l := range x.repos {
+			if lru == "" || l.used < x.repos[lru].used {
+				lru = r
+			}
+		}
+		delete(x.repos, lru)
+	}
+	return ri, nil
+}
+
+// read reads the index of repo from disk, and returns it with the
+// modification time of its index file.
+func (x *Index) read(repo string) (*repoIndex, time.Time, error) {
+	f, err := os.Open(x.repoFile(repo))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var ri repoIndex
+	if err := gob.NewDecoder(f).Decode(&ri); err != nil {
+		return nil, time.Time{}, err
+	}
+	return &ri, fi.ModTime(), nil
+}
+
+// save atomically writes ri to disk.
+func (x *Index) save(ri *repoIndex) error {
+	if err := os.MkdirAll(x.Dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(x.Dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(tmp).Encode(ri); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), x.repoFile(ri.Repo))
+}
+
+// writeContents stores the contents of a file of repo, unless contents with
+// the same hash are already stored.
+func (x *Index) writeContents(repo string, hash [sha1.Size]byte, contents []byte) error {
+	name := x.contentsFile(repo, hash)
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+	tmp, err := ioutil.TempFile(x.contentsDir(repo), "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// removeUnusedContents removes the stored contents of repo's files that ri
+// (its saved index) doesn't refer to, such as those of deleted files or left
+// behind by a failed IndexCommit.
+func (x *Index) removeUnusedContents(ri *repoIndex) error {
+	used := make(map[string]bool, len(ri.Files))
+	for _, f := range ri.Files {
+		used[hex.EncodeToString(f.Hash[:])] = true
+	}
+	names, err := ioutil.ReadDir(x.contentsDir(ri.Repo))
+	if err != nil {
+		return err
+	}
+	for _, fi := range names {
+		if !used[fi.Name()] {
+			if err := os.Remove(filepath.Join(x.contentsDir(ri.Repo), fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// add adds f, whose contents are given, to ri.
+func (ri *repoIndex) add(f *fileEntry, contents []byte) {
+	id := uint32(len(ri.Files))
+	ri.Files = append(ri.Files, f)
+	for t := range trigrams(contents) {
+		// IDs only grow, so appending keeps posting lists sorted.
+		ri.Postings[t] = append(ri.Postings[t], id)
+	}
+}
+
+// remove removes the file with the given ID from ri, reading its stored
+// contents to find the posting lists it's in.
+func (x *Index) remove(ri *repoIndex, id uint32) error {
+	contents, err := x.contents(ri.Repo, ri.Files[id])
+	if err != nil {
+		return err
+	}
+	for t := range trigrams(contents) {
+		ids := ri.Postings[t]
+		i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+		if i < len(ids) && ids[i] == id {
+			ids = append(ids[:i], ids[i+1:]...)
+		}
+		if len(ids) == 0 {
+			delete(ri.Postings, t)
+		} else {
+			ri.Postings[t] = ids
+		}
+	}
+	ri.Files[id] = nil
+	return nil
+}
+
+// compact drops the entries of removed files and renumbers the remaining
+// file IDs in posting lists. Renumbering preserves order, so posting lists stay
+// sorted and no file needs to be re-tokenized.
+func (ri *repoIndex) compact() {
+	newID := make([]uint32, len(ri.Files))
+	var live []*fileEntry
+	for id, f := range ri.Files {
+		if f != nil {
+			newID[id] = uint32(len(live))
+			live = append(live, f)
+		}
+	}
+	if len(live) == len(ri.Files) {
+		return
+	}
+	for t, ids := range ri.Postings {
+		for i, id := range ids {
+			ids[i] = newID[id]
+		}
+		ri.Postings[t] = ids
+	}
+	ri.Files = live
+}
+
+// isBinary reports whether b looks like the contents of a binary file.
+func isBinary(b []byte) bool {
+	if len(b) > 8000 {
+		b = b[:8000]
+	}
+	return bytes.IndexByte(b, 0) != -1
+}
+
+type defsByStart []*graph.Def
+
+func (v defsByStart) Len() int           { return len(v) }
+func (v defsByStart) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v defsByStart) Less(i, j int) bool { return v[i].DefStart < v[j].DefStart }
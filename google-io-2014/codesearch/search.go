@@ -0,0 +1,210 @@
+package codesearch
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// Query is a code search query. Its filters are decoded from querystrings
+// like the other API option structs.
+type Query struct {
+	Pattern    string
+	Regexp     bool   `url:",omitempty"` // treat Pattern as a regexp instead of a literal string
+	IgnoreCase bool   `url:",omitempty"`
+	Repo       string `url:",omitempty"` // only search this repo
+	Path       string `url:",omitempty"` // only search files whose path matches this regexp
+	Lang       string `url:",omitempty"` // only search files of this language (e.g., "go", "js")
+
+	ContextLines int `url:",omitempty"` // lines of context before and after each match
+	Limit        int `url:",omitempty"`
+}
+
+// DefaultLimit is the maximum number of matches returned when Query.Limit is
+// not set.
+const DefaultLimit = 100
+
+type Match struct {
+	Repo     string
+	CommitID string
+	File     string
+	Class    string // the class of File (lang.FileGenerated), if it isn't the repo's own source
+	Line     int    // 1-based line number of the start of the match
+	Start    int    // byte offset of the match in File
+	End      int
+
+	Text   string   // the line containing the start of the match
+	Before []string // context lines preceding Text
+	After  []string // context lines following Text
+
+	// Defs whose range overlaps the match, so that the match can link to
+	// them.
+	Defs []*graph.Def
+}
+
+// Search returns matches for q across indexed repositories, ordered by repo,
+// file and position.
+func (x *Index) Search(q *Query) ([]*Match, error) {
+	expr := q.Pattern
+	if !q.Regexp {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if q.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile("(?m)" + expr)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	ts := queryTrigrams(parsed)
+
+	var pathRE *regexp.Regexp
+	if q.Path != "" {
+		if pathRE, err = regexp.Compile(q.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	repos := []string{q.Repo}
+	if q.Repo == "" {
+		if repos, err = x.Repos(); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	var matches []*Match
+	for _, repo := range repos {
+		ri, err := x.load(repo)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, id := range ri.candidates(ts) {
+			f := ri.Files[id]
+			if (q.Lang != "" && f.Lang != q.Lang) || (pathRE != nil && !pathRE.MatchString(f.Path)) {
+				continue
+			}
+			contents, err := x.contents(repo, f)
+			if os.IsNotExist(err) {
+				continue // removed by a newer index of the repo
+			} else if err != nil {
+				return nil, err
+			}
+			for _, loc := range re.FindAllIndex(contents, limit-len(matches)) {
+				if loc[0] == loc[1] {
+					continue // skip empty matches
+				}
+				m := &Match{Repo: ri.Repo, CommitID: ri.CommitID, File: f.Path, Class: f.Class, Start: loc[0], End: loc[1]}
+				m.Line, m.Text, m.Before, m.After = lineContext(contents, loc[0], q.ContextLines)
+				m.Defs = defsOverlapping(f.Defs, loc[0], loc[1])
+				matches = append(matches, m)
+			}
+			if len(matches) >= limit {
+				return matches, nil
+			}
+		}
+	}
+	return matches, nil
+}
+
+// candidates returns the IDs of files containing all of ts, in order. If ts
+// is empty, all files are candidates.
+func (ri *repoIndex) candidates(ts []trigram) []uint32 {
+	if len(ts) == 0 {
+		ids := make([]uint32, 0, len(ri.Files))
+		for id, f := range ri.Files {
+			if f != nil {
+				ids = append(ids, uint32(id))
+			}
+		}
+		return ids
+	}
+
+	// Intersect the shortest posting lists first.
+	lists := make([][]uint32, len(ts))
+	for i, t := range ts {
+		lists[i] = ri.Postings[t]
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	ids := lists[0]
+	for _, l := range lists[1:] {
+		if len(ids) == 0 {
+			break
+		}
+		ids = intersect(ids, l)
+	}
+	return ids
+}
+
+func intersect(a, b []uint32) []uint32 {
+	var c []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			c = append(c, a[i])
+			i++
+			j++
+		}
+	}
+	return c
+}
+
+// lineContext returns the 1-based line number and text of the line containing
+// offset, along with up to n lines before and after it.
+func lineContext(b []byte, offset, n int) (line int, text string, before, after []string) {
+	line = 1 + bytes.Count(b[:offset], []byte("\n"))
+	start := bytes.LastIndexByte(b[:offset], '\n') + 1
+	end := len(b)
+	if i := bytes.IndexByte(b[offset:], '\n'); i != -1 {
+		end = offset + i
+	}
+	text = string(b[start:end])
+
+	for i, s := 0, start; i < n && s > 0; i++ {
+		e := s - 1
+		s = bytes.LastIndexByte(b[:e], '\n') + 1
+		before = append([]string{string(b[s:e])}, before...)
+	}
+	for i, s := 0, end; i < n && s+1 < len(b); i++ {
+		s++
+		e := len(b)
+		if j := bytes.IndexByte(b[s:], '\n'); j != -1 {
+			e = s + j
+		}
+		after = append(after, string(b[s:e]))
+		s = e
+	}
+	return line, text, before, after
+}
+
+func defsOverlapping(defs []*graph.Def, start, end int) []*graph.Def {
+	var ds []*graph.Def
+	for _, def := range defs {
+		if def.DefStart >= end {
+			break // defs are sorted by Start
+		}
+		if start < def.DefEnd {
+			ds = append(ds, def)
+		}
+	}
+	return ds
+}
@@ -0,0 +1,176 @@
+package codesearch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// writeFiles writes files (by slash-separated path) under dir, and removes
+// the files whose contents are "".
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if contents == "" {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// search returns the matches for q as "repo@commit file:line: text" strings.
+func search(t *testing.T, x *Index, q Query) []string {
+	t.Helper()
+	matches, err := x.Search(&q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ms []string
+	for _, m := range matches {
+		ms = append(ms, fmt.Sprintf("%s@%s %s:%d: %s", m.Repo, m.CommitID, m.File, m.Line, m.Text))
+	}
+	return ms
+}
+
+func TestSearch(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"app.js":                 "// app\nfunction hello() {\n  return 'Hello, world';\n}\n",
+		"lib/greet.go":           "package lib\n\nfunc Hello() string { return \"hello\" }\n",
+		"gen/api.js":             "// @generated\nfunction helloAPI() {}\n",
+		"node_modules/x/x.js":    "function hello() {}\n",
+		"logo.png":               "hello\x00\x01",
+		".gitignore":             "build/\n",
+		"build/out.js":           "function hello() {}\n",
+		"lib/nested/deep/doc.md": "Say HELLO.\n",
+	})
+	defs := []*graph.Def{
+		{DefKey: graph.DefKey{UnitType: "js", Unit: "app.js", Path: "hello"}, File: "app.js", DefStart: 7, DefEnd: 59},
+		{DefKey: graph.DefKey{UnitType: "go", Unit: "lib", Path: "Hello"}, File: "lib/greet.go", DefStart: 13, DefEnd: 53},
+	}
+	x := NewIndex(t.TempDir())
+	if err := x.IndexCommit("r", "c1", src, defs); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		q    Query
+		want []string
+	}{
+		{Query{Pattern: "hello"}, []string{"r@c1 app.js:2: function hello() {", "r@c1 gen/api.js:2: function helloAPI() {}", `r@c1 lib/greet.go:3: func Hello() string { return "hello" }`}},
+		{Query{Pattern: "hello", IgnoreCase: true, Path: `^lib/`}, []string{`r@c1 lib/greet.go:3: func Hello() string { return "hello" }`, `r@c1 lib/greet.go:3: func Hello() string { return "hello" }`, "r@c1 lib/nested/deep/doc.md:1: Say HELLO."}},
+		{Query{Pattern: "hello", Lang: "js"}, []string{"r@c1 app.js:2: function hello() {"}},
+		{Query{Pattern: `func(tion)? [A-Z]\w*\(`, Regexp: true}, []string{`r@c1 lib/greet.go:3: func Hello() string { return "hello" }`}},
+		{Query{Pattern: `world|api`, Regexp: true, IgnoreCase: true}, []string{"r@c1 app.js:3:   return 'Hello, world';", "r@c1 gen/api.js:2: function helloAPI() {}"}},
+		{Query{Pattern: "hello", Limit: 1}, []string{"r@c1 app.js:2: function hello() {"}},
+		{Query{Pattern: "hello", Repo: "other"}, nil},
+		{Query{Pattern: "goodbye"}, nil},
+	}
+	for _, test := range tests {
+		if got := search(t, x, test.q); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %q, want %q", test.q, got, test.want)
+		}
+	}
+
+	matches, err := x.Search(&Query{Pattern: "Hello, world", ContextLines: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(matches))
+	}
+	m := matches[0]
+	if want := []string{"// app", "function hello() {"}; !reflect.DeepEqual(m.Before, want) {
+		t.Errorf("got Before %q, want %q", m.Before, want)
+	}
+	if want := []string{"}"}; !reflect.DeepEqual(m.After, want) {
+		t.Errorf("got After %q, want %q", m.After, want)
+	}
+	if len(m.Defs) != 1 || m.Defs[0].Path != "hello" {
+		t.Errorf("got Defs %+v, want hello", m.Defs)
+	}
+	if got := string(mustRead(t, filepath.Join(src, "app.js"))[m.Start:m.End]); got != "Hello, world" {
+		t.Errorf("got match range text %q", got)
+	}
+
+	matches, err = x.Search(&Query{Pattern: "helloAPI"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Class != lang.FileGenerated {
+		t.Errorf("got %+v, want a match in a generated file", matches)
+	}
+
+	if _, err := x.Search(&Query{Pattern: "(", Regexp: true}); err == nil {
+		t.Error("invalid regexp: got no error")
+	}
+}
+
+func TestIndexCommit_reindex(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"a.js": "var apple = 1;\n",
+		"b.js": "var banana = 2;\n",
+		"c.js": "var cherry = 3;\n",
+	})
+	x := NewIndex(t.TempDir())
+	if err := x.IndexCommit("r", "c1", src, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.IndexCommit("s", "d1", src, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := search(t, x, Query{Pattern: "banana"}), []string{"r@c1 b.js:1: var banana = 2;", "s@d1 b.js:1: var banana = 2;"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	writeFiles(t, src, map[string]string{
+		"b.js": "var blueberry = 2;\n",
+		"c.js": "",
+		"d.js": "var date = 4;\n",
+	})
+	if err := x.IndexCommit("r", "c2", src, nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]string{
+		"apple":     {"r@c2 a.js:1: var apple = 1;", "s@d1 a.js:1: var apple = 1;"},
+		"banana":    {"s@d1 b.js:1: var banana = 2;"},
+		"blueberry": {"r@c2 b.js:1: var blueberry = 2;"},
+		"cherry":    {"s@d1 c.js:1: var cherry = 3;"},
+		"date":      {"r@c2 d.js:1: var date = 4;"},
+	}
+	for pattern, want := range tests {
+		if got := search(t, x, Query{Pattern: pattern}); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", pattern, got, want)
+		}
+	}
+
+	repos, err := x.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"r", "s"}; !reflect.DeepEqual(repos, want) {
+		t.Errorf("got repos %q, want %q", repos, want)
+	}
+}
+
+func mustRead(t *testing.T, name string) []byte {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,102 @@
+package codesearch
+
+import (
+	"regexp/syntax"
+	"unicode/utf8"
+)
+
+// A trigram is 3 consecutive bytes of (ASCII-lowercased) file content, packed
+// into the low 24 bits of a uint32. Indexing lowercased content lets the same
+// posting lists serve case-sensitive and case-insensitive queries; matches are
+// always verified against the real content afterwards.
+type trigram uint32
+
+func lowerASCII(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// trigrams returns the set of distinct trigrams in b.
+func trigrams(b []byte) map[trigram]struct{} {
+	set := make(map[trigram]struct{})
+	for i := 0; i+3 <= len(b); i++ {
+		t := trigram(lowerASCII(b[i]))<<16 | trigram(lowerASCII(b[i+1]))<<8 | trigram(lowerASCII(b[i+2]))
+		set[t] = struct{}{}
+	}
+	return set
+}
+
+// requiredLiterals returns strings that any match of the regexp re must
+// contain. A nil result means the regexp can't be narrowed down and every
+// file is a candidate.
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if lit, ok := literal(re); ok {
+			return []string{lit}
+		}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// Adjacent literals form one longer (and more selective) literal.
+		var lits []string
+		var run string
+		flush := func() {
+			if run != "" {
+				lits = append(lits, run)
+				run = ""
+			}
+		}
+		for _, sub := range re.Sub {
+			if lit, ok := literal(sub); ok {
+				run += lit
+				continue
+			}
+			flush()
+			lits = append(lits, requiredLiterals(sub)...)
+		}
+		flush()
+		return lits
+	}
+	return nil
+}
+
+// literal returns the string matched by a literal regexp node, if it can be
+// looked up in the (ASCII-lowercased) trigram index.
+func literal(re *syntax.Regexp) (string, bool) {
+	if re.Op != syntax.OpLiteral {
+		return "", false
+	}
+	s := string(re.Rune)
+	if re.Flags&syntax.FoldCase != 0 {
+		// Only ASCII case folding matches how content was lowercased.
+		for _, r := range re.Rune {
+			if r >= utf8.RuneSelf {
+				return "", false
+			}
+		}
+	}
+	return s, true
+}
+
+// queryTrigrams returns the trigrams that every file matching re must
+// contain, or nil if re can't be narrowed down.
+func queryTrigrams(re *syntax.Regexp) []trigram {
+	var ts []trigram
+	seen := make(map[trigram]struct{})
+	for _, lit := range requiredLiterals(re.Simplify()) {
+		for t := range trigrams([]byte(lit)) {
+			if _, dup := seen[t]; !dup {
+				seen[t] = struct{}{}
+				ts = append(ts, t)
+			}
+		}
+	}
+	return ts
+}
@@ -0,0 +1,151 @@
+// Package defsearch implements a symbol index over stored definitions. Defs
+// are matched by name prefix, camel-case humps (e.g., "NAR" finds
+// NewAPIRouter) or fuzzy subsequence, and ranked by match quality,
+// exportedness and how often they're referenced.
+package defsearch
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// Options filters and limits a def search. It's decoded from (and encoded to)
+// querystrings, just like the other API option structs.
+type Options struct {
+	Query string
+	Repo  string `url:",omitempty"`
+	Lang  string `url:",omitempty"`
+	Kind  string `url:",omitempty"`
+	Limit int    `url:",omitempty"`
+
+	// Scope, if set, limits results to defs with one of these scopes (e.g.,
+	// all but lang.ScopeLocal to hide local variables).
+	Scope []string `url:",omitempty"`
+}
+
+// DefaultLimit is the maximum number of results returned when Options.Limit
+// is not set.
+const DefaultLimit = 50
+
+type Result struct {
+	Def      *graph.Def
+	Match    Match
+	RefCount int
+	Score    float64
+}
+
+type entry struct {
+	def   *graph.Def
+	lower string   // lowercased name
+	humps []string // lowercased camel-case humps of name
+	refs  int
+}
+
+// Index is an in-memory symbol index. It is safe for concurrent searches once
+// built.
+type Index struct {
+	entries []*entry
+}
+
+// New builds an index over defs, using refs to count incoming references to
+// each def.
+func New(defs []*graph.Def, refs []*graph.Ref) *Index {
+	refCounts := make(map[graph.DefKey]int)
+	for _, ref := range refs {
+		if ref.Kind == graph.RefDecl {
+			continue
+		}
+		refCounts[ref.DefKey()]++
+	}
+
+	x := &Index{entries: make([]*entry, 0, len(defs))}
+	for _, def := range defs {
+		x.entries = append(x.entries, &entry{
+			def:   def,
+			lower: strings.ToLower(def.Name),
+			humps: humps(def.Name),
+			refs:  refCounts[def.DefKey.WithoutCommit()],
+		})
+	}
+	return x
+}
+
+// Search returns the defs matching opt.Query, best matches first.
+func (x *Index) Search(opt *Options) []*Result {
+	if opt == nil || opt.Query == "" {
+		return nil
+	}
+	q := strings.ToLower(opt.Query)
+
+	var results []*Result
+	for _, e := range x.entries {
+		if (opt.Repo != "" && e.def.Repo != opt.Repo) ||
+			(opt.Lang != "" && e.def.UnitType != opt.Lang) ||
+			(opt.Kind != "" && e.def.Kind != opt.Kind) ||
+			(len(opt.Scope) > 0 && !contains(opt.Scope, e.def.Scope)) {
+			continue
+		}
+		m, quality := match(opt.Query, q, e)
+		if m == NoMatch {
+			continue
+		}
+		results = append(results, &Result{
+			Def:      e.def,
+			Match:    m,
+			RefCount: e.refs,
+			Score:    score(quality, e),
+		})
+	}
+
+	sort.Sort(byScore(results))
+
+	limit := opt.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func contains(ss []string, s string) bool {
+	for _, s2 := range ss {
+		if s2 == s {
+			return true
+		}
+	}
+	return false
+}
+
+// score combines match quality with exportedness and (log-scaled) ref count,
+// so that a popular exported def beats an unused private one with the same
+// kind of match, but never outranks a strictly better kind of match.
+func score(quality float64, e *entry) float64 {
+	s := quality
+	if e.def.Exported {
+		s += 5
+	}
+	s += math.Min(math.Log2(1+float64(e.refs)), 9)
+	return s
+}
+
+type byScore []*Result
+
+func (v byScore) Len() int      { return len(v) }
+func (v byScore) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v byScore) Less(i, j int) bool {
+	if v[i].Score != v[j].Score {
+		return v[i].Score > v[j].Score
+	}
+	if len(v[i].Def.Name) != len(v[j].Def.Name) {
+		return len(v[i].Def.Name) < len(v[j].Def.Name)
+	}
+	if v[i].Def.Repo != v[j].Def.Repo {
+		return v[i].Def.Repo < v[j].Def.Repo
+	}
+	return v[i].Def.Path < v[j].Def.Path
+}
@@ -0,0 +1,156 @@
+package defsearch
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Match is the kind of match between a query and a def name, from best to
+// worst.
+type Match int
+
+const (
+	NoMatch Match = iota
+	Exact
+	ExactFold // exact, ignoring case
+	Prefix
+	CamelCase
+	Substring
+	Fuzzy
+)
+
+func (m Match) String() string {
+	switch m {
+	case Exact:
+		return "exact"
+	case ExactFold:
+		return "exact-fold"
+	case Prefix:
+		return "prefix"
+	case CamelCase:
+		return "camel-case"
+	case Substring:
+		return "substring"
+	case Fuzzy:
+		return "fuzzy"
+	}
+	return "none"
+}
+
+func (m Match) MarshalText() ([]byte, error) { return []byte(m.String()), nil }
+
+// match reports how query (and its lowercased form q) matches e's name, and
+// the base quality of that match. Qualities of successive kinds are spaced
+// far enough apart that score's bonuses can't reorder them.
+func match(query, q string, e *entry) (Match, float64) {
+	switch {
+	case query == e.def.Name:
+		return Exact, 120
+	case q == e.lower:
+		return ExactFold, 100
+	case strings.HasPrefix(e.lower, q):
+		return Prefix, 80
+	case matchHumps(q, e.humps):
+		return CamelCase, 60
+	case strings.Contains(e.lower, q):
+		return Substring, 40
+	}
+	if gaps, ok := subsequence(q, e.lower); ok {
+		quality := 20 - float64(gaps)
+		if quality < 1 {
+			quality = 1
+		}
+		return Fuzzy, quality
+	}
+	return NoMatch, 0
+}
+
+// humps splits a name into its lowercased camel-case (and snake_case) words,
+// e.g., "NewAPIRouter" -> ["new", "api", "router"].
+func humps(name string) []string {
+	var hs []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			hs = append(hs, strings.ToLower(string(cur)))
+			cur = cur[:0]
+		}
+	}
+	rs := []rune(name)
+	for i, r := range rs {
+		switch {
+		case r == '_' || r == '$' || r == '-':
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prevLower := unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1])
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			// "NewAPI" splits before "A"; "APIRouter" splits before "R".
+			if prevLower || (unicode.IsUpper(rs[i-1]) && nextLower) {
+				flush()
+			}
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return hs
+}
+
+// matchHumps reports whether q can be consumed by taking a non-empty prefix
+// of each of some (in-order, possibly non-consecutive) humps. The first hump
+// must always be used, so "ar" doesn't camel-case match NewAPIRouter.
+func matchHumps(q string, hs []string) bool {
+	if len(hs) == 0 || q == "" {
+		return false
+	}
+	return matchHumpsFrom(q, hs, true)
+}
+
+func matchHumpsFrom(q string, hs []string, anchored bool) bool {
+	if q == "" {
+		return true
+	}
+	for i, h := range hs {
+		if anchored && i > 0 {
+			break
+		}
+		n := commonPrefixLen(q, h)
+		for k := n; k > 0; k-- {
+			if matchHumpsFrom(q[k:], hs[i+1:], false) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// subsequence reports whether every rune of q appears in s in order, and the
+// number of gaps between matched runs.
+func subsequence(q, s string) (gaps int, ok bool) {
+	prevMatched := true
+	for _, r := range s {
+		if q == "" {
+			break
+		}
+		qr, size := utf8.DecodeRuneInString(q)
+		if r == qr {
+			if !prevMatched {
+				gaps++
+			}
+			q = q[size:]
+			prevMatched = true
+		} else {
+			prevMatched = false
+		}
+	}
+	return gaps, q == ""
+}
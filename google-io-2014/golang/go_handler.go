@@ -0,0 +1,629 @@
+package golang
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// GoAnalyzer analyzes Go packages with go/types. The pkg passed to Analyze is
+// a package directory.
+type GoAnalyzer struct{}
+
+// Syntax errors are returned as lang.Diagnostics, along with the defs and
+// refs in the rest of the package. Refs to other packages in the same
+// module are to source units named relative to the module's dir.
+func (_ GoAnalyzer) Analyze(dir string) ([]*lang.Def, []*lang.Ref, error) {
+	return analyzeDir("", dir, func(string) bool { return true })
+}
+
+// UnitGlobs returns the files of a package dir: its .go files, but not those
+// in its subdirs, which are other packages.
+func (_ GoAnalyzer) UnitGlobs() []string { return []string{"*.go"} }
+
+// AnalyzeUnit analyzes the package dir of u. If u lists Files, only those
+// files are analyzed, and if its "Tests" config is false, _test.go files
+// aren't.
+func (_ GoAnalyzer) AnalyzeUnit(root string, u *lang.SourceUnit) ([]*lang.Def, []*lang.Ref, error) {
+	dir := filepath.Join(root, filepath.FromSlash(u.Name))
+	var files map[string]bool
+	if len(u.Files) > 0 {
+		files = make(map[string]bool, len(u.Files))
+		for _, f := range u.Files {
+			files[filepath.Join(root, filepath.FromSlash(f))] = true
+		}
+	}
+	tests := u.ConfigBool("Tests", true)
+	return analyzeDir(root, dir, func(filename string) bool {
+		return (files == nil || files[filename]) && (tests || !strings.HasSuffix(filename, "_test.go"))
+	})
+}
+
+// analyzeDir analyzes the Go files in dir, a package dir in the repo rooted
+// at root, for which include returns true. If root is empty, it is the dir
+// of the package's module, if any, or else dir.
+func analyzeDir(root, dir string, include func(filename string) bool) ([]*lang.Def, []*lang.Ref, error) {
+	fset := token.NewFileSet()
+	pkgs, diags, err := parseDir(fset, dir, include)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root == "" {
+		root = dir
+	}
+	imp, err := newImporter(fset, root, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root == dir && imp.modDir != "" {
+		root = imp.modDir
+	}
+	unit, err := unitName(root, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Analyze each package in dir (e.g., "foo" and "foo_test") in a
+	// consistent order.
+	names := make([]string, 0, len(pkgs))
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var defs []*lang.Def
+	var refs []*lang.Ref
+	for _, name := range names {
+		a := newPkgAnalyzer(fset, imp, root, unit, dir, pkgs[name])
+		a.analyze()
+		defs = append(defs, a.defs...)
+		refs = append(refs, a.refs...)
+	}
+	if len(diags) > 0 {
+		return defs, refs, diags
+	}
+	return defs, refs, nil
+}
+
+// parseDir is like parser.ParseDir, but it keeps the partial ASTs of files
+// with syntax errors and returns all of the errors as diagnostics. It only
+// parses the files that include returns true for, and skips (also with a
+// diagnostic) those over the size limit for Go.
+func parseDir(fset *token.FileSet, dir string, include func(filename string) bool) (map[string]*ast.Package, lang.Diagnostics, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkgs := make(map[string]*ast.Package)
+	var diags lang.Diagnostics
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".go") {
+			continue
+		}
+		filename := filepath.Join(dir, fi.Name())
+		if !include(filename) {
+			continue
+		}
+		if err := lang.CheckFileSize("go", filename, fi.Size()); err != nil {
+			msg := err.Error()
+			if le, ok := err.(*lang.LimitError); ok {
+				msg = le.Message
+			}
+			diags = append(diags, &lang.Diagnostic{File: filename, Message: msg})
+			continue
+		}
+		f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments|parser.AllErrors)
+		if list, ok := err.(scanner.ErrorList); ok {
+			for _, e := range list {
+				diags = append(diags, &lang.Diagnostic{File: e.Pos.Filename, Start: e.Pos.Offset, End: e.Pos.Offset, Message: e.Msg})
+			}
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if f == nil || f.Name == nil || f.Name.Name == "_" {
+			continue // not even a package clause
+		}
+		pkg, ok := pkgs[f.Name.Name]
+		if !ok {
+			pkg = &ast.Package{Name: f.Name.Name, Files: make(map[string]*ast.File)}
+			pkgs[f.Name.Name] = pkg
+		}
+		pkg.Files[filename] = f
+	}
+	return pkgs, diags, nil
+}
+
+// Scan returns the directories under dir that contain Go files, skipping
+// those the go tool ignores (testdata and dirs starting with "." or "_").
+func (_ GoAnalyzer) Scan(dir string) ([]string, error) {
+	var pkgs []string
+	seen := make(map[string]bool)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := fi.Name()
+		if fi.IsDir() {
+			if path != dir && (name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(name) == ".go" {
+			rel, err := filepath.Rel(dir, filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+			if !seen[rel] {
+				seen[rel] = true
+				pkgs = append(pkgs, rel)
+			}
+		}
+		return nil
+	})
+	return pkgs, err
+}
+
+type pkgAnalyzer struct {
+	fset  *token.FileSet
+	files []*ast.File
+	pkg   *types.Package
+	info  *types.Info
+
+	imp  *importer
+	root string // the repo root, which source unit names are relative to
+	unit string // the source unit name of the package
+
+	defs []*lang.Def
+	refs []*lang.Ref
+
+	// inits is the number of init funcs seen so far. A package can have
+	// many, so all but the first get unique paths ("init$2", "init$3", ...).
+	inits int
+
+	// owners maps struct fields and interface methods to the path of the
+	// named type that declares them, for every package seen so far.
+	owners     map[types.Object]string
+	ownersSeen map[*types.Package]bool
+}
+
+func newPkgAnalyzer(fset *token.FileSet, imp *importer, root, unit, dir string, astPkg *ast.Package) *pkgAnalyzer {
+	a := &pkgAnalyzer{
+		fset: fset,
+		imp:  imp,
+		root: root,
+		unit: unit,
+		info: &types.Info{
+			Types: make(map[ast.Expr]types.TypeAndValue),
+			Defs:  make(map[*ast.Ident]types.Object),
+			Uses:  make(map[*ast.Ident]types.Object),
+		},
+		owners:     make(map[types.Object]string),
+		ownersSeen: make(map[*types.Package]bool),
+	}
+
+	filenames := make([]string, 0, len(astPkg.Files))
+	for filename := range astPkg.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		a.files = append(a.files, astPkg.Files[filename])
+	}
+
+	conf := types.Config{
+		Importer: imp,
+		// Keep going after type errors so that we get as many defs and refs
+		// as possible out of broken or partially buildable code.
+		Error: func(error) {},
+	}
+	// Check the package under its import path, so that its objects are the
+	// same as those that other packages in the module import.
+	pkgPath := imp.importPath(dir)
+	if strings.HasSuffix(astPkg.Name, "_test") {
+		pkgPath += "_test"
+	}
+	a.pkg, _ = conf.Check(pkgPath, fset, a.files, a.info)
+	return a
+}
+
+// unitName returns the source unit name of the package in dir, as Scan
+// returns it: the slash-separated path of dir relative to root.
+func unitName(root, dir string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// setDefPkg sets the DefPkg of ref, a ref to a def in the package with
+// import path pkgPath. It is left empty if that is the analyzed package (or
+// the package that an external test package tests). If the package is in
+// the repo (and not vendored), DefPkg is its source unit name and InRepo is
+// set; otherwise DefPkg is its import path.
+func (a *pkgAnalyzer) setDefPkg(ref *lang.Ref, pkgPath string) {
+	if a.pkg != nil && pkgPath == a.pkg.Path() {
+		return
+	}
+	if dir, ok := a.imp.dir(pkgPath); ok {
+		if unit, err := unitName(a.root, dir); err == nil && !isOutsideOrVendored(unit) {
+			if unit != a.unit {
+				ref.DefPkg, ref.InRepo = unit, true
+			}
+			return
+		}
+	}
+	ref.DefPkg = pkgPath
+}
+
+// isOutsideOrVendored reports whether the unit (a path relative to the repo
+// root) is outside of the repo or in a vendor dir.
+func isOutsideOrVendored(unit string) bool {
+	return unit == ".." || strings.HasPrefix(unit, "../") || unit == "vendor" || strings.HasPrefix(unit, "vendor/") || strings.Contains(unit, "/vendor/") || strings.HasSuffix(unit, "/vendor")
+}
+
+func (a *pkgAnalyzer) analyze() {
+	for _, f := range a.files {
+		a.fileDefs(f)
+	}
+	for _, f := range a.files {
+		a.fileRefs(f)
+	}
+	a.implRefs()
+}
+
+// fileDefs records the package-level defs, methods, struct fields and
+// interface methods declared in f.
+func (a *pkgAnalyzer) fileDefs(f *ast.File) {
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			kind := "func"
+			if decl.Recv != nil {
+				kind = "method"
+			}
+			a.addDef(decl.Name, kind, decl)
+
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if a.addDef(spec.Name, "type", spec) != nil {
+						a.typeMemberDefs(spec.Type)
+					}
+				case *ast.ValueSpec:
+					kind := "var"
+					if decl.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range spec.Names {
+						a.addDef(name, kind, spec)
+					}
+				}
+			}
+		}
+	}
+}
+
+// typeMemberDefs records the fields of a struct type and the methods of an
+// interface type.
+func (a *pkgAnalyzer) typeMemberDefs(typ ast.Expr) {
+	switch typ := typ.(type) {
+	case *ast.StructType:
+		for _, field := range typ.Fields.List {
+			if len(field.Names) == 0 {
+				// An embedded field is named after its type.
+				if name := embeddedName(field.Type); name != nil {
+					a.addDef(name, "field", field)
+				}
+			}
+			for _, name := range field.Names {
+				a.addDef(name, "field", field)
+			}
+		}
+	case *ast.InterfaceType:
+		for _, m := range typ.Methods.List {
+			for _, name := range m.Names {
+				a.addDef(name, "method", m)
+			}
+		}
+	}
+}
+
+func (a *pkgAnalyzer) addDef(name *ast.Ident, kind string, node ast.Node) *lang.Def {
+	obj := a.info.Defs[name]
+	if obj == nil || name.Name == "_" {
+		return nil
+	}
+	path, ok := a.objPath(obj)
+	if !ok {
+		return nil
+	}
+	if path == "init" && kind == "func" {
+		if a.inits++; a.inits > 1 {
+			path += "$" + strconv.Itoa(a.inits)
+		}
+	}
+	start, end := a.fset.Position(node.Pos()), a.fset.Position(node.End())
+	def := &lang.Def{
+		Name:     name.Name,
+		Type:     types.TypeString(obj.Type(), types.RelativeTo(a.pkg)),
+		Path:     path,
+		Kind:     kind,
+		Callable: kind == "func" || kind == "method",
+		Exported: obj.Exported(),
+		Scope:    lang.ScopePackage,
+		File:     start.Filename,
+		Start:    start.Offset,
+		End:      end.Offset,
+	}
+	if def.Exported {
+		def.Scope = lang.ScopeExported
+	}
+	a.defs = append(a.defs, def)
+
+	nameStart, nameEnd := a.fset.Position(name.Pos()), a.fset.Position(name.End())
+	a.refs = append(a.refs, &lang.Ref{DefPath: path, File: nameStart.Filename, Start: nameStart.Offset, End: nameEnd.Offset, Enclosing: path, Kind: lang.RefDecl})
+	return def
+}
+
+// fileRefs records references in f to package-level objects, methods and
+// fields (in this package or imported packages), and to the packages it
+// imports.
+func (a *pkgAnalyzer) fileRefs(f *ast.File) {
+	var fileDefs []*lang.Def
+	filename := a.fset.Position(f.Pos()).Filename
+	for _, def := range a.defs {
+		if def.File == filename {
+			fileDefs = append(fileDefs, def)
+		}
+	}
+
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		start, end := a.fset.Position(imp.Path.Pos()), a.fset.Position(imp.Path.End())
+		ref := &lang.Ref{File: start.Filename, Start: start.Offset, End: end.Offset, Kind: lang.RefImport}
+		a.setDefPkg(ref, path)
+		if ref.DefPkg == "" {
+			continue // an external test package's import of the package it tests
+		}
+		a.refs = append(a.refs, ref)
+	}
+
+	var stack []ast.Node // from f down to the current node
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		if lit, ok := n.(*ast.CompositeLit); ok {
+			a.unkeyedFieldRefs(lit, fileDefs)
+		}
+		ident, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := a.info.Uses[ident]
+		if obj == nil || obj.Pkg() == nil {
+			return true // universe scope (e.g., "int", "nil")
+		}
+		path, ok := a.objPath(obj)
+		if !ok {
+			return true
+		}
+		ref := &lang.Ref{DefPath: path}
+		a.setDefPkg(ref, obj.Pkg().Path())
+		start, end := a.fset.Position(ident.Pos()), a.fset.Position(ident.End())
+		ref.File, ref.Start, ref.End = start.Filename, start.Offset, end.Offset
+		ref.Enclosing = enclosing(fileDefs, ref.Start)
+		ref.Kind = refKind(obj, stack)
+		a.refs = append(a.refs, ref)
+		return true
+	})
+}
+
+// implRefs records, for each method of a type in the package that
+// implements an interface in the package, a ref from the method's name to the
+// interface method it implements. The method is called through the interface
+// even if nothing calls it directly.
+func (a *pkgAnalyzer) implRefs() {
+	if a.pkg == nil {
+		return
+	}
+	scope := a.pkg.Scope()
+	var ifaces, concrete []*types.Named
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok || named.TypeParams().Len() > 0 {
+			continue // Implements is unspecified for uninstantiated generic types
+		}
+		if iface, isIface := named.Underlying().(*types.Interface); isIface {
+			if iface.NumMethods() > 0 {
+				ifaces = append(ifaces, named)
+			}
+		} else {
+			concrete = append(concrete, named)
+		}
+	}
+
+	for _, t := range concrete {
+		ptr := types.NewPointer(t)
+		for _, i := range ifaces {
+			iface := i.Underlying().(*types.Interface)
+			if !types.Implements(ptr, iface) {
+				continue
+			}
+			for k := 0; k < iface.NumMethods(); k++ {
+				m := iface.Method(k)
+				obj, _, _ := types.LookupFieldOrMethod(ptr, false, m.Pkg(), m.Name())
+				impl, ok := obj.(*types.Func)
+				if !ok || impl.Pkg() != a.pkg {
+					continue
+				}
+				enclosing, ok := a.objPath(impl)
+				if !ok {
+					continue
+				}
+				path, ok := a.objPath(m)
+				if !ok {
+					continue
+				}
+				ref := &lang.Ref{DefPath: path, Enclosing: enclosing, Kind: lang.RefImpl}
+				a.setDefPkg(ref, m.Pkg().Path())
+				start := a.fset.Position(impl.Pos())
+				ref.File, ref.Start, ref.End = start.Filename, start.Offset, start.Offset+len(impl.Name())
+				a.refs = append(a.refs, ref)
+			}
+		}
+	}
+}
+
+// unkeyedFieldRefs records the fields set by the elements of a struct
+// literal without field names, as in T{x, y}, as writes at the elements.
+func (a *pkgAnalyzer) unkeyedFieldRefs(lit *ast.CompositeLit, fileDefs []*lang.Def) {
+	if len(lit.Elts) == 0 {
+		return
+	}
+	if _, keyed := lit.Elts[0].(*ast.KeyValueExpr); keyed {
+		return
+	}
+	typ := a.info.Types[lit].Type
+	if typ == nil {
+		return
+	}
+	if ptr, ok := typ.Underlying().(*types.Pointer); ok {
+		typ = ptr.Elem() // &T{...} elided in a []*T literal
+	}
+	st, ok := typ.Underlying().(*types.Struct)
+	if !ok {
+		return
+	}
+	for i, elt := range lit.Elts {
+		if i >= st.NumFields() {
+			break
+		}
+		field := st.Field(i)
+		path, ok := a.objPath(field)
+		if !ok {
+			continue
+		}
+		ref := &lang.Ref{DefPath: path, Kind: lang.RefWrite}
+		a.setDefPkg(ref, field.Pkg().Path())
+		start, end := a.fset.Position(elt.Pos()), a.fset.Position(elt.End())
+		ref.File, ref.Start, ref.End = start.Filename, start.Offset, end.Offset
+		ref.Enclosing = enclosing(fileDefs, ref.Start)
+		a.refs = append(a.refs, ref)
+	}
+}
+
+// embeddedName returns the identifier that names the embedded field of type
+// typ (T, *T, pkg.T or T[X]), or nil if there is none.
+func embeddedName(typ ast.Expr) *ast.Ident {
+	for {
+		switch t := typ.(type) {
+		case *ast.Ident:
+			return t
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.SelectorExpr:
+			return t.Sel
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.ParenExpr:
+			typ = t.X
+		default:
+			return nil
+		}
+	}
+}
+
+// refKind returns how the identifier at the top of stack (the nodes from the
+// file down to it) uses obj.
+func refKind(obj types.Object, stack []ast.Node) string {
+	if _, ok := obj.(*types.TypeName); ok {
+		return lang.RefType
+	}
+	var expr ast.Node = stack[len(stack)-1]
+	i := len(stack) - 2
+	if sel, ok := stack[i].(*ast.SelectorExpr); ok && sel.Sel == expr {
+		expr = sel
+		i--
+	}
+	for ; i >= 0; i-- {
+		paren, ok := stack[i].(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren
+	}
+	if i < 0 {
+		return lang.RefRead
+	}
+	switch parent := stack[i].(type) {
+	case *ast.CallExpr:
+		if parent.Fun == expr {
+			return lang.RefCall
+		}
+	case *ast.AssignStmt:
+		for _, lhs := range parent.Lhs {
+			if lhs == expr {
+				return lang.RefWrite
+			}
+		}
+	case *ast.IncDecStmt:
+		return lang.RefWrite
+	case *ast.RangeStmt:
+		if parent.Key == expr || parent.Value == expr {
+			return lang.RefWrite
+		}
+	case *ast.KeyValueExpr:
+		// A field set in a composite literal, as in T{Field: x}.
+		if v, ok := obj.(*types.Var); ok && v.IsField() && parent.Key == expr {
+			return lang.RefWrite
+		}
+	}
+	return lang.RefRead
+}
+
+// enclosing returns the path of the innermost def whose range contains
+// offset, or "" if there is none.
+func enclosing(defs []*lang.Def, offset int) string {
+	var inner *lang.Def
+	for _, def := range defs {
+		if def.Start <= offset && offset < def.End && (inner == nil || def.End-def.Start < inner.End-inner.Start) {
+			inner = def
+		}
+	}
+	if inner == nil {
+		return ""
+	}
+	return inner.Path
+}
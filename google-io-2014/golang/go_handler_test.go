@@ -0,0 +1,9 @@
+package golang
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang/langtest"
+)
+
+func TestGoAnalyzer(t *testing.T) { langtest.Run(t, "go", "testdata") }
@@ -0,0 +1,190 @@
+package golang
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// An importer imports packages for the type checker from source, finding
+// them the way the go tool would if it were run in the package dir being
+// analyzed (not in the process's current dir). Packages in the analyzed
+// package's module are found in the module's dir.
+type importer struct {
+	fset *token.FileSet
+	ctxt build.Context
+
+	// modPath and modDir are the path and dir of the module (or GOPATH
+	// package tree) that the analyzed package is in, if it is in one.
+	modPath, modDir string
+
+	pkgs map[string]*types.Package // by import path; nil while being checked
+	dirs map[string]string         // dirs of the packages in pkgs
+}
+
+// newImporter returns an importer for the package in dir, in the repo
+// rooted at root.
+func newImporter(fset *token.FileSet, root, dir string) (*importer, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, err
+	}
+	imp := &importer{
+		fset: fset,
+		ctxt: build.Default,
+		pkgs: make(map[string]*types.Package),
+		dirs: make(map[string]string),
+	}
+	imp.ctxt.Dir = dir
+	// Type-check the pure Go versions of packages that use cgo.
+	imp.ctxt.CgoEnabled = false
+	imp.modPath, imp.modDir = findModule(&imp.ctxt, root, dir)
+	return imp, nil
+}
+
+// findModule returns the path and dir of the module that contains dir, from
+// the nearest go.mod file at or above dir. If there is none but root (the
+// repo root) is in a GOPATH, it returns the import path of root and root.
+func findModule(ctxt *build.Context, root, dir string) (modPath, modDir string) {
+	for d := dir; ; {
+		if p, err := readModulePath(filepath.Join(d, "go.mod")); err == nil {
+			return p, d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	if bp, err := ctxt.ImportDir(root, build.FindOnly); err == nil && !build.IsLocalImport(bp.ImportPath) {
+		return bp.ImportPath, root
+	}
+	return "", ""
+}
+
+// readModulePath returns the module path in the go.mod file gomod.
+func readModulePath(gomod string) (string, error) {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			if p, err := strconv.Unquote(fields[1]); err == nil {
+				return p, nil
+			}
+			return fields[1], nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s: no module directive", gomod)
+}
+
+// importPath returns the import path of the package in dir, which must be
+// in the importer's module. If there is no module, it is dir itself.
+func (imp *importer) importPath(dir string) string {
+	if imp.modPath == "" {
+		return filepath.ToSlash(dir)
+	}
+	rel, err := filepath.Rel(imp.modDir, dir)
+	if err != nil || rel == "." {
+		return imp.modPath
+	}
+	return path.Join(imp.modPath, filepath.ToSlash(rel))
+}
+
+// dir returns the dir of the package with import path pkgPath, if the
+// importer has imported it or it is in the module.
+func (imp *importer) dir(pkgPath string) (string, bool) {
+	if dir, ok := imp.dirs[pkgPath]; ok {
+		return dir, true
+	}
+	if imp.modPath == "" {
+		return "", false
+	}
+	if pkgPath == imp.modPath {
+		return imp.modDir, true
+	}
+	if rel := strings.TrimPrefix(pkgPath, imp.modPath+"/"); rel != pkgPath {
+		return filepath.Join(imp.modDir, filepath.FromSlash(rel)), true
+	}
+	return "", false
+}
+
+func (imp *importer) Import(path string) (*types.Package, error) {
+	return imp.ImportFrom(path, imp.ctxt.Dir, 0)
+}
+
+func (imp *importer) ImportFrom(pkgPath, srcDir string, _ types.ImportMode) (*types.Package, error) {
+	if pkgPath == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := imp.pkgs[pkgPath]; ok {
+		if pkg == nil {
+			return nil, fmt.Errorf("import cycle through %s", pkgPath)
+		}
+		return pkg, nil
+	}
+
+	// Find packages in the module without running the go tool.
+	var bp *build.Package
+	var err error
+	if dir, ok := imp.dir(pkgPath); ok {
+		bp, err = imp.ctxt.ImportDir(dir, 0)
+		bp.ImportPath = pkgPath
+	} else {
+		if !filepath.IsAbs(srcDir) {
+			// srcDir is the dir of a file name, which is relative to the
+			// current dir, but ctxt.Dir is set, so it must be absolute.
+			if srcDir, err = filepath.Abs(srcDir); err != nil {
+				return nil, err
+			}
+		}
+		bp, err = imp.ctxt.Import(pkgPath, srcDir, 0)
+	}
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok || bp == nil {
+			return nil, err
+		}
+		// Otherwise, type-check the files that could be read.
+	}
+	if pkg, ok := imp.pkgs[bp.ImportPath]; ok && pkg != nil {
+		return pkg, nil // a vendored or relative path for a package already imported
+	}
+
+	imp.pkgs[bp.ImportPath] = nil
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		f, _ := parser.ParseFile(imp.fset, filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if f != nil {
+			files = append(files, f)
+		}
+	}
+	conf := types.Config{
+		Importer: imp,
+		Error:    func(error) {}, // as for the analyzed package, keep going after type errors
+	}
+	pkg, _ := conf.Check(bp.ImportPath, imp.fset, files, nil)
+	imp.pkgs[bp.ImportPath], imp.dirs[bp.ImportPath] = pkg, bp.Dir
+	if pkgPath != bp.ImportPath {
+		imp.pkgs[pkgPath], imp.dirs[pkgPath] = pkg, bp.Dir
+	}
+	return pkg, nil
+}
@@ -0,0 +1,77 @@
+package golang
+
+import "go/types"
+
+// objPath returns the def path of a package-level object, method, struct field
+// or interface method: "Name" for package-level objects and "Type/Name" for
+// members of the named type Type. Local objects have no path.
+func (a *pkgAnalyzer) objPath(obj types.Object) (string, bool) {
+	if obj.Pkg() == nil {
+		return "", false
+	}
+	if obj.Parent() == obj.Pkg().Scope() {
+		return obj.Name(), true
+	}
+
+	switch obj := obj.(type) {
+	case *types.Func:
+		sig, ok := obj.Type().(*types.Signature)
+		if !ok || sig.Recv() == nil {
+			return "", false
+		}
+		if named := namedType(sig.Recv().Type()); named != nil {
+			if _, isIface := named.Underlying().(*types.Interface); !isIface {
+				return named.Obj().Name() + "/" + obj.Name(), true
+			}
+		}
+	case *types.Var:
+		if !obj.IsField() {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	// Struct fields and interface methods don't know which named type
+	// declares them, so look them up.
+	a.indexOwners(obj.Pkg())
+	if owner, ok := a.owners[obj]; ok {
+		return owner + "/" + obj.Name(), true
+	}
+	return "", false
+}
+
+func (a *pkgAnalyzer) indexOwners(pkg *types.Package) {
+	if a.ownersSeen[pkg] {
+		return
+	}
+	a.ownersSeen[pkg] = true
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		switch u := tn.Type().Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < u.NumFields(); i++ {
+				a.owners[u.Field(i)] = name
+			}
+		case *types.Interface:
+			for i := 0; i < u.NumExplicitMethods(); i++ {
+				a.owners[u.ExplicitMethod(i)] = name
+			}
+		}
+	}
+}
+
+// namedType returns the named type of t or *t, if any.
+func namedType(t types.Type) *types.Named {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return named.Origin()
+	}
+	return nil
+}
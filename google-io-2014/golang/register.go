@@ -0,0 +1,22 @@
+package golang
+
+import (
+	"time"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+func init() {
+	lang.Register("go", &GoAnalyzer{})
+
+	// Type-checking a package means type-checking its dependencies from
+	// source, too, which takes longer and more memory than other analyzers.
+	l := lang.DefaultLimits
+	l.Timeout, l.MaxMemory = 10*time.Minute, 8<<30
+	lang.RegisterLimits("go", l)
+}
+
+var _ lang.Analyzer = &GoAnalyzer{}
+var _ lang.Scanner = &GoAnalyzer{}
+var _ lang.UnitAnalyzer = &GoAnalyzer{}
+var _ lang.UnitGlobber = &GoAnalyzer{}
@@ -0,0 +1,34 @@
+// Package shapes is a fixture for the Go analyzer.
+package shapes
+
+import "strings"
+
+// A Shape has an area.
+type Shape interface {
+	Area() float64
+}
+
+type named struct {
+	Name string
+}
+
+// Rect is a rectangle.
+type Rect struct {
+	named
+	W, H float64
+}
+
+func (r *Rect) Area() float64 { return r.W * r.H }
+
+func (r *Rect) String() string { return strings.ToUpper(r.Name) }
+
+// NewSquare returns a square with sides of length n.
+func NewSquare(n float64) *Rect {
+	return &Rect{named{"square"}, n, n}
+}
+
+func init() {}
+
+func init() {}
+
+var total = NewSquare(2).Area()
@@ -0,0 +1,10 @@
+// Package greet greets.
+package greet
+
+// A Greeter greets people.
+type Greeter struct {
+	Greeting string
+}
+
+// Greet returns a greeting for name.
+func (g Greeter) Greet(name string) string { return g.Greeting + ", " + name }
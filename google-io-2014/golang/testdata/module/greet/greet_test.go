@@ -0,0 +1,13 @@
+package greet_test
+
+import (
+	"testing"
+
+	"example.com/hello/greet"
+)
+
+func TestGreet(t *testing.T) {
+	if got := (greet.Greeter{Greeting: "hi"}).Greet("x"); got != "hi, x" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,13 @@
+// Command hello is a fixture for refs between the packages of a module.
+package main
+
+import (
+	"fmt"
+
+	"example.com/hello/greet"
+)
+
+func main() {
+	g := greet.Greeter{Greeting: "hello"}
+	fmt.Println(g.Greet("world"))
+}
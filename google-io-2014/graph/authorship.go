@@ -0,0 +1,17 @@
+package graph
+
+import "time"
+
+// Authorship records who wrote the lines of a def, according to VCS blame.
+type Authorship struct {
+	Authors      []*DefAuthor // most bytes first
+	LastCommitID string       // most recent commit that changed the def
+	LastModified time.Time    // date of LastCommitID
+}
+
+// A DefAuthor is a person who wrote some of a def.
+type DefAuthor struct {
+	Name  string
+	Email string
+	Bytes int // number of bytes of the def last changed by this author
+}
@@ -0,0 +1,97 @@
+// Package graph defines the code graph: the defs and refs that analyzers
+// find in source units, which stores keep and API clients exchange. Its types
+// have the same shape as srclib's, so that every def is identified by a full
+// DefKey (repo, commit, unit type, unit and path).
+package graph
+
+import "encoding/json"
+
+// A DefKey identifies a def.
+type DefKey struct {
+	Repo     string
+	CommitID string `json:",omitempty"`
+
+	// UnitType is the type of source unit that defines the def, which is the
+	// name its language's analyzer is registered under (e.g., "go" or "js").
+	UnitType string
+
+	Unit string // source unit (e.g., Go package or JS file) that defines it
+	Path string // unique identifier for the def in its unit (e.g., "Router/ServeHTTP")
+}
+
+// WithoutCommit returns k with an empty CommitID, which is how refs refer to
+// the def (see Ref.DefKey), so that defs can be matched with refs and with
+// the same defs at other commits.
+func (k DefKey) WithoutCommit() DefKey {
+	k.CommitID = ""
+	return k
+}
+
+// A UnitKey identifies a source unit.
+type UnitKey struct {
+	UnitType string
+	Unit     string
+}
+
+type Def struct {
+	DefKey
+
+	Kind     string // kind of definition, such as "func", "type" or "var"
+	Name     string
+	Type     string
+	Callable bool
+	Exported bool
+	Scope    string // where the def is visible: ScopeLocal, ScopeFile, ScopePackage or ScopeExported
+
+	File             string
+	DefStart, DefEnd int // byte offsets of the whole definition in File
+
+	Data json.RawMessage `json:",omitempty"` // extra language-specific info about this definition
+
+	Authorship *Authorship `json:",omitempty"` // from VCS blame, if computed
+}
+
+type Ref struct {
+	// The def that this ref points to. DefRepo is empty if it's unknown (for
+	// refs to other packages).
+	DefRepo     string
+	DefUnitType string
+	DefUnit     string
+	DefPath     string
+
+	Repo     string
+	CommitID string `json:",omitempty"`
+	UnitType string
+	Unit     string
+
+	File       string
+	Start, End int
+
+	Enclosing string // path of the def (in Repo and Unit) whose body contains this ref
+	Kind      string // how the ref uses the def: RefCall, RefRead, etc.
+}
+
+// Def scopes, from narrowest to widest.
+const (
+	ScopeLocal    = "local"    // inside a function
+	ScopeFile     = "file"     // anywhere in its file (e.g., an unexported JS module-level def)
+	ScopePackage  = "package"  // anywhere in its package (e.g., an unexported Go def)
+	ScopeExported = "exported" // by other packages or modules
+)
+
+// Ref kinds.
+const (
+	RefCall   = "call"   // calls (or instantiates) the def
+	RefRead   = "read"   // reads its value
+	RefWrite  = "write"  // assigns to it
+	RefImport = "import" // imports it (DefPath is empty if the ref imports the whole package)
+	RefType   = "type"   // uses it as a type
+	RefDecl   = "decl"   // the name in its own declaration
+	RefImpl   = "impl"   // implements it (an interface method), from the implementing method's name
+)
+
+// DefKey returns the key of the def that r points to (with an empty
+// CommitID, since refs don't say which commit of the def they refer to).
+func (r *Ref) DefKey() DefKey {
+	return DefKey{Repo: r.DefRepo, UnitType: r.DefUnitType, Unit: r.DefUnit, Path: r.DefPath}
+}
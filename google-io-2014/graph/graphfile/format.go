@@ -0,0 +1,68 @@
+// Package graphfile reads and writes a compact binary file format for the
+// code graph of a repo at a commit, which readers can look up defs and refs
+// in (via memory-mapping) without decoding the whole file.
+//
+// A file consists of a header followed by sections:
+//
+//	header    magic, version, the offset and length of each section, and the
+//	          string IDs of the graph's repo and commit ID
+//	strings   the string table: every string in the graph, in sorted order,
+//	          so that comparing string IDs compares the strings
+//	units     for each source unit (sorted by unit type and name), its type
+//	          and name, and where its def and ref records are
+//	records   the def and ref records of each unit: string IDs and byte
+//	          offsets, as varints
+//	indexes   sorted fixed-size entries that point to records, to look up
+//	          refs by file, refs by the def they point to, defs by name and
+//	          defs by key
+//
+// Fixed-size integers are little-endian. Offsets into a section are 32 bits,
+// so a section can be at most 4GB.
+package graphfile
+
+import "encoding/binary"
+
+const (
+	magic   = "srcgraph"
+	version = 1
+)
+
+// Sections, in the order they appear in the file (and in the header).
+const (
+	secStrings = iota
+	secUnits
+	secRecords
+	secRefsByFile
+	secRefsByTarget
+	secDefsByName
+	secDefsByKey
+	numSections
+)
+
+// headerSize is the size of the header: the magic, the version, the offset
+// and length (uint64s) of each section, and the repo and commit ID string
+// IDs.
+const headerSize = len(magic) + 4 + numSections*16 + 4 + 4
+
+// The sizes of the fixed-size entries in sections.
+const (
+	unitSize         = 6 * 4 // type, name, defs offset, num defs, refs offset, num refs
+	refsByFileSize   = 4 * 4 // file, start, unit, record offset
+	refsByTargetSize = 6 * 4 // def repo, def unit type, def unit, def path, unit, record offset
+	defsByNameSize   = 3 * 4 // name, unit, record offset
+	defsByKeySize    = 3 * 4 // unit, path, record offset
+)
+
+// The number of fields (uvarints) in def and ref records.
+const (
+	defFields = 11
+	refFields = 9
+)
+
+// Def flags.
+const (
+	flagCallable = 1 << iota
+	flagExported
+)
+
+var le = binary.LittleEndian
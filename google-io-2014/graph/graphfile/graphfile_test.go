@@ -0,0 +1,227 @@
+package graphfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+const (
+	testRepo   = "github.com/a/b"
+	testCommit = "c0ffee"
+)
+
+// testGraph returns a graph with defs and refs in a Go and a JS unit,
+// including a ref to an unknown def and a ref to a def in another repo.
+func testGraph() *graph.Graph {
+	def := func(unitType, unit, path, kind, file string, start, end int) *graph.Def {
+		return &graph.Def{
+			DefKey:   graph.DefKey{Repo: testRepo, CommitID: testCommit, UnitType: unitType, Unit: unit, Path: path},
+			Kind:     kind,
+			Name:     path[strings.LastIndex(path, "/")+1:],
+			File:     file,
+			DefStart: start,
+			DefEnd:   end,
+			Scope:    graph.ScopePackage,
+		}
+	}
+	ref := func(defRepo, defUnitType, defUnit, defPath, unitType, unit, file string, start, end int, kind string) *graph.Ref {
+		return &graph.Ref{
+			DefRepo: defRepo, DefUnitType: defUnitType, DefUnit: defUnit, DefPath: defPath,
+			Repo: testRepo, CommitID: testCommit, UnitType: unitType, Unit: unit,
+			File: file, Start: start, End: end, Kind: kind,
+		}
+	}
+
+	serve := def("go", "pkg", "Router/ServeHTTP", "method", "pkg/router.go", 100, 180)
+	serve.Callable, serve.Exported, serve.Scope = true, true, graph.ScopeExported
+	serve.Type = "func(http.ResponseWriter, *http.Request)"
+	serve.Data = json.RawMessage(`{"Recv":"*Router"}`)
+	serve.Authorship = &graph.Authorship{
+		Authors:      []*graph.DefAuthor{{Name: "Alice", Email: "alice@example.com", Bytes: 80}},
+		LastCommitID: "abc123",
+		LastModified: time.Date(2014, 6, 25, 10, 0, 0, 0, time.UTC),
+	}
+	router := def("go", "pkg", "Router", "type", "pkg/router.go", 10, 60)
+	router.Exported, router.Scope = true, graph.ScopeExported
+	jsServe := def("js", "web/app.js", "serve", "function", "web/app.js", 0, 40)
+	jsServe.Callable = true
+
+	return &graph.Graph{
+		Repo:     testRepo,
+		CommitID: testCommit,
+		Defs:     []*graph.Def{serve, router, jsServe},
+		Refs: []*graph.Ref{
+			ref(testRepo, "go", "pkg", "Router", "go", "pkg", "pkg/router.go", 115, 121, graph.RefType),
+			ref(testRepo, "go", "pkg", "Router/ServeHTTP", "go", "pkg", "pkg/router.go", 105, 114, graph.RefDecl),
+			ref("", "go", "net/http", "Request", "go", "pkg", "pkg/router.go", 160, 167, graph.RefType),
+			ref("github.com/c/d", "go", "d", "Handle", "go", "pkg", "pkg/main.go", 20, 26, graph.RefCall),
+			ref(testRepo, "js", "web/app.js", "serve", "js", "web/app.js", "web/app.js", 50, 55, graph.RefCall),
+		},
+	}
+}
+
+func writeTestGraph(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := Write(&buf, testGraph()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	g := testGraph()
+	r, err := NewReader(writeTestGraph(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Repo() != testRepo || r.CommitID() != testCommit {
+		t.Errorf("got repo %q commit %q, want %q %q", r.Repo(), r.CommitID(), testRepo, testCommit)
+	}
+	if want := []graph.UnitKey{{UnitType: "go", Unit: "pkg"}, {UnitType: "js", Unit: "web/app.js"}}; !reflect.DeepEqual(r.Units(), want) {
+		t.Errorf("got units %+v, want %+v", r.Units(), want)
+	}
+
+	serve, router, jsServe := g.Defs[0], g.Defs[1], g.Defs[2]
+	for _, want := range g.Defs {
+		got, err := r.Def(want.DefKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Def(%+v): got %+v, want %+v", want.DefKey, got, want)
+		}
+	}
+	if d, err := r.Def(graph.DefKey{UnitType: "go", Unit: "pkg", Path: "Missing"}); d != nil || err != nil {
+		t.Errorf("Def of missing path: got %+v, %v, want nil", d, err)
+	}
+	if d, err := r.Def(graph.DefKey{UnitType: "go", Unit: "web/app.js", Path: "serve"}); d != nil || err != nil {
+		t.Errorf("Def in missing unit: got %+v, %v, want nil", d, err)
+	}
+
+	checkDefs := func(what string, got []*graph.Def, err error, want ...*graph.Def) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %s", what, err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d defs, want %d", what, len(got), len(want))
+			return
+		}
+		for i := range want {
+			if !reflect.DeepEqual(got[i], want[i]) {
+				t.Errorf("%s: def %d: got %+v, want %+v", what, i, got[i], want[i])
+			}
+		}
+	}
+	defs, err := r.UnitDefs(graph.UnitKey{UnitType: "go", Unit: "pkg"})
+	checkDefs("UnitDefs(go pkg)", defs, err, router, serve)
+	defs, err = r.UnitDefs(graph.UnitKey{UnitType: "go", Unit: "missing"})
+	checkDefs("UnitDefs(go missing)", defs, err)
+	defs, err = r.DefsByName("serve")
+	checkDefs("DefsByName(serve)", defs, err, jsServe)
+	defs, err = r.DefsByName("ServeHTTP")
+	checkDefs("DefsByName(ServeHTTP)", defs, err, serve)
+	defs, err = r.DefsByName("missing")
+	checkDefs("DefsByName(missing)", defs, err)
+
+	checkRefs := func(what string, got []*graph.Ref, err error, want ...*graph.Ref) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %s", what, err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d refs, want %d", what, len(got), len(want))
+			return
+		}
+		for i := range want {
+			if *got[i] != *want[i] {
+				t.Errorf("%s: ref %d: got %+v, want %+v", what, i, got[i], want[i])
+			}
+		}
+	}
+	refs, err := r.RefsByFile("pkg/router.go")
+	checkRefs("RefsByFile(pkg/router.go)", refs, err, g.Refs[1], g.Refs[0], g.Refs[2])
+	refs, err = r.RefsByFile("missing.go")
+	checkRefs("RefsByFile(missing.go)", refs, err)
+	refs, err = r.RefsTo(router.DefKey)
+	checkRefs("RefsTo(Router)", refs, err, g.Refs[0])
+	refs, err = r.RefsTo(graph.DefKey{UnitType: "go", Unit: "net/http", Path: "Request"})
+	checkRefs("RefsTo(unknown repo's Request)", refs, err, g.Refs[2])
+	refs, err = r.RefsTo(graph.DefKey{Repo: "github.com/c/d", UnitType: "go", Unit: "d", Path: "Handle"})
+	checkRefs("RefsTo(other repo's Handle)", refs, err, g.Refs[3])
+	refs, err = r.UnitRefs(graph.UnitKey{UnitType: "js", Unit: "web/app.js"})
+	checkRefs("UnitRefs(js web/app.js)", refs, err, g.Refs[4])
+}
+
+func TestNewReader_truncated(t *testing.T) {
+	b := writeTestGraph(t)
+	for n := 0; n < len(b); n++ {
+		if _, err := NewReader(b[:n]); err == nil {
+			t.Errorf("NewReader of the first %d of %d bytes: got no error", n, len(b))
+		}
+	}
+}
+
+func TestNewReader_corrupt(t *testing.T) {
+	b := writeTestGraph(t)
+	corrupt := func(f func(b []byte)) []byte {
+		c := append([]byte(nil), b...)
+		f(c)
+		return c
+	}
+	secOffset := func(sec int) uint64 { return le.Uint64(b[len(magic)+4+sec*16:]) }
+	tests := map[string][]byte{
+		"magic":   corrupt(func(c []byte) { c[0] = 'x' }),
+		"version": corrupt(func(c []byte) { le.PutUint32(c[len(magic):], version+1) }),
+		"section past end": corrupt(func(c []byte) {
+			le.PutUint64(c[len(magic)+4+secRecords*16:], uint64(len(b)))
+		}),
+		"section length overflows": corrupt(func(c []byte) {
+			le.PutUint64(c[len(magic)+4+secRecords*16+8:], ^uint64(0))
+		}),
+		"index count": corrupt(func(c []byte) {
+			off := secOffset(secDefsByName)
+			le.PutUint32(c[off:], le.Uint32(c[off:])+1)
+		}),
+		"string count": corrupt(func(c []byte) {
+			off := secOffset(secStrings)
+			le.PutUint32(c[off:], 1<<30)
+		}),
+	}
+	for name, c := range tests {
+		if _, err := NewReader(c); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+// TestReader_corruptRecords checks that lookups in a file whose records
+// and offsets are garbage return errors (or wrong results) instead of
+// panicking.
+func TestReader_corruptRecords(t *testing.T) {
+	b := writeTestGraph(t)
+	for i := headerSize; i < len(b); i++ {
+		c := append([]byte(nil), b...)
+		c[i] ^= 0xff
+		r, err := NewReader(c)
+		if err != nil {
+			continue
+		}
+		for _, u := range r.Units() {
+			r.UnitDefs(u)
+			r.UnitRefs(u)
+		}
+		for _, d := range testGraph().Defs {
+			r.Def(d.DefKey)
+			r.DefsByName(d.Name)
+			r.RefsTo(d.DefKey)
+			r.RefsByFile(d.File)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package graphfile
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// mmapFile reads f into memory, on systems where it can't be mapped.
+func mmapFile(f *os.File) ([]byte, func() error, error) {
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, func() error { return nil }, nil
+}
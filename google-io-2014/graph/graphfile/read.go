@@ -0,0 +1,378 @@
+package graphfile
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+var errCorrupt = errors.New("graphfile: corrupt file")
+
+// A Reader looks up defs and refs in a graph file. Its methods decode only
+// the records they return, so they are fast even for large files.
+type Reader struct {
+	close func() error
+
+	sec      [numSections][]byte
+	repo     string
+	commitID string
+}
+
+// Open memory-maps the named graph file (or reads it, on systems without
+// mmap). The Reader must be closed when it's no longer used.
+func Open(name string) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, close, err := mmapFile(f)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(b)
+	if err != nil {
+		close()
+		return nil, err
+	}
+	r.close = close
+	return r, nil
+}
+
+// NewReader returns a Reader of the graph file contents b.
+func NewReader(b []byte) (*Reader, error) {
+	if len(b) < headerSize || string(b[:len(magic)]) != magic {
+		return nil, errors.New("graphfile: not a graph file")
+	}
+	if v := le.Uint32(b[len(magic):]); v != version {
+		return nil, errors.New("graphfile: unsupported version")
+	}
+	r := &Reader{}
+	h := b[len(magic)+4:]
+	for i := range r.sec {
+		off, n := le.Uint64(h[i*16:]), le.Uint64(h[i*16+8:])
+		if off > uint64(len(b)) || n > uint64(len(b))-off {
+			return nil, errCorrupt
+		}
+		r.sec[i] = b[off : off+n]
+	}
+	for i, size := range []int{secUnits: unitSize, secRefsByFile: refsByFileSize, secRefsByTarget: refsByTargetSize, secDefsByName: defsByNameSize, secDefsByKey: defsByKeySize} {
+		if size > 0 && (len(r.sec[i]) < 4 || r.count(i)*size != len(r.sec[i])-4) {
+			return nil, errCorrupt
+		}
+	}
+	s := r.sec[secStrings]
+	if len(s) < 4 || len(s) < 4+(int(le.Uint32(s))+1)*4 {
+		return nil, errCorrupt
+	}
+	h = h[numSections*16:]
+	r.repo, r.commitID = r.str(le.Uint32(h)), r.str(le.Uint32(h[4:]))
+	return r, nil
+}
+
+// Close unmaps the file, if the Reader was returned by Open. Defs and refs
+// that the Reader returned remain valid.
+func (r *Reader) Close() error {
+	if r.close == nil {
+		return nil
+	}
+	return r.close()
+}
+
+// Repo and CommitID return the repo and commit ID of the graph.
+func (r *Reader) Repo() string     { return r.repo }
+func (r *Reader) CommitID() string { return r.commitID }
+
+// Units returns the source units in the graph, sorted.
+func (r *Reader) Units() []graph.UnitKey {
+	units := make([]graph.UnitKey, r.count(secUnits))
+	for i := range units {
+		units[i] = r.unitKey(i)
+	}
+	return units
+}
+
+// UnitDefs returns the defs in unit, sorted by path.
+func (r *Reader) UnitDefs(unit graph.UnitKey) ([]*graph.Def, error) {
+	i, ok := r.findUnit(unit)
+	if !ok {
+		return nil, nil
+	}
+	off, n, err := r.unitRecords(i, 8, defFields)
+	if err != nil {
+		return nil, err
+	}
+	defs := make([]*graph.Def, n)
+	for j := range defs {
+		if defs[j], off, err = r.def(i, off); err != nil {
+			return nil, err
+		}
+	}
+	return defs, nil
+}
+
+// UnitRefs returns the refs in unit, sorted by file and position.
+func (r *Reader) UnitRefs(unit graph.UnitKey) ([]*graph.Ref, error) {
+	i, ok := r.findUnit(unit)
+	if !ok {
+		return nil, nil
+	}
+	off, n, err := r.unitRecords(i, 16, refFields)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*graph.Ref, n)
+	for j := range refs {
+		if refs[j], off, err = r.ref(i, off); err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// unitRecords returns the offset and number of the def or ref records of
+// the unit with index i, whose unit entry has them at field. It returns an
+// error if the records can't fit in the records section (so that a corrupt
+// count doesn't make callers allocate a huge slice), since each of their
+// fields is at least a byte.
+func (r *Reader) unitRecords(i, field, fields int) (off, n int, err error) {
+	e := r.entry(secUnits, unitSize, i)
+	off, n = int(le.Uint32(e[field:])), int(le.Uint32(e[field+4:]))
+	if off > len(r.sec[secRecords]) || n > (len(r.sec[secRecords])-off)/fields {
+		return 0, 0, errCorrupt
+	}
+	return off, n, nil
+}
+
+// Def returns the def with the given key (whose Repo and CommitID are
+// ignored), or nil if there is none.
+func (r *Reader) Def(key graph.DefKey) (*graph.Def, error) {
+	unit, ok := r.findUnit(graph.UnitKey{UnitType: key.UnitType, Unit: key.Unit})
+	if !ok {
+		return nil, nil
+	}
+	path, ok := r.strID(key.Path)
+	if !ok {
+		return nil, nil
+	}
+	i, end := r.search(secDefsByKey, defsByKeySize, []uint32{uint32(unit), path})
+	if i == end {
+		return nil, nil
+	}
+	e := r.entry(secDefsByKey, defsByKeySize, i)
+	d, _, err := r.def(unit, int(le.Uint32(e[8:])))
+	return d, err
+}
+
+// DefsByName returns the defs named name, in all units.
+func (r *Reader) DefsByName(name string) ([]*graph.Def, error) {
+	id, ok := r.strID(name)
+	if !ok {
+		return nil, nil
+	}
+	var defs []*graph.Def
+	i, end := r.search(secDefsByName, defsByNameSize, []uint32{id})
+	for ; i < end; i++ {
+		e := r.entry(secDefsByName, defsByNameSize, i)
+		d, _, err := r.def(int(le.Uint32(e[4:])), int(le.Uint32(e[8:])))
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, d)
+	}
+	return defs, nil
+}
+
+// RefsByFile returns the refs in file, sorted by position.
+func (r *Reader) RefsByFile(file string) ([]*graph.Ref, error) {
+	id, ok := r.strID(file)
+	if !ok {
+		return nil, nil
+	}
+	return r.lookupRefs(secRefsByFile, refsByFileSize, []uint32{id})
+}
+
+// RefsTo returns the refs to the def with the given key. Its CommitID is
+// ignored, and its Repo must be empty to find refs whose DefRepo is unknown.
+func (r *Reader) RefsTo(key graph.DefKey) ([]*graph.Ref, error) {
+	var ids []uint32
+	for _, s := range []string{key.Repo, key.UnitType, key.Unit, key.Path} {
+		id, ok := r.strID(s)
+		if !ok {
+			return nil, nil
+		}
+		ids = append(ids, id)
+	}
+	return r.lookupRefs(secRefsByTarget, refsByTargetSize, ids)
+}
+
+// lookupRefs returns the refs that the entries in the index sec whose first
+// fields are prefix point to. The entries' last two fields must be the
+// ref's unit and record offset.
+func (r *Reader) lookupRefs(sec, size int, prefix []uint32) ([]*graph.Ref, error) {
+	var refs []*graph.Ref
+	i, end := r.search(sec, size, prefix)
+	for ; i < end; i++ {
+		e := r.entry(sec, size, i)
+		ref, _, err := r.ref(int(le.Uint32(e[size-8:])), int(le.Uint32(e[size-4:])))
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// search returns the range [i, end) of the entries in the index (or units)
+// section sec whose first fields are prefix, by binary search.
+func (r *Reader) search(sec, size int, prefix []uint32) (i, end int) {
+	cmp := func(i int) int {
+		e := r.entry(sec, size, i)
+		for k, v := range prefix {
+			if ev := le.Uint32(e[k*4:]); ev != v {
+				if ev < v {
+					return -1
+				}
+				return 1
+			}
+		}
+		return 0
+	}
+	n := r.count(sec)
+	i = sort.Search(n, func(i int) bool { return cmp(i) >= 0 })
+	end = i + sort.Search(n-i, func(j int) bool { return cmp(i+j) > 0 })
+	return i, end
+}
+
+func (r *Reader) count(sec int) int { return int(le.Uint32(r.sec[sec])) }
+
+func (r *Reader) entry(sec, size, i int) []byte {
+	return r.sec[sec][4+i*size : 4+(i+1)*size]
+}
+
+func (r *Reader) unitKey(i int) graph.UnitKey {
+	e := r.entry(secUnits, unitSize, i)
+	return graph.UnitKey{UnitType: r.str(le.Uint32(e)), Unit: r.str(le.Uint32(e[4:]))}
+}
+
+// findUnit returns the index of unit in the units section.
+func (r *Reader) findUnit(unit graph.UnitKey) (int, bool) {
+	typ, ok1 := r.strID(unit.UnitType)
+	name, ok2 := r.strID(unit.Unit)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	i, end := r.search(secUnits, unitSize, []uint32{typ, name})
+	return i, i < end
+}
+
+// str returns the string with the given ID.
+func (r *Reader) str(id uint32) string {
+	s := r.sec[secStrings]
+	n := le.Uint32(s)
+	if id >= n {
+		return ""
+	}
+	data := s[4+(n+1)*4:]
+	start, end := le.Uint32(s[4+id*4:]), le.Uint32(s[4+(id+1)*4:])
+	if start > end || int(end) > len(data) {
+		return ""
+	}
+	return string(data[start:end])
+}
+
+// strID returns the ID of s, by binary search (since the string table is
+// sorted).
+func (r *Reader) strID(s string) (uint32, bool) {
+	n := int(le.Uint32(r.sec[secStrings]))
+	i := sort.Search(n, func(i int) bool { return r.str(uint32(i)) >= s })
+	if i < n && r.str(uint32(i)) == s {
+		return uint32(i), true
+	}
+	return 0, false
+}
+
+// def decodes the def record at off in the records section, in the unit
+// with index unit, and returns the offset of the next record.
+func (r *Reader) def(unit, off int) (*graph.Def, int, error) {
+	var v [defFields]uint64
+	off, err := r.uvarints(off, v[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	if unit < 0 || unit >= r.count(secUnits) {
+		return nil, 0, errCorrupt
+	}
+	u := r.unitKey(unit)
+	d := &graph.Def{
+		DefKey:   graph.DefKey{Repo: r.repo, CommitID: r.commitID, UnitType: u.UnitType, Unit: u.Unit, Path: r.str(uint32(v[0]))},
+		Kind:     r.str(uint32(v[1])),
+		Name:     r.str(uint32(v[2])),
+		Type:     r.str(uint32(v[3])),
+		Callable: v[4]&flagCallable != 0,
+		Exported: v[4]&flagExported != 0,
+		Scope:    r.str(uint32(v[5])),
+		File:     r.str(uint32(v[6])),
+		DefStart: int(v[7]),
+		DefEnd:   int(v[7] + v[8]),
+	}
+	if data := r.str(uint32(v[9])); data != "" {
+		d.Data = json.RawMessage(data)
+	}
+	if authorship := r.str(uint32(v[10])); authorship != "" {
+		d.Authorship = new(graph.Authorship)
+		if err := json.Unmarshal([]byte(authorship), d.Authorship); err != nil {
+			return nil, 0, err
+		}
+	}
+	return d, off, nil
+}
+
+// ref is like def, for ref records.
+func (r *Reader) ref(unit, off int) (*graph.Ref, int, error) {
+	var v [refFields]uint64
+	off, err := r.uvarints(off, v[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	if unit < 0 || unit >= r.count(secUnits) {
+		return nil, 0, errCorrupt
+	}
+	u := r.unitKey(unit)
+	return &graph.Ref{
+		DefRepo:     r.str(uint32(v[0])),
+		DefUnitType: r.str(uint32(v[1])),
+		DefUnit:     r.str(uint32(v[2])),
+		DefPath:     r.str(uint32(v[3])),
+		Repo:        r.repo,
+		CommitID:    r.commitID,
+		UnitType:    u.UnitType,
+		Unit:        u.Unit,
+		File:        r.str(uint32(v[4])),
+		Start:       int(v[5]),
+		End:         int(v[5] + v[6]),
+		Enclosing:   r.str(uint32(v[7])),
+		Kind:        r.str(uint32(v[8])),
+	}, off, nil
+}
+
+// uvarints decodes len(v) uvarints at off in the records section into v,
+// and returns the offset after them.
+func (r *Reader) uvarints(off int, v []uint64) (int, error) {
+	b := r.sec[secRecords]
+	for i := range v {
+		if off < 0 || off >= len(b) {
+			return 0, errCorrupt
+		}
+		x, n := binary.Uvarint(b[off:])
+		if n <= 0 {
+			return 0, errCorrupt
+		}
+		v[i], off = x, off+n
+	}
+	return off, nil
+}
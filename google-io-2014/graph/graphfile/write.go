@@ -0,0 +1,286 @@
+package graphfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// WriteFile writes g to the named file, which is created or truncated.
+func WriteFile(name string, g *graph.Graph) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, g); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes g to w. The Repo and CommitID of g's defs and refs aren't
+// written (they are assumed to be g's); all of their other fields are.
+func Write(w io.Writer, g *graph.Graph) error {
+	units, err := groupByUnit(g)
+	if err != nil {
+		return err
+	}
+	strs := newStringTable(g, units)
+
+	var sec [numSections]bytes.Buffer
+	var unitEntries, refsByFile, refsByTarget, defsByName, defsByKey []entry
+	records := &sec[secRecords]
+	for i, u := range units {
+		defsOff := records.Len()
+		for _, d := range u.defs {
+			off := uint32(records.Len())
+			writeDef(records, strs, d)
+			defsByName = append(defsByName, entry{strs.id(d.Name), uint32(i), off})
+			defsByKey = append(defsByKey, entry{uint32(i), strs.id(d.Path), off})
+		}
+		refsOff := records.Len()
+		for _, r := range u.refs {
+			off := uint32(records.Len())
+			writeRef(records, strs, r)
+			refsByFile = append(refsByFile, entry{strs.id(r.File), uint32(r.Start), uint32(i), off})
+			refsByTarget = append(refsByTarget, entry{strs.id(r.DefRepo), strs.id(r.DefUnitType), strs.id(r.DefUnit), strs.id(r.DefPath), uint32(i), off})
+		}
+		unitEntries = append(unitEntries, entry{strs.id(u.key.UnitType), strs.id(u.key.Unit), uint32(defsOff), uint32(len(u.defs)), uint32(refsOff), uint32(len(u.refs))})
+	}
+	strs.write(&sec[secStrings])
+	writeIndex(&sec[secUnits], unitEntries)
+	writeIndex(&sec[secRefsByFile], refsByFile)
+	writeIndex(&sec[secRefsByTarget], refsByTarget)
+	writeIndex(&sec[secDefsByName], defsByName)
+	writeIndex(&sec[secDefsByKey], defsByKey)
+	for i := range sec {
+		if sec[i].Len() > math.MaxUint32 {
+			return errors.New("graphfile: graph is too large")
+		}
+	}
+
+	var hdr bytes.Buffer
+	hdr.WriteString(magic)
+	putUint32s(&hdr, version)
+	off := uint64(headerSize)
+	for i := range sec {
+		var b [16]byte
+		le.PutUint64(b[:8], off)
+		le.PutUint64(b[8:], uint64(sec[i].Len()))
+		hdr.Write(b[:])
+		off += uint64(sec[i].Len())
+	}
+	putUint32s(&hdr, strs.id(g.Repo), strs.id(g.CommitID))
+
+	if _, err := hdr.WriteTo(w); err != nil {
+		return err
+	}
+	for i := range sec {
+		if _, err := sec[i].WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A unit is the defs and refs of a source unit in a graph.
+type unit struct {
+	key  graph.UnitKey
+	defs []*graph.Def
+	refs []*graph.Ref
+}
+
+// groupByUnit returns the units of g's defs and refs, sorted by key, with
+// their defs sorted by path and their refs by position.
+func groupByUnit(g *graph.Graph) ([]*unit, error) {
+	byKey := make(map[graph.UnitKey]*unit)
+	get := func(k graph.UnitKey) *unit {
+		u, ok := byKey[k]
+		if !ok {
+			u = &unit{key: k}
+			byKey[k] = u
+		}
+		return u
+	}
+	for _, d := range g.Defs {
+		if d.DefStart < 0 || d.DefEnd < d.DefStart {
+			return nil, errors.New("graphfile: def with bad range in " + d.File)
+		}
+		u := get(graph.UnitKey{UnitType: d.UnitType, Unit: d.Unit})
+		u.defs = append(u.defs, d)
+	}
+	for _, r := range g.Refs {
+		if r.Start < 0 || r.End < r.Start {
+			return nil, errors.New("graphfile: ref with bad range in " + r.File)
+		}
+		u := get(graph.UnitKey{UnitType: r.UnitType, Unit: r.Unit})
+		u.refs = append(u.refs, r)
+	}
+
+	units := make([]*unit, 0, len(byKey))
+	for _, u := range byKey {
+		sort.Stable(defsByPath(u.defs))
+		sort.Stable(refsByPos(u.refs))
+		units = append(units, u)
+	}
+	sort.Sort(unitsByKey(units))
+	return units, nil
+}
+
+func writeDef(w *bytes.Buffer, strs *stringTable, d *graph.Def) {
+	var flags uint64
+	if d.Callable {
+		flags |= flagCallable
+	}
+	if d.Exported {
+		flags |= flagExported
+	}
+	var authorship string
+	if d.Authorship != nil {
+		b, _ := json.Marshal(d.Authorship)
+		authorship = string(b)
+	}
+	putUvarints(w,
+		uint64(strs.id(d.Path)), uint64(strs.id(d.Kind)), uint64(strs.id(d.Name)), uint64(strs.id(d.Type)),
+		flags, uint64(strs.id(d.Scope)),
+		uint64(strs.id(d.File)), uint64(d.DefStart), uint64(d.DefEnd-d.DefStart),
+		uint64(strs.id(string(d.Data))), uint64(strs.id(authorship)),
+	)
+}
+
+func writeRef(w *bytes.Buffer, strs *stringTable, r *graph.Ref) {
+	putUvarints(w,
+		uint64(strs.id(r.DefRepo)), uint64(strs.id(r.DefUnitType)), uint64(strs.id(r.DefUnit)), uint64(strs.id(r.DefPath)),
+		uint64(strs.id(r.File)), uint64(r.Start), uint64(r.End-r.Start),
+		uint64(strs.id(r.Enclosing)), uint64(strs.id(r.Kind)),
+	)
+}
+
+// A stringTable assigns IDs to strings in sorted order.
+type stringTable struct {
+	strs []string
+	ids  map[string]uint32
+}
+
+func newStringTable(g *graph.Graph, units []*unit) *stringTable {
+	set := map[string]bool{"": true, g.Repo: true, g.CommitID: true}
+	for _, u := range units {
+		set[u.key.UnitType], set[u.key.Unit] = true, true
+		for _, d := range u.defs {
+			for _, s := range []string{d.Path, d.Kind, d.Name, d.Type, d.Scope, d.File, string(d.Data)} {
+				set[s] = true
+			}
+			if d.Authorship != nil {
+				b, _ := json.Marshal(d.Authorship)
+				set[string(b)] = true
+			}
+		}
+		for _, r := range u.refs {
+			for _, s := range []string{r.DefRepo, r.DefUnitType, r.DefUnit, r.DefPath, r.File, r.Enclosing, r.Kind} {
+				set[s] = true
+			}
+		}
+	}
+
+	t := &stringTable{strs: make([]string, 0, len(set)), ids: make(map[string]uint32, len(set))}
+	for s := range set {
+		t.strs = append(t.strs, s)
+	}
+	sort.Strings(t.strs)
+	for i, s := range t.strs {
+		t.ids[s] = uint32(i)
+	}
+	return t
+}
+
+func (t *stringTable) id(s string) uint32 { return t.ids[s] }
+
+func (t *stringTable) write(w *bytes.Buffer) {
+	putUint32s(w, uint32(len(t.strs)))
+	off := uint32(0)
+	for _, s := range t.strs {
+		putUint32s(w, off)
+		off += uint32(len(s))
+	}
+	putUint32s(w, off)
+	for _, s := range t.strs {
+		w.WriteString(s)
+	}
+}
+
+// An entry is an entry in an index (or the units section): fixed-size
+// fields, the first of which are its key.
+type entry []uint32
+
+func writeIndex(w *bytes.Buffer, entries []entry) {
+	sort.Sort(entriesByKey(entries))
+	putUint32s(w, uint32(len(entries)))
+	for _, e := range entries {
+		putUint32s(w, e...)
+	}
+}
+
+func putUint32s(w *bytes.Buffer, vs ...uint32) {
+	var b [4]byte
+	for _, v := range vs {
+		le.PutUint32(b[:], v)
+		w.Write(b[:])
+	}
+}
+
+func putUvarints(w *bytes.Buffer, vs ...uint64) {
+	var b [binary.MaxVarintLen64]byte
+	for _, v := range vs {
+		w.Write(b[:binary.PutUvarint(b[:], v)])
+	}
+}
+
+type unitsByKey []*unit
+
+func (v unitsByKey) Len() int      { return len(v) }
+func (v unitsByKey) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v unitsByKey) Less(i, j int) bool {
+	if v[i].key.UnitType != v[j].key.UnitType {
+		return v[i].key.UnitType < v[j].key.UnitType
+	}
+	return v[i].key.Unit < v[j].key.Unit
+}
+
+type defsByPath []*graph.Def
+
+func (v defsByPath) Len() int           { return len(v) }
+func (v defsByPath) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v defsByPath) Less(i, j int) bool { return v[i].Path < v[j].Path }
+
+type refsByPos []*graph.Ref
+
+func (v refsByPos) Len() int      { return len(v) }
+func (v refsByPos) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v refsByPos) Less(i, j int) bool {
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	return v[i].Start < v[j].Start
+}
+
+// entriesByKey sorts entries by their fields, in order.
+type entriesByKey []entry
+
+func (v entriesByKey) Len() int      { return len(v) }
+func (v entriesByKey) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v entriesByKey) Less(i, j int) bool {
+	for k := range v[i] {
+		if v[i][k] != v[j][k] {
+			return v[i][k] < v[j][k]
+		}
+	}
+	return false
+}
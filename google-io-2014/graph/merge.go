@@ -0,0 +1,149 @@
+package graph
+
+import "sort"
+
+// A Graph is the code graph of a repo at a commit.
+type Graph struct {
+	Repo     string
+	CommitID string
+	Defs     []*Def
+	Refs     []*Ref
+}
+
+// Merge merges the defs and refs that the source units of repo at commitID
+// output (e.g., converted with FromUnit), which may come from several
+// toolchains, into a clean graph, and returns the problems it found in them.
+//
+// Units that overlap (i.e., that both analyzed a file) output the same defs
+// under different units. Merge keeps each such def in only the first of the
+// units (by unit type and name), makes refs to it point to that unit, and
+// moves the refs in the files both units analyzed to that unit (refs from
+// them to other defs still point to the units that have those defs). It
+// then drops the defs and refs that Validate would report errors for, except
+// refs to undeclared dependencies, and returns those errors. The defs and
+// refs in the graph have the given Repo and CommitID, and are sorted.
+func Merge(repo, commitID string, defs []*Def, refs []*Ref, opt *Options) (*Graph, []*Error) {
+	if opt == nil {
+		opt = &Options{}
+	}
+
+	// Copy defs and refs, so that the caller's aren't modified.
+	mdefs := make([]*Def, len(defs))
+	for i, d := range defs {
+		def := *d
+		def.Repo, def.CommitID = repo, commitID
+		mdefs[i] = &def
+	}
+	sort.Stable(defsByKey(mdefs))
+	mdefs, moved, movedFiles := dedupeDefs(mdefs)
+
+	mdefs, errs := checkDefs(mdefs, opt)
+
+	mrefs := make([]*Ref, 0, len(refs))
+	seen := make(map[Ref]bool, len(refs))
+	for _, r := range refs {
+		ref := *r
+		ref.Repo, ref.CommitID = repo, commitID
+		if to, ok := moved[defPath{UnitKey{ref.DefUnitType, ref.DefUnit}, ref.DefPath}]; ok {
+			ref.DefUnit = to.Unit
+		}
+		if to, ok := movedFiles[unitFile{UnitKey{ref.UnitType, ref.Unit}, ref.File}]; ok {
+			ref.Unit = to.Unit
+		}
+		if seen[ref] {
+			continue // output by overlapping units
+		}
+		seen[ref] = true
+		mrefs = append(mrefs, &ref)
+	}
+
+	index := newDefIndex(mdefs, mrefs)
+	var valid []*Ref
+	for _, r := range mrefs {
+		if index.defs[pathOf(&DefKey{UnitType: r.DefUnitType, Unit: r.DefUnit, Path: r.DefPath})] {
+			r.DefRepo = repo
+		}
+		if err := index.checkRef(r, opt); err != nil {
+			errs = append(errs, err)
+			if err.Kind != ErrUndeclaredDep {
+				continue
+			}
+		}
+		valid = append(valid, r)
+	}
+	sort.Sort(refsByFile(valid))
+
+	return &Graph{Repo: repo, CommitID: commitID, Defs: mdefs, Refs: valid}, errs
+}
+
+// dedupeDefs removes the defs (sorted by key) that are the same as a def in
+// an earlier unit: that have the same unit type, path, file and range. It
+// returns the remaining defs, the units that the removed defs moved to, and
+// the units that each unit's files moved to (along with their defs).
+func dedupeDefs(defs []*Def) ([]*Def, map[defPath]UnitKey, map[unitFile]UnitKey) {
+	type site struct {
+		unitType, path, file string
+		start, end           int
+	}
+	first := make(map[site]*Def, len(defs))
+	moved := make(map[defPath]UnitKey)
+	movedFiles := make(map[unitFile]UnitKey)
+	var kept []*Def
+	for _, d := range defs {
+		s := site{d.UnitType, d.Path, d.File, d.DefStart, d.DefEnd}
+		f, ok := first[s]
+		if !ok {
+			first[s] = d
+		}
+		if ok && f.Unit != d.Unit && d.File != "" {
+			to := UnitKey{f.UnitType, f.Unit}
+			moved[pathOf(&d.DefKey)] = to
+			movedFiles[unitFile{UnitKey{d.UnitType, d.Unit}, d.File}] = to
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept, moved, movedFiles
+}
+
+// A unitFile is a file in a unit.
+type unitFile struct {
+	UnitKey
+	File string
+}
+
+type defsByKey []*Def
+
+func (v defsByKey) Len() int      { return len(v) }
+func (v defsByKey) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v defsByKey) Less(i, j int) bool {
+	a, b := v[i], v[j]
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
+
+type refsByFile []*Ref
+
+func (v refsByFile) Len() int      { return len(v) }
+func (v refsByFile) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v refsByFile) Less(i, j int) bool {
+	a, b := v[i], v[j]
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Start != b.Start {
+		return a.Start < b.Start
+	}
+	if a.End != b.End {
+		return a.End < b.End
+	}
+	if a.DefUnit != b.DefUnit {
+		return a.DefUnit < b.DefUnit
+	}
+	return a.DefPath < b.DefPath
+}
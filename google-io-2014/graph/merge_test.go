@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	// The JS units "lib" (a directory) and "lib/a.js" (a file in it) both
+	// analyzed lib/a.js, so they output the same def f and the same refs in
+	// it.
+	def := func(unit, path, file string, start, end int) *Def {
+		return &Def{DefKey: DefKey{UnitType: "js", Unit: unit, Path: path}, Name: path, File: file, DefStart: start, DefEnd: end}
+	}
+	ref := func(defUnit, defPath, unit, file string, start int) *Ref {
+		return &Ref{DefUnitType: "js", DefUnit: defUnit, DefPath: defPath, UnitType: "js", Unit: unit, File: file, Start: start, End: start + 1, Kind: RefCall}
+	}
+	defs := []*Def{
+		def("lib/a.js", "f", "lib/a.js", 0, 10),
+		def("lib", "f", "lib/a.js", 0, 10),
+		def("lib", "g", "lib/b.js", 0, 10),
+		def("util", "h", "util.js", 0, 10),
+		def("util", "bad", "util.js", 5, 2),
+	}
+	refs := []*Ref{
+		ref("lib/a.js", "f", "lib/a.js", "lib/a.js", 20),
+		ref("lib", "f", "lib", "lib/a.js", 20),
+		ref("util", "h", "lib/a.js", "lib/a.js", 30),
+		ref("lib", "f", "lib", "lib/b.js", 20),
+		ref("util", "missing", "lib", "lib/b.js", 30),
+		ref("jquery", "$", "lib", "lib/b.js", 40),
+	}
+	in := make([]Def, len(defs))
+	for i, d := range defs {
+		in[i] = *d
+	}
+
+	g, errs := Merge("r", "c", defs, refs, nil)
+
+	if g.Repo != "r" || g.CommitID != "c" {
+		t.Errorf("got repo %q commit %q, want r c", g.Repo, g.CommitID)
+	}
+	var gotDefs []string
+	for _, d := range g.Defs {
+		if d.Repo != "r" || d.CommitID != "c" {
+			t.Errorf("def %s %s: got repo %q commit %q", d.Unit, d.Path, d.Repo, d.CommitID)
+		}
+		gotDefs = append(gotDefs, d.Unit+" "+d.Path)
+	}
+	if want := []string{"lib f", "lib g", "util h"}; !reflect.DeepEqual(gotDefs, want) {
+		t.Errorf("got defs %q, want %q", gotDefs, want)
+	}
+
+	want := []*Ref{
+		{DefRepo: "r", DefUnitType: "js", DefUnit: "lib", DefPath: "f", Repo: "r", CommitID: "c", UnitType: "js", Unit: "lib", File: "lib/a.js", Start: 20, End: 21, Kind: RefCall},
+		{DefRepo: "r", DefUnitType: "js", DefUnit: "util", DefPath: "h", Repo: "r", CommitID: "c", UnitType: "js", Unit: "lib", File: "lib/a.js", Start: 30, End: 31, Kind: RefCall},
+		{DefRepo: "r", DefUnitType: "js", DefUnit: "lib", DefPath: "f", Repo: "r", CommitID: "c", UnitType: "js", Unit: "lib", File: "lib/b.js", Start: 20, End: 21, Kind: RefCall},
+		{DefUnitType: "js", DefUnit: "jquery", DefPath: "$", Repo: "r", CommitID: "c", UnitType: "js", Unit: "lib", File: "lib/b.js", Start: 40, End: 41, Kind: RefCall},
+	}
+	if len(g.Refs) != len(want) {
+		t.Errorf("got %d refs, want %d", len(g.Refs), len(want))
+	} else {
+		for i := range want {
+			if *g.Refs[i] != *want[i] {
+				t.Errorf("ref %d: got %+v, want %+v", i, g.Refs[i], want[i])
+			}
+		}
+	}
+
+	var gotErrs []string
+	for _, err := range errs {
+		gotErrs = append(gotErrs, err.Kind+" "+err.Def.Unit+" "+err.Def.Path)
+	}
+	if want := []string{ErrDefRange + " util bad", ErrDanglingRef + " util missing", ErrUndeclaredDep + " jquery $"}; !reflect.DeepEqual(gotErrs, want) {
+		t.Errorf("got errors %q, want %q", gotErrs, want)
+	}
+
+	for i, d := range defs {
+		if !reflect.DeepEqual(*d, in[i]) {
+			t.Errorf("Merge modified its input def %d: got %+v, want %+v", i, *d, in[i])
+		}
+	}
+	if errs := Validate(g.Defs, g.Refs, &Options{Deps: []UnitKey{{UnitType: "js", Unit: "jquery"}}}); errs != nil {
+		t.Errorf("merged graph isn't valid: %+v", errs)
+	}
+}
@@ -0,0 +1,196 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// An Error is a problem with a graph that Validate found. Errors are meant
+// to be read by programs (e.g., as JSON) as well as people.
+type Error struct {
+	Kind    string  // ErrDanglingRef, ErrUndeclaredDep, ErrDefRange or ErrDuplicateDef
+	Def     *DefKey `json:",omitempty"` // the def with the problem, or the ref's target
+	Ref     *Ref    `json:",omitempty"` // the ref with the problem, if any
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Kinds of Errors.
+const (
+	ErrDanglingRef   = "dangling-ref"   // a ref to a def that isn't in the graph or its dependencies
+	ErrUndeclaredDep = "undeclared-dep" // a ref to a unit that is neither in the graph nor in its dependencies (e.g., an indirect dependency)
+	ErrDefRange      = "def-range"      // a def whose range isn't inside its file
+	ErrDuplicateDef  = "duplicate-def"  // a def with the same unit type, unit and path as another
+)
+
+// Options configures Validate and Merge.
+type Options struct {
+	// Deps are the units outside of the graph that its refs may point to,
+	// such as the packages it imports. Refs to defs in other units that
+	// aren't in the graph are reported as undeclared dependencies, since they
+	// may be in the dependencies of Deps (e.g., a method of an embedded type
+	// from a package that the imported package imports).
+	Deps []UnitKey
+
+	// FileSize returns the length of file, which is a def's File. If it is
+	// nil, def ranges are only checked for being nonnegative and ordered.
+	FileSize func(file string) (int64, error)
+}
+
+// DirFileSize returns a FileSize func for files relative to dir (such as
+// those in the output of lang.AnalyzeDir).
+func DirFileSize(dir string) func(file string) (int64, error) {
+	sizes := make(map[string]int64)
+	return func(file string) (int64, error) {
+		if size, ok := sizes[file]; ok {
+			return size, nil
+		}
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return 0, err
+		}
+		sizes[file] = fi.Size()
+		return fi.Size(), nil
+	}
+}
+
+// ImportedUnits returns the units that refs import (in RefImport refs),
+// which are the declared dependencies of the units that contain the refs.
+func ImportedUnits(refs []*Ref) []UnitKey {
+	seen := make(map[UnitKey]bool)
+	var units []UnitKey
+	for _, r := range refs {
+		k := UnitKey{r.DefUnitType, r.DefUnit}
+		if r.Kind == RefImport && !seen[k] {
+			seen[k] = true
+			units = append(units, k)
+		}
+	}
+	sort.Sort(unitKeys(units))
+	return units
+}
+
+// Validate checks that defs' (UnitType, Unit, Path) keys are unique, that
+// their ranges are inside their files, and that refs point to defs in defs
+// or to units in opt.Deps. It returns the problems it found, or nil if
+// there are none.
+func Validate(defs []*Def, refs []*Ref, opt *Options) []*Error {
+	if opt == nil {
+		opt = &Options{}
+	}
+	_, errs := checkDefs(defs, opt)
+	index := newDefIndex(defs, refs)
+	for _, r := range refs {
+		if err := index.checkRef(r, opt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// checkDefs returns the defs that are valid (the first def with each key,
+// if its range is valid) and the errors in the rest.
+func checkDefs(defs []*Def, opt *Options) ([]*Def, []*Error) {
+	var valid []*Def
+	var errs []*Error
+	seen := make(map[defPath]bool, len(defs))
+	for _, d := range defs {
+		k := d.DefKey
+		p := pathOf(&k)
+		if seen[p] {
+			errs = append(errs, &Error{Kind: ErrDuplicateDef, Def: &k, Message: fmt.Sprintf("duplicate def %s %s %s", k.UnitType, k.Unit, k.Path)})
+			continue
+		}
+		seen[p] = true
+		if msg := checkRange(d, opt); msg != "" {
+			errs = append(errs, &Error{Kind: ErrDefRange, Def: &k, Message: fmt.Sprintf("def %s %s %s: %s", k.UnitType, k.Unit, k.Path, msg)})
+			continue
+		}
+		valid = append(valid, d)
+	}
+	return valid, errs
+}
+
+// checkRange returns why d's range is invalid, or "" if it's valid.
+func checkRange(d *Def, opt *Options) string {
+	if d.DefStart < 0 || d.DefEnd < d.DefStart {
+		return fmt.Sprintf("bad range [%d,%d)", d.DefStart, d.DefEnd)
+	}
+	if opt.FileSize == nil {
+		return ""
+	}
+	size, err := opt.FileSize(d.File)
+	if err != nil {
+		return err.Error()
+	}
+	if int64(d.DefEnd) > size {
+		return fmt.Sprintf("range [%d,%d) is past the end of %s (%d bytes)", d.DefStart, d.DefEnd, d.File, size)
+	}
+	return ""
+}
+
+// A defPath is the part of a DefKey that identifies a def in a commit's
+// graph.
+type defPath struct {
+	UnitKey
+	Path string
+}
+
+func pathOf(k *DefKey) defPath { return defPath{UnitKey{k.UnitType, k.Unit}, k.Path} }
+
+// A defIndex is the set of defs in a graph, and of the units that output
+// them (or refs).
+type defIndex struct {
+	defs  map[defPath]bool
+	units map[UnitKey]bool
+}
+
+func newDefIndex(defs []*Def, refs []*Ref) *defIndex {
+	x := &defIndex{defs: make(map[defPath]bool, len(defs)), units: make(map[UnitKey]bool)}
+	for _, d := range defs {
+		p := pathOf(&d.DefKey)
+		x.defs[p] = true
+		x.units[p.UnitKey] = true
+	}
+	for _, r := range refs {
+		x.units[UnitKey{r.UnitType, r.Unit}] = true
+	}
+	return x
+}
+
+// checkRef returns an error if r doesn't point to a def in x or to a unit in
+// opt.Deps.
+func (x *defIndex) checkRef(r *Ref, opt *Options) *Error {
+	k := r.DefKey()
+	p := pathOf(&k)
+	if x.defs[p] {
+		return nil
+	}
+	ref := *r
+	if x.units[p.UnitKey] {
+		if r.Kind == RefImport && r.DefPath == "" {
+			return nil // imports the whole unit
+		}
+		return &Error{Kind: ErrDanglingRef, Def: &k, Ref: &ref, Message: fmt.Sprintf("%s:%d: ref to %s %s %s, which isn't in the graph or its dependencies", r.File, r.Start, k.UnitType, k.Unit, k.Path)}
+	}
+	for _, dep := range opt.Deps {
+		if dep == p.UnitKey {
+			return nil
+		}
+	}
+	return &Error{Kind: ErrUndeclaredDep, Def: &k, Ref: &ref, Message: fmt.Sprintf("%s:%d: ref to %s %s %s, whose unit isn't in the graph or its declared dependencies", r.File, r.Start, k.UnitType, k.Unit, k.Path)}
+}
+
+type unitKeys []UnitKey
+
+func (v unitKeys) Len() int      { return len(v) }
+func (v unitKeys) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v unitKeys) Less(i, j int) bool {
+	if v[i].UnitType != v[j].UnitType {
+		return v[i].UnitType < v[j].UnitType
+	}
+	return v[i].Unit < v[j].Unit
+}
@@ -0,0 +1,76 @@
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	defs := []*Def{
+		{DefKey: DefKey{UnitType: "go", Unit: "pkg", Path: "A"}, File: "pkg/a.go", DefStart: 0, DefEnd: 10},
+		{DefKey: DefKey{UnitType: "go", Unit: "pkg", Path: "A"}, File: "pkg/a.go", DefStart: 20, DefEnd: 30},
+		{DefKey: DefKey{UnitType: "go", Unit: "pkg", Path: "B"}, File: "pkg/a.go", DefStart: 40, DefEnd: 200},
+		{DefKey: DefKey{UnitType: "go", Unit: "pkg", Path: "C"}, File: "pkg/a.go", DefStart: 50, DefEnd: 40},
+		{DefKey: DefKey{UnitType: "go", Unit: "pkg", Path: "D"}, File: "pkg/missing.go", DefStart: 0, DefEnd: 1},
+	}
+	ref := func(unit, path, kind string) *Ref {
+		return &Ref{DefUnitType: "go", DefUnit: unit, DefPath: path, UnitType: "go", Unit: "pkg", File: "pkg/a.go", Kind: kind}
+	}
+	refs := []*Ref{
+		ref("pkg", "A", RefCall),
+		ref("pkg", "Missing", RefRead),
+		ref("pkg", "", RefImport),
+		ref("fmt", "Println", RefCall),
+		ref("io", "Writer", RefType),
+	}
+	opt := &Options{
+		Deps: []UnitKey{{UnitType: "go", Unit: "fmt"}},
+		FileSize: func(file string) (int64, error) {
+			if file != "pkg/a.go" {
+				return 0, errors.New("no such file")
+			}
+			return 100, nil
+		},
+	}
+
+	var got []string
+	for _, err := range Validate(defs, refs, opt) {
+		var key DefKey
+		if err.Def != nil {
+			key = *err.Def
+		}
+		if (err.Ref != nil) != (err.Kind == ErrDanglingRef || err.Kind == ErrUndeclaredDep) {
+			t.Errorf("%s error %q: got Ref %+v", err.Kind, err.Message, err.Ref)
+		}
+		got = append(got, err.Kind+" "+key.Unit+" "+key.Path)
+	}
+	want := []string{
+		ErrDuplicateDef + " pkg A",
+		ErrDefRange + " pkg B",
+		ErrDefRange + " pkg C",
+		ErrDefRange + " pkg D",
+		ErrDanglingRef + " pkg Missing",
+		ErrUndeclaredDep + " io Writer",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+
+	if errs := Validate(defs[:1], refs[:1], nil); errs != nil {
+		t.Errorf("valid graph: got errors %+v", errs)
+	}
+}
+
+func TestImportedUnits(t *testing.T) {
+	refs := []*Ref{
+		{DefUnitType: "go", DefUnit: "io", Kind: RefImport},
+		{DefUnitType: "go", DefUnit: "fmt", DefPath: "Println", Kind: RefCall},
+		{DefUnitType: "go", DefUnit: "fmt", Kind: RefImport},
+		{DefUnitType: "go", DefUnit: "io", Kind: RefImport},
+	}
+	want := []UnitKey{{UnitType: "go", Unit: "fmt"}, {UnitType: "go", Unit: "io"}}
+	if got := ImportedUnits(refs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
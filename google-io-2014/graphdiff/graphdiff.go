@@ -0,0 +1,155 @@
+// Package graphdiff compares the defs and refs of two analyzed commits of a
+// repository.
+package graphdiff
+
+import (
+	"sort"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// A DefDiff describes a def that was added (Old is nil), removed (New is nil),
+// moved or changed between two commits.
+type DefDiff struct {
+	Old *graph.Def `json:",omitempty"`
+	New *graph.Def `json:",omitempty"`
+
+	// Callers is the number of distinct defs that refer to this def: in the
+	// new commit, or in the old commit if the def was removed.
+	Callers int
+}
+
+// Diff is the difference between the code graphs of two commits.
+type Diff struct {
+	AddedDefs   []*DefDiff
+	RemovedDefs []*DefDiff
+	MovedDefs   []*DefDiff // defs that are now in a different file
+	ChangedDefs []*DefDiff // defs whose kind or type signature (ignoring parameter names) changed
+
+	AddedRefs   []*graph.Ref
+	RemovedRefs []*graph.Ref
+}
+
+// Graph is the output of analyzing a commit.
+type Graph struct {
+	Defs []*graph.Def
+	Refs []*graph.Ref
+}
+
+// Compute returns the differences between the old and new graphs. Defs are
+// matched by their keys (without their CommitIDs); refs are matched by the def they
+// point to, their file, their enclosing def and their kind, so that refs whose
+// offsets merely shifted (due to edits above them) don't show up as changes.
+func Compute(old, new *Graph) *Diff {
+	oldCallers, newCallers := callers(old.Refs), callers(new.Refs)
+
+	oldDefs := make(map[graph.DefKey]*graph.Def, len(old.Defs))
+	for _, def := range old.Defs {
+		oldDefs[def.DefKey.WithoutCommit()] = def
+	}
+
+	d := &Diff{}
+	seen := make(map[graph.DefKey]bool, len(new.Defs))
+	for _, n := range new.Defs {
+		k := n.DefKey.WithoutCommit()
+		seen[k] = true
+		o, ok := oldDefs[k]
+		if !ok {
+			d.AddedDefs = append(d.AddedDefs, &DefDiff{New: n, Callers: len(newCallers[k])})
+			continue
+		}
+		if o.File != n.File {
+			d.MovedDefs = append(d.MovedDefs, &DefDiff{Old: o, New: n, Callers: len(newCallers[k])})
+		}
+		if o.Kind != n.Kind || !sameType(o.Type, n.Type) {
+			d.ChangedDefs = append(d.ChangedDefs, &DefDiff{Old: o, New: n, Callers: len(newCallers[k])})
+		}
+	}
+	for _, o := range old.Defs {
+		if k := o.DefKey.WithoutCommit(); !seen[k] {
+			d.RemovedDefs = append(d.RemovedDefs, &DefDiff{Old: o, Callers: len(oldCallers[k])})
+		}
+	}
+
+	d.AddedRefs, d.RemovedRefs = diffRefs(old.Refs, new.Refs)
+	return d
+}
+
+// callers returns the set of defs that refer to each def.
+func callers(refs []*graph.Ref) map[graph.DefKey]map[graph.DefKey]struct{} {
+	c := make(map[graph.DefKey]map[graph.DefKey]struct{})
+	for _, ref := range refs {
+		if ref.Enclosing == "" || ref.Kind == graph.RefDecl {
+			continue
+		}
+		k := ref.DefKey()
+		if c[k] == nil {
+			c[k] = make(map[graph.DefKey]struct{})
+		}
+		c[k][graph.DefKey{Repo: ref.Repo, UnitType: ref.UnitType, Unit: ref.Unit, Path: ref.Enclosing}] = struct{}{}
+	}
+	return c
+}
+
+type refKey struct {
+	def       graph.DefKey
+	repo      string
+	unitType  string
+	unit      string
+	file      string
+	enclosing string
+	kind      string
+}
+
+func refKeyOf(ref *graph.Ref) refKey {
+	return refKey{ref.DefKey(), ref.Repo, ref.UnitType, ref.Unit, ref.File, ref.Enclosing, ref.Kind}
+}
+
+// diffRefs compares refs as multisets of refKeys: if a function calls X three
+// times before and twice after, one ref to X was removed. Declarations are
+// skipped, since they come and go with the defs they declare.
+func diffRefs(old, new []*graph.Ref) (added, removed []*graph.Ref) {
+	oldByKey := make(map[refKey][]*graph.Ref)
+	for _, ref := range old {
+		if ref.Kind == graph.RefDecl {
+			continue
+		}
+		k := refKeyOf(ref)
+		oldByKey[k] = append(oldByKey[k], ref)
+	}
+	newByKey := make(map[refKey][]*graph.Ref)
+	for _, ref := range new {
+		if ref.Kind == graph.RefDecl {
+			continue
+		}
+		k := refKeyOf(ref)
+		newByKey[k] = append(newByKey[k], ref)
+	}
+
+	for k, newRefs := range newByKey {
+		if oldRefs := oldByKey[k]; len(newRefs) > len(oldRefs) {
+			sort.Sort(refsByStart(newRefs))
+			added = append(added, newRefs[len(oldRefs):]...)
+		}
+	}
+	for k, oldRefs := range oldByKey {
+		if newRefs := newByKey[k]; len(oldRefs) > len(newRefs) {
+			sort.Sort(refsByStart(oldRefs))
+			removed = append(removed, oldRefs[len(newRefs):]...)
+		}
+	}
+	sort.Sort(refsByStart(added))
+	sort.Sort(refsByStart(removed))
+	return added, removed
+}
+
+type refsByStart []*graph.Ref
+
+func (v refsByStart) Len() int      { return len(v) }
+func (v refsByStart) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v refsByStart) Less(i, j int) bool {
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	return v[i].Start < v[j].Start
+}
@@ -0,0 +1,217 @@
+package graphdiff
+
+import "strings"
+
+// sameType reports whether the def types a and b are the same, ignoring the
+// names of parameters (and of Go results), which callers don't depend on:
+// "func(a int) error" is the same as "func(b int) error", and "fn(x, y)" is
+// the same as "fn(a, b)".
+func sameType(a, b string) bool {
+	return a == b || unnamedParams(a) == unnamedParams(b)
+}
+
+// unnamedParams returns typ with the names removed from its parameter lists:
+// Go's "func(a int, b ...string) (n int, err error)" becomes
+// "func(int, ...string) (int, error)", TypeScript's "fn(w: number, h?:
+// number)" becomes "fn(number, ?number)", and JavaScript's untyped "fn(a, b)"
+// becomes "fn(_, _)".
+func unnamedParams(typ string) string {
+	var b strings.Builder
+	for i := 0; i < len(typ); i++ {
+		goList, jsList := isParamList(typ, i)
+		if !goList && !jsList {
+			b.WriteByte(typ[i])
+			continue
+		}
+		close := matchingParen(typ, i)
+		if close == -1 {
+			b.WriteString(typ[i:])
+			break
+		}
+		b.WriteByte('(')
+		for j, p := range splitTopLevel(typ[i+1 : close]) {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			if goList {
+				b.WriteString(unnamedGoParam(strings.TrimSpace(p)))
+			} else {
+				b.WriteString(unnamedJSParam(strings.TrimSpace(p)))
+			}
+		}
+		b.WriteByte(')')
+		i = close
+	}
+	return b.String()
+}
+
+// isParamList reports whether the "(" (if it is one) at typ[i] starts a Go
+// parameter or result list ("func(", or "(" after a Go parameter list), or a
+// JavaScript or TypeScript one ("fn(", or a TypeScript method signature
+// such as "(a: T): R").
+func isParamList(typ string, i int) (goList, jsList bool) {
+	if typ[i] != '(' {
+		return false, false
+	}
+	before := typ[:i]
+	switch {
+	case i == 0:
+		return false, true
+	case strings.HasSuffix(before, "func") && !isIdentByteBefore(before, len("func")):
+		return true, false
+	case strings.HasSuffix(before, "]"):
+		// A generic func's parameters follow its type parameters, "func[T any]".
+		j := strings.LastIndex(before, "func[")
+		return j != -1 && matchingBracket(typ, j+len("func")) == i-1, false
+	case strings.HasSuffix(before, "fn") && !isIdentByteBefore(before, len("fn")):
+		return false, true
+	case strings.HasSuffix(before, ") ") && strings.Contains(before, "func("):
+		return true, false // Go results
+	}
+	return false, false
+}
+
+// isIdentByteBefore reports whether the byte before the last n bytes of s is
+// part of an identifier.
+func isIdentByteBefore(s string, n int) bool {
+	return len(s) > n && isIdentByte(s[len(s)-n-1])
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c == '.' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isIdentByte(s[i]) || s[i] == '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// goTypeKeywords are the keywords that Go types (unlike parameter names)
+// can start with, followed by a space.
+var goTypeKeywords = map[string]bool{"chan": true, "func": true, "map": true, "struct": true, "interface": true}
+
+// unnamedGoParam returns the type of the Go parameter p ("name type" or
+// just "type").
+func unnamedGoParam(p string) string {
+	if i := strings.IndexByte(p, ' '); i != -1 && isIdent(p[:i]) && !goTypeKeywords[p[:i]] {
+		p = strings.TrimSpace(p[i+1:])
+	}
+	return unnamedParams(p)
+}
+
+// unnamedJSParam returns the type of the JavaScript or TypeScript parameter
+// p ("name", "name: type", "...name: type", "name?: type" or "name =
+// default"), keeping the rest ("...") and optional ("?") markers, or "_" if it
+// has no type.
+func unnamedJSParam(p string) string {
+	var prefix string
+	if strings.HasPrefix(p, "...") {
+		prefix, p = "...", p[3:]
+	}
+	if i := indexTopLevel(p, '='); i != -1 && !strings.HasPrefix(p[i:], "=>") {
+		p, prefix = strings.TrimSpace(p[:i]), prefix+"?"
+	}
+	name, typ := p, ""
+	if i := indexTopLevel(p, ':'); i != -1 {
+		name, typ = strings.TrimSpace(p[:i]), strings.TrimSpace(p[i+1:])
+	}
+	if strings.HasSuffix(name, "?") {
+		name, prefix = strings.TrimSuffix(name, "?"), prefix+"?"
+	}
+	if !isIdent(name) {
+		return prefix + unnamedParams(p) // e.g., a destructuring pattern
+	}
+	if typ == "" {
+		return prefix + "_"
+	}
+	return prefix + unnamedParams(typ)
+}
+
+// matchingParen returns the index of the ")" that closes the "(" at s[open],
+// or -1.
+func matchingParen(s string, open int) int {
+	if close := matchingBracket(s, open); close != -1 && s[close] == ')' {
+		return close
+	}
+	return -1
+}
+
+// matchingBracket returns the index of the bracket that closes the one at
+// s[open], or -1.
+func matchingBracket(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch {
+		case opens(s, i):
+			depth++
+		case closes(s, i):
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits s at the commas that aren't nested in brackets.
+func splitTopLevel(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var parts []string
+	for {
+		i := indexTopLevel(s, ',')
+		if i == -1 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// indexTopLevel returns the index of the first c in s that isn't nested in
+// brackets, or -1.
+func indexTopLevel(s string, c byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == c && depth == 0:
+			return i
+		case opens(s, i):
+			depth++
+		case closes(s, i):
+			depth--
+		}
+	}
+	return -1
+}
+
+// opens and closes report whether s[i] opens or closes a bracket. Angle
+// brackets (of type arguments) count, except in Go's "<-" and in "->" and
+// "=>".
+func opens(s string, i int) bool {
+	switch s[i] {
+	case '(', '[', '{':
+		return true
+	case '<':
+		return i+1 == len(s) || s[i+1] != '-'
+	}
+	return false
+}
+
+func closes(s string, i int) bool {
+	switch s[i] {
+	case ')', ']', '}':
+		return true
+	case '>':
+		return i == 0 || s[i-1] != '-' && s[i-1] != '='
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package graphdiff
+
+import "testing"
+
+func TestUnnamedParams(t *testing.T) {
+	tests := map[string]string{
+		// Go
+		"func(a int, b ...string) (n int, err error)":  "func(int, ...string) (int, error)",
+		"func(int, string) error":                      "func(int, string) error",
+		"func()":                                       "func()",
+		"func(w http.ResponseWriter, r *http.Request)": "func(http.ResponseWriter, *http.Request)",
+		"func(f func(x int) bool) func(y string)":      "func(func(int) bool) func(string)",
+		"func(m map[string]int, c chan int)":           "func(map[string]int, chan int)",
+		"func(s struct{ X int }, ch <-chan int)":       "func(struct{ X int }, <-chan int)",
+		"func[T any](x T, xs []T) T":                   "func[T any](T, []T) T",
+		"*Router":                                      "*Router",
+		"map[string]func(a int)":                       "map[string]func(int)",
+
+		// JavaScript and TypeScript
+		"fn(a, b)":                              "fn(_, _)",
+		"fn()":                                  "fn()",
+		"fn(w: number, h?: number) -> Rect":     "fn(number, ?number) -> Rect",
+		"fn(...args: string[])":                 "fn(...string[])",
+		"fn(x = 1, ...rest)":                    "fn(?_, ..._)",
+		"fn(cb: (err: Error) => void)":          "fn((Error) => void)",
+		"fn(m: Map<string, number>, n: number)": "fn(Map<string, number>, number)",
+		"fn({a, b}, [c])":                       "fn({a, b}, [c])",
+		"(a: T): R":                             "(T): R",
+		"fn(a":                                  "fn(a",
+	}
+	for typ, want := range tests {
+		if got := unnamedParams(typ); got != want {
+			t.Errorf("unnamedParams(%q): got %q, want %q", typ, got, want)
+		}
+	}
+}
+
+func TestSameType(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"func(a int) error", "func(b int) error", true},
+		{"func(a int) error", "func(a int64) error", false},
+		{"fn(x, y)", "fn(a, b)", true},
+		{"fn(x, y)", "fn(x)", false},
+		{"fn(x?: number)", "fn(x: number)", false},
+		{"fn(x: number)", "fn(y: number)", true},
+		{"Counter", "Counter", true},
+	}
+	for _, test := range tests {
+		if got := sameType(test.a, test.b); got != test.same {
+			t.Errorf("sameType(%q, %q): got %v, want %v", test.a, test.b, got, test.same)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Package html analyzes the code embedded in HTML files, such as the
+// JavaScript in <script> blocks of templates.
+package html
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// HTMLAnalyzer splits HTML files into regions and analyzes each region with
+// the analyzer registered for its language (e.g., "js" for scripts). Defs and
+// refs have offsets in the HTML file.
+type HTMLAnalyzer struct{}
+
+func (_ HTMLAnalyzer) Analyze(file string) ([]*lang.Def, []*lang.Ref, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lang.AnalyzeRegions(file, src, Split(src))
+}
+
+// Scan returns the HTML files under dir. Each file is analyzed on its own.
+func (_ HTMLAnalyzer) Scan(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() && path != dir && strings.HasPrefix(fi.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if ext := filepath.Ext(path); !fi.IsDir() && (ext == ".html" || ext == ".htm") {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+var _ lang.Analyzer = &HTMLAnalyzer{}
+var _ lang.Scanner = &HTMLAnalyzer{}
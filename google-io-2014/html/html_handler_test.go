@@ -0,0 +1,10 @@
+package html
+
+import (
+	"testing"
+
+	_ "github.com/sourcegraph/talks/google-io-2014/javascript"
+	"github.com/sourcegraph/talks/google-io-2014/lang/langtest"
+)
+
+func TestHTMLAnalyzer(t *testing.T) { langtest.Run(t, "html", "testdata") }
@@ -0,0 +1,7 @@
+package html
+
+import "github.com/sourcegraph/talks/google-io-2014/lang"
+
+func init() {
+	lang.Register("html", &HTMLAnalyzer{})
+}
@@ -0,0 +1,143 @@
+package html
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// scriptTypes maps the values of a <script> tag's type attribute to the
+// language of its contents. Scripts with other types (such as
+// "text/template" or "application/json") aren't code we can analyze.
+var scriptTypes = map[string]string{
+	"":                       "js",
+	"text/javascript":        "js",
+	"application/javascript": "js",
+	"module":                 "js",
+}
+
+// Split returns the regions of an HTML document that contain code in other
+// languages: the contents of its <script> elements. Classic (non-module)
+// scripts are grouped, since they share the page's global scope; each module
+// script has its own. It doesn't fully parse
+// HTML, but it does skip comments and tags inside them.
+func Split(src []byte) []lang.Region {
+	var regions []lang.Region
+	lower := bytes.ToLower(src)
+	for i := 0; i < len(src); {
+		lt := bytes.IndexByte(src[i:], '<')
+		if lt == -1 {
+			break
+		}
+		i += lt
+		if bytes.HasPrefix(src[i:], []byte("<!--")) {
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end == -1 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		}
+		if !bytes.HasPrefix(lower[i:], []byte("<script")) || !isTagNameEnd(src, i+len("<script")) {
+			i++
+			continue
+		}
+
+		tagEnd := endOfTag(src, i)
+		if tagEnd == -1 {
+			break
+		}
+		start := tagEnd + 1
+		end := bytes.Index(lower[start:], []byte("</script"))
+		if end == -1 {
+			end = len(src)
+		} else {
+			end += start
+		}
+		typ := strings.ToLower(strings.TrimSpace(attr(src[i:tagEnd], "type")))
+		if l, ok := scriptTypes[typ]; ok && end > start {
+			r := lang.Region{Lang: l, Start: start, End: end}
+			if typ != "module" {
+				r.Group = "script" // classic scripts share the page's global scope
+			}
+			regions = append(regions, r)
+		}
+		i = end
+	}
+	return regions
+}
+
+func isTagNameEnd(src []byte, i int) bool {
+	if i >= len(src) {
+		return false
+	}
+	switch src[i] {
+	case ' ', '\t', '\n', '\r', '\f', '/', '>':
+		return true
+	}
+	return false
+}
+
+// endOfTag returns the offset of the ">" that ends the tag starting at i,
+// skipping over quoted attribute values, or -1 if the tag isn't closed.
+func endOfTag(src []byte, i int) int {
+	var quote byte
+	for ; i < len(src); i++ {
+		switch c := src[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// attr returns the value of the named attribute in tag (which starts with "<"
+// and excludes the closing ">"), or "" if there is no such attribute.
+func attr(tag []byte, name string) string {
+	s := string(tag)
+	// Skip the tag name.
+	i := strings.IndexAny(s, " \t\n\r\f/")
+	if i == -1 {
+		return ""
+	}
+	s = s[i:]
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f/")
+		if s == "" {
+			return ""
+		}
+		n := strings.IndexAny(s, " \t\n\r\f/=")
+		if n == -1 {
+			n = len(s)
+		}
+		key := s[:n]
+		s = strings.TrimLeft(s[n:], " \t\n\r\f")
+		val := ""
+		if strings.HasPrefix(s, "=") {
+			s = strings.TrimLeft(s[1:], " \t\n\r\f")
+			if s != "" && (s[0] == '"' || s[0] == '\'') {
+				if end := strings.IndexByte(s[1:], s[0]); end != -1 {
+					val, s = s[1:1+end], s[2+end:]
+				} else {
+					val, s = s[1:], "" // unterminated
+				}
+			} else {
+				end := strings.IndexAny(s, " \t\n\r\f")
+				if end == -1 {
+					end = len(s)
+				}
+				val, s = s[:end], s[end:]
+			}
+		}
+		if strings.EqualFold(key, name) {
+			return val
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package javascript
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// Analyze (in js_handler.go) is the simple, regexp-based example from the
+// talk. AnalyzeDir uses AnalyzeUnit instead, which parses the file and finds
+// refs, and lang.AnalyzeRegions uses AnalyzeSource.
+
+// AnalyzeSource analyzes src, such as a script block in an HTML file, as if it
+// were the contents of file.
+func (_ JSAnalyzer) AnalyzeSource(file string, src []byte) ([]*lang.Def, []*lang.Ref, error) {
+	return analyze(file, src)
+}
+
+// AnalyzeUnit analyzes the file of u with its config: "JSX" (whether the
+// file may contain JSX) and "Infer" (whether to infer def types).
+func (_ JSAnalyzer) AnalyzeUnit(dir string, u *lang.SourceUnit) ([]*lang.Def, []*lang.Ref, error) {
+	return analyzeUnit(dir, u)
+}
+
+func analyzeUnit(dir string, u *lang.SourceUnit) ([]*lang.Def, []*lang.Ref, error) {
+	file := filepath.Join(dir, filepath.FromSlash(u.Name))
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return analyzeConfig(file, src, unitConfig(file, u))
+}
+
+// Scan returns the JavaScript (including JSX and ES module) files under dir.
+// Each file is analyzed on its own.
+func (_ JSAnalyzer) Scan(dir string) ([]string, error) {
+	return scanFiles(dir, ".js", ".jsx", ".mjs", ".cjs")
+}
+
+// scanFiles returns the files under dir with one of the given extensions,
+// skipping hidden dirs.
+func scanFiles(dir string, exts ...string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() && path != dir && strings.HasPrefix(fi.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		for _, ext := range exts {
+			if filepath.Ext(path) == ext {
+				rel, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+				files = append(files, rel)
+				break
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+var _ lang.Scanner = &JSAnalyzer{}
+var _ lang.SourceAnalyzer = &JSAnalyzer{}
+var _ lang.UnitAnalyzer = &JSAnalyzer{}
@@ -0,0 +1,96 @@
+package javascript
+
+// exported reports whether the declaration starting at the keyword at i is
+// preceded by "export" (possibly with "default", "async" or, in TypeScript,
+// "declare", "abstract" or "const" in between).
+func (p *parser) exported(i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		switch t := p.toks[j]; {
+		case t.is("export"):
+			return true
+		case t.is("default") || t.is("async") || t.is("declare") || t.is("abstract") || t.is("const"):
+			continue
+		}
+		return false
+	}
+	return false
+}
+
+// markExports marks the file-level defs that the module exports by name, with
+// "export { a, b as c }" (ES modules), by assigning them to module.exports or
+// exports (CommonJS), or with "export type { T }" and "export = a"
+// (TypeScript). Exported declarations are marked as they're parsed.
+func (p *parser) markExports() {
+	for i := 0; i < len(p.toks); i++ {
+		switch {
+		case p.toks[i].is("export") && (p.tok(i+1).is("{") || p.tok(i+1).is("type") && p.tok(i+2).is("{")):
+			open := i + 1
+			if p.tok(open).is("type") {
+				open++
+			}
+			close := p.pair[open]
+			for j := open + 1; j < close; j++ {
+				if p.toks[j].is("type") && p.tok(j+1).kind == tokIdent {
+					continue // export { type T }
+				}
+				if p.toks[j].kind == tokIdent && !p.tok(j-1).is("as") {
+					p.markExported(i, p.toks[j].text)
+				}
+			}
+			i = close
+
+		case p.ts && p.toks[i].is("export") && p.tok(i+1).is("=") && p.tok(i+2).kind == tokIdent:
+			p.markExported(i, p.tok(i+2).text)
+			i += 2
+
+		case p.toks[i].is("module") && p.tok(i+1).is(".") && p.tok(i+2).is("exports"):
+			i = p.markAssignedExports(i + 3)
+
+		case p.toks[i].is("exports") && !p.tok(i-1).is("."):
+			i = p.markAssignedExports(i + 1)
+		}
+	}
+}
+
+// markAssignedExports handles the rest of a CommonJS export, starting after
+// "module.exports" or "exports" at i: "= name", "= { a, b: c }" or
+// ".name = value". It returns the index of the last token handled.
+func (p *parser) markAssignedExports(i int) int {
+	if p.tok(i).is(".") && p.tok(i+1).kind == tokIdent {
+		i += 2
+	}
+	if !p.tok(i).is("=") {
+		return i - 1
+	}
+	value := p.tok(i + 1)
+	switch {
+	case value.kind == tokIdent && !p.tok(i+2).is("."):
+		p.markExported(i, value.text)
+		return i + 1
+	case value.is("{"):
+		close := p.pair[i+1]
+		for j := i + 2; j < close; j++ {
+			t := p.toks[j]
+			if t.kind == tokIdent && !p.tok(j+1).is(":") && (p.tok(j+1).is(",") || j+1 == close) && (p.tok(j-1).is(",") || p.tok(j-1).is(":") || j-1 == i+1) {
+				p.markExported(i, t.text)
+			}
+		}
+		return close
+	}
+	return i
+}
+
+// markExported marks the def named name that is exported by the export at
+// token index i: a file-level def, or a member of the ambient module the
+// export is in.
+func (p *parser) markExported(i int, name string) {
+	s := p.blocks[0].scope
+	for open, as := range p.ambient {
+		if open < i && i < p.pair[open] {
+			s = as
+		}
+	}
+	if def := s.names[name]; def != nil {
+		def.Exported = true
+	}
+}
@@ -0,0 +1,684 @@
+package javascript
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// Type inference, in the spirit of (but much simpler than) tern.js. While
+// parsing, the parser records var initializers, function signatures and the
+// values functions return. Once the whole file is parsed, infer derives a
+// type for each def from those (and from JSDoc and TypeScript annotations),
+// and resolveMembers uses the types to resolve property accesses like
+// "obj.method" and "this.method".
+//
+// Types are shown as in tern: "number", "string", "boolean", "[number]" for
+// arrays, "Foo" for instances of Foo, and "fn(a: number, b) -> string" for
+// functions. Defs whose type can't be inferred have an empty Type, as do
+// classes, interfaces, enums and namespaces, which are types (or hold them)
+// rather than values of one.
+
+// A jsType is an inferred type.
+type jsType struct {
+	name string // as shown in Def.Type
+	// For instances, the class (or constructor function, or interface);
+	// for object literals assigned to a def, the def.
+	class *lang.Def
+}
+
+// An expr is the expression from token index start to end, in scope.
+type expr struct {
+	start, end int
+	scope      *scope
+}
+
+type varInit struct {
+	def *lang.Def
+	expr
+}
+
+// A signature is what the parser found out about a function.
+type signature struct {
+	params           []param
+	ret              string // declared return type (TypeScript)
+	returns          []expr // values of return statements
+	async, generator bool
+}
+
+type param struct {
+	name string
+	typ  string // declared type (TypeScript)
+	dflt *expr  // default value
+	rest bool
+}
+
+// A memberUse is a property access, "obj.name", that may refer to a member
+// of a class.
+type memberUse struct {
+	tok       token // the property name
+	obj       token // an identifier, "this", or the ")" that ends a call
+	scope     *scope
+	enclosing *lang.Def
+	thisPath  string // for "this", the path of the class it refers to
+	call      *expr  // for a call, as in "new Foo().name", the call
+	kind      string
+}
+
+// sigParams returns the parameters between the parentheses at open and
+// close.
+func (p *parser) sigParams(open, close int) []param {
+	var params []param
+	for j := open + 1; j < close; j++ {
+		end := j
+		for end < close && !p.toks[end].is(",") {
+			if typEnd, ok := p.types[end]; ok {
+				end = typEnd // may contain commas, as in Map<K, V>
+			} else if t := p.toks[end]; t.is("(") || t.is("[") || t.is("{") {
+				end = p.pair[end]
+			}
+			end++
+		}
+		if pa, ok := p.param(j, end-1); ok {
+			params = append(params, pa)
+		}
+		j = end
+	}
+	return params
+}
+
+// param returns the parameter declared by the tokens from start to end.
+func (p *parser) param(start, end int) (param, bool) {
+	j := start
+	for p.ts && tsModifiers[p.tok(j).text] && j < end {
+		j++
+	}
+	var pa param
+	if p.tok(j).is("...") {
+		pa.rest = true
+		j++
+	}
+	switch t := p.tok(j); {
+	case t.is("this"):
+		return pa, false // TypeScript's declared type of this
+	case t.kind == tokIdent:
+		pa.name = t.text
+	case t.is("{") || t.is("["):
+		pa.name = t.text + "..." + p.toks[p.pair[j]].text
+		j = p.pair[j]
+	default:
+		return pa, false
+	}
+	j++
+	if p.tok(j).is("?") {
+		pa.name += "?"
+		j++
+	}
+	if p.tok(j).is(":") {
+		if typEnd, ok := p.types[j+1]; ok {
+			pa.typ = p.text(j+1, typEnd)
+			j = typEnd + 1
+		}
+	}
+	if p.tok(j).is("=") && j < end {
+		pa.dflt = &expr{start: j + 1, end: end, scope: p.scope()}
+	}
+	return pa, true
+}
+
+// addReturn records the value returned by the return statement at i in the
+// signature of the function it's in.
+func (p *parser) addReturn(i int) {
+	if next := p.tok(i + 1); next.is(";") || next.is("}") || next.nl || i+1 >= len(p.toks) {
+		return
+	}
+	for k := len(p.blocks) - 1; k >= 0; k-- {
+		if b := p.blocks[k]; b.kind == blockFunc {
+			if sig := p.sigs[b.owner]; sig != nil && b.owner != nil {
+				sig.returns = append(sig.returns, expr{start: i + 1, end: p.exprEnd(i + 1), scope: p.scope()})
+			}
+			return
+		}
+	}
+}
+
+// addMemberUse records the property access whose name is at i, if its
+// object is a plain identifier, "this", or a call (see callStart).
+func (p *parser) addMemberUse(i int) {
+	obj := p.tok(i - 2)
+	u := &memberUse{tok: p.toks[i], obj: obj, scope: p.scope(), enclosing: p.enclosing(), kind: p.useKind(i)}
+	switch {
+	case obj.is(")"):
+		start := p.callStart(i - 2)
+		if start == -1 {
+			return
+		}
+		u.call = &expr{start: start, end: i - 2, scope: u.scope}
+	case obj.kind != tokIdent || keywords[obj.text] && !obj.is("this") || p.tok(i-3).is(".") || p.tok(i-3).is("?."):
+		return
+	case obj.is("this"):
+		if u.thisPath = p.thisPath(); u.thisPath == "" {
+			return
+		}
+	}
+	p.memberUses = append(p.memberUses, u)
+	p.memberAt[i] = u
+}
+
+// callStart returns the index of the first token of the call that ends with
+// the ")" at end, such as "f(x)", "new a.B(x)" or "a.b(x).c()", or -1 if the
+// callee isn't a chain of identifiers, property accesses and calls.
+func (p *parser) callStart(end int) int {
+	for j := end; ; {
+		if p.tok(j).is(")") {
+			open, ok := p.pair[j]
+			if !ok {
+				return -1
+			}
+			j = open - 1
+			continue
+		}
+		if t := p.tok(j); t.kind != tokIdent || keywords[t.text] && !t.is("this") {
+			return -1
+		}
+		switch {
+		case p.tok(j-1).is(".") || p.tok(j-1).is("?."):
+			j -= 2
+		case p.tok(j - 1).is("new"):
+			return j - 1
+		default:
+			return j
+		}
+	}
+}
+
+// thisPath returns the path of the class that "this" refers to in the
+// current block: the class of the enclosing method (including methods
+// assigned to a constructor's prototype), or the enclosing constructor
+// function. Arrow functions don't bind this.
+func (p *parser) thisPath() string {
+	for k := len(p.blocks) - 1; k >= 0; k-- {
+		b := p.blocks[k]
+		switch {
+		case b.kind == blockClass:
+			if b.owner != nil {
+				return b.owner.Path
+			}
+			return ""
+		case b.kind != blockFunc || b.arrow:
+			continue
+		case b.owner == nil:
+			return ""
+		case k > 0 && p.blocks[k-1].kind == blockClass:
+			if c := p.blocks[k-1].owner; c != nil {
+				return c.Path
+			}
+			return ""
+		case b.owner.Kind == "method":
+			if slash := strings.LastIndex(b.owner.Path, "/"); slash != -1 {
+				return b.owner.Path[:slash]
+			}
+		case (b.owner.Kind == "function" || b.owner.Kind == "var") && isCapitalized(b.owner.Name):
+			return b.owner.Path // a constructor function
+		}
+		return ""
+	}
+	return ""
+}
+
+func isCapitalized(name string) bool {
+	return name != "" && 'A' <= name[0] && name[0] <= 'Z'
+}
+
+// infer sets the Type of each def to its inferred type, if any.
+func (p *parser) infer() {
+	for _, def := range p.defs {
+		switch def.Kind {
+		case "class", "interface", "type", "enum", "namespace", "module":
+			continue // a type, not a value (type aliases' Type is the aliased type)
+		}
+		if t := p.typeOf(def); t != nil {
+			def.Type = t.name
+		}
+	}
+}
+
+// typeOf returns the type of def, or nil if it can't be inferred.
+func (p *parser) typeOf(def *lang.Def) *jsType {
+	if def == nil {
+		return nil
+	}
+	if t, ok := p.inferred[def]; ok {
+		return t // nil while def's type is being inferred
+	}
+	p.inferred[def] = nil
+	t := p.inferType(def)
+	p.inferred[def] = t
+	return t
+}
+
+func (p *parser) inferType(def *lang.Def) *jsType {
+	switch def.Kind {
+	case "class", "interface", "enum", "namespace", "module":
+		return nil
+	case "type":
+		return p.namedType(def.Type)
+	case "property", "member":
+		if def.Type != "" {
+			return p.namedType(def.Type) // declared (or, for enum members, numeric)
+		}
+	}
+	doc := p.jsdoc(def)
+	if sig := p.sigs[def]; sig != nil {
+		return &jsType{name: p.fnType(def, sig, doc)}
+	}
+	if typ, ok := p.declared[def]; ok {
+		return p.namedType(typ)
+	}
+	if doc.typ != "" {
+		return p.namedType(doc.typ)
+	}
+	for _, init := range p.inits {
+		if init.def == def {
+			if t := p.exprType(init.expr); t != nil {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// fnType returns the type of the function def with the given signature and
+// JSDoc.
+func (p *parser) fnType(def *lang.Def, sig *signature, doc jsdoc) string {
+	params := make([]string, len(sig.params))
+	for i, pa := range sig.params {
+		typ := pa.typ
+		if typ == "" {
+			typ = doc.params[strings.TrimSuffix(pa.name, "?")]
+		}
+		if typ == "" && pa.dflt != nil {
+			if t := p.exprType(*pa.dflt); t != nil {
+				typ = t.name
+			}
+		}
+		params[i] = pa.name
+		if pa.rest {
+			params[i] = "..." + params[i]
+		}
+		if typ != "" {
+			params[i] += ": " + typ
+		}
+	}
+	s := "fn(" + strings.Join(params, ", ") + ")"
+	if ret := p.returnType(def); ret != nil {
+		s += " -> " + ret.name
+	}
+	return s
+}
+
+// returnType returns the type of the values the function def returns, or nil
+// if it returns nothing or the type can't be inferred.
+func (p *parser) returnType(def *lang.Def) *jsType {
+	if t, ok := p.retTypes[def]; ok {
+		return t // nil while being inferred, as for recursive functions
+	}
+	p.retTypes[def] = nil
+	t := p.inferReturnType(def)
+	p.retTypes[def] = t
+	return t
+}
+
+func (p *parser) inferReturnType(def *lang.Def) *jsType {
+	sig := p.sigs[def]
+	if sig == nil {
+		return nil
+	}
+	doc := p.jsdoc(def)
+	switch {
+	case sig.ret != "":
+		return p.namedType(sig.ret)
+	case doc.returns != "":
+		return p.namedType(doc.returns)
+	case sig.generator:
+		return nil
+	}
+	var t *jsType
+	var names []string
+	for _, e := range sig.returns {
+		et := p.exprType(e)
+		if et == nil {
+			continue
+		}
+		if t == nil {
+			t = et
+		}
+		if !contains(names, et.name) {
+			names = append(names, et.name)
+		}
+	}
+	if len(names) > 1 {
+		t = &jsType{name: strings.Join(names, "|")}
+	}
+	if sig.async {
+		if t == nil {
+			return &jsType{name: "Promise"}
+		}
+		return &jsType{name: "Promise<" + t.name + ">"}
+	}
+	return t
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// namedType returns the type named by a JSDoc or TypeScript type
+// expression. If it names a class, interface or constructor declared at the
+// file level, the type is an instance of it.
+func (p *parser) namedType(typ string) *jsType {
+	typ = strings.TrimSpace(typ)
+	if typ == "" {
+		return nil
+	}
+	t := &jsType{name: typ}
+	name := typ
+	if i := strings.IndexByte(name, '<'); i != -1 {
+		name = name[:i] // generic type arguments
+	}
+	if def := p.blocks[0].scope.names[name]; def != nil && (def.Kind == "interface" || isConstructor(def)) {
+		t.class = def
+	}
+	return t
+}
+
+// isConstructor reports whether def can be instantiated with "new": it's a
+// class, or a function declared as such or assigned to a var.
+func isConstructor(def *lang.Def) bool {
+	return def.Kind == "class" || def.Kind == "function" || def.Kind == "var" && def.Callable
+}
+
+// binaryOps are the binary operators whose result type doesn't depend on
+// their operands, and those results.
+var binaryOps = map[string]string{
+	"==": "boolean", "===": "boolean", "!=": "boolean", "!==": "boolean", "<": "boolean",
+	">": "boolean", "<=": "boolean", ">=": "boolean", "instanceof": "boolean", "in": "boolean",
+	"-": "number", "*": "number", "/": "number", "%": "number", "**": "number",
+	"&": "number", "|": "number", "^": "number", "<<": "number", ">>": "number", ">>>": "number",
+}
+
+// exprType returns the type of the expression e, or nil if it can't be
+// inferred.
+func (p *parser) exprType(e expr) *jsType {
+	if e.end < e.start || e.start >= len(p.toks) {
+		return nil
+	}
+	first := p.toks[e.start]
+	if p.ts && first.is("<") {
+		// A type assertion, <T>x.
+		if close := p.angleClose(e.start); close != -1 && close < e.end {
+			return p.namedType(p.text(e.start+1, close-1))
+		}
+	}
+
+	// Operators at the top level of the expression.
+	var op string  // the operator that determines the type, other than "+"
+	var plus []int // token indexes of "+" operators
+	strOperand := false
+	for j := e.start; j <= e.end; j++ {
+		t := p.toks[j]
+		binary := j > e.start && endsExpr(p.toks[j-1])
+		switch {
+		case t.is("(") || t.is("[") || t.is("{"):
+			j = p.pair[j]
+		case p.ts && t.is("<") && p.typeArgsEnd(j) != -1:
+			j = p.typeArgsEnd(j)
+		case t.is("?") || t.is("&&") || t.is("||") || t.is("??") || t.is("=") || t.is(",") || t.is("=>"):
+			return nil // type depends on which operand is the result
+		case p.ts && t.is("as") && binary:
+			return p.namedType(p.text(j+1, e.end))
+		case t.kind == tokString || t.kind == tokTemplate:
+			strOperand = true
+		case binary && t.is("+"):
+			plus = append(plus, j)
+		case binary && binaryOps[t.text] != "" && (t.kind == tokPunct || t.is("instanceof") || t.is("in")):
+			if op == "" || binaryOps[t.text] == "boolean" {
+				op = t.text
+			}
+		}
+	}
+	switch {
+	case binaryOps[op] == "boolean":
+		return &jsType{name: "boolean"}
+	case len(plus) > 0 && strOperand:
+		return &jsType{name: "string"}
+	case len(plus) > 0:
+		// Numbers if all of the operands are, or else unknown.
+		start := e.start
+		for _, j := range append(plus, e.end+1) {
+			if t := p.exprType(expr{start: start, end: j - 1, scope: e.scope}); t == nil || t.name != "number" {
+				return nil
+			}
+			start = j + 1
+		}
+		return &jsType{name: "number"}
+	case op != "":
+		return &jsType{name: binaryOps[op]}
+	}
+
+	switch {
+	case first.is("!") || first.is("delete"):
+		return &jsType{name: "boolean"}
+	case first.is("typeof"):
+		return &jsType{name: "string"}
+	case first.is("-") || first.is("+") || first.is("~"):
+		return &jsType{name: "number"}
+	case first.is("(") && p.pair[e.start] == e.end:
+		return p.exprType(expr{start: e.start + 1, end: e.end - 1, scope: e.scope})
+	case first.is("[") && p.pair[e.start] == e.end:
+		elem := "?"
+		if e.end > e.start+1 {
+			if t := p.exprType(expr{start: e.start + 1, end: p.exprEnd(e.start + 1), scope: e.scope}); t != nil {
+				elem = t.name
+			}
+		}
+		return &jsType{name: "[" + elem + "]"}
+	case first.is("{") && p.pair[e.start] == e.end:
+		return &jsType{name: "object", class: p.fnOwners[e.start]}
+	case p.toks[e.end].is(")") && p.memberAt[p.pair[e.end]-1] != nil && p.callStart(e.end) == e.start:
+		// A method call, as in obj.m(...) or new Foo().m(...).
+		if def := p.memberDef(p.memberAt[p.pair[e.end]-1]); def != nil {
+			return p.returnType(def)
+		}
+		return nil
+	case e.end-2 >= e.start && p.memberAt[e.end] != nil && (e.end-2 == e.start || p.callStart(e.end-2) == e.start):
+		// A property, as in obj.p or new Foo().p.
+		return p.typeOf(p.memberDef(p.memberAt[e.end]))
+	case first.is("new") && p.tok(e.start+1).kind == tokIdent:
+		if next := e.start + 2; next <= e.end && !(p.toks[next].is("(") && p.pair[next] == e.end) {
+			return nil // new a.B(), new A().b, etc.
+		}
+		name := p.toks[e.start+1].text
+		def, _ := e.scope.lookup(name)
+		if def != nil && !isConstructor(def) {
+			return nil
+		}
+		return &jsType{name: name, class: def}
+	case first.kind == tokIdent && !keywords[first.text] && p.tok(e.start+1).is("(") && p.pair[e.start+1] == e.end:
+		def, _ := e.scope.lookup(first.text)
+		if def == nil || def.Kind == "class" {
+			return nil
+		}
+		return p.returnType(def)
+	case e.start != e.end:
+		return nil
+	}
+
+	switch {
+	case first.kind == tokNumber:
+		return &jsType{name: "number"}
+	case first.kind == tokString || first.kind == tokTemplate:
+		return &jsType{name: "string"}
+	case first.kind == tokRegexp:
+		return &jsType{name: "RegExp"}
+	case first.is("true") || first.is("false"):
+		return &jsType{name: "boolean"}
+	case first.is("this"):
+		def := p.def(p.thisAt[e.start])
+		if def == nil {
+			return nil
+		}
+		if !isConstructor(def) {
+			return &jsType{name: "object", class: def} // an object literal's method
+		}
+		return &jsType{name: def.Name, class: def}
+	case first.kind == tokIdent && !keywords[first.text]:
+		def, _ := e.scope.lookup(first.text)
+		if def == nil || def.Kind == "class" || def.Kind == "enum" || def.Kind == "namespace" {
+			return nil
+		}
+		return p.typeOf(def)
+	}
+	return nil
+}
+
+// resolveMembers resolves property accesses to members of classes (and, in
+// TypeScript, interfaces, enums and namespaces), using the types of the
+// objects they're accessed on.
+func (p *parser) resolveMembers() []*lang.Ref {
+	var refs []*lang.Ref
+	for _, u := range p.memberUses {
+		def := p.memberDef(u)
+		if def == nil {
+			continue
+		}
+		ref := &lang.Ref{DefPath: def.Path, File: p.file, Start: u.tok.start, End: u.tok.end, Kind: u.kind}
+		if u.enclosing != nil {
+			ref.Enclosing = u.enclosing.Path
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// memberDef returns the def of the member that u accesses, or nil if the
+// object's type or the member isn't known.
+func (p *parser) memberDef(u *memberUse) *lang.Def {
+	owner := u.thisPath
+	switch {
+	case owner != "":
+	case u.call != nil:
+		t := p.exprType(*u.call)
+		if t == nil || t.class == nil {
+			return nil
+		}
+		owner = t.class.Path
+	default:
+		def, _ := u.scope.lookup(u.obj.text)
+		if def == nil {
+			return nil
+		}
+		switch def.Kind {
+		case "class", "enum", "namespace":
+			owner = def.Path // static member
+		default:
+			t := p.typeOf(def)
+			if t == nil || t.class == nil {
+				return nil
+			}
+			owner = t.class.Path
+		}
+	}
+	return p.def(owner + "/" + u.tok.text)
+}
+
+// def returns the def with the given path, if any.
+func (p *parser) def(path string) *lang.Def {
+	if p.byPath == nil {
+		p.byPath = make(map[string]*lang.Def, len(p.defs))
+		for _, def := range p.defs {
+			p.byPath[def.Path] = def
+		}
+	}
+	return p.byPath[path]
+}
+
+// A jsdoc holds the types documented in a JSDoc comment.
+type jsdoc struct {
+	params  map[string]string // @param types, by name
+	returns string            // @returns (or @return) type
+	typ     string            // @type type
+}
+
+// jsdoc returns the types in the JSDoc comment ("/** ... */") directly
+// before def's declaration, if any.
+func (p *parser) jsdoc(def *lang.Def) jsdoc {
+	doc := jsdoc{params: make(map[string]string)}
+	i := sort.Search(len(p.toks), func(i int) bool { return p.toks[i].start >= def.Start })
+	if i == len(p.toks) || p.toks[i].start != def.Start {
+		return doc
+	}
+	for p.tok(i-1).is("export") || p.tok(i-1).is("default") || p.tok(i-1).is("declare") {
+		i--
+	}
+	prevEnd := 0
+	if i > 0 {
+		prevEnd = p.toks[i-1].end
+	}
+	gap := strings.TrimRight(p.src[prevEnd:p.toks[i].start], " \t\r\n")
+	open := strings.LastIndex(gap, "/**")
+	if !strings.HasSuffix(gap, "*/") || open == -1 {
+		return doc
+	}
+	comment := gap[open+3 : len(gap)-2]
+	for _, tag := range strings.Split(comment, "@")[1:] {
+		name, rest := tag, ""
+		if i := strings.IndexAny(tag, " \t\r\n{"); i != -1 {
+			name, rest = tag[:i], strings.TrimLeft(tag[i:], " \t")
+		}
+		typ, rest := docType(rest)
+		switch name {
+		case "param", "arg", "argument":
+			f := strings.Fields(rest)
+			if typ == "" || len(f) == 0 {
+				continue
+			}
+			pname := strings.Trim(f[0], "[]")
+			if eq := strings.IndexByte(pname, '='); eq != -1 {
+				pname = pname[:eq] // [name=default]
+			}
+			doc.params[pname] = typ
+		case "returns", "return":
+			doc.returns = typ
+		case "type":
+			doc.typ = typ
+		}
+	}
+	return doc
+}
+
+// docType returns the type in braces at the start of s (as in "{number}"),
+// if any, and the rest of s.
+func docType(s string) (string, string) {
+	if !strings.HasPrefix(s, "{") {
+		return "", s
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return strings.TrimSpace(s[1:i]), s[i+1:]
+			}
+		}
+	}
+	return "", s
+}
@@ -28,9 +28,6 @@ func (_ JSAnalyzer) Analyze(file string) ([]*lang.Def, []*lang.Ref, error) { //
 
 // END OMIT
 
-// dummy
-func (_ JSAnalyzer) Scan(dir string) ([]string, error) { return nil, nil }
-
 // dummy
 func (_ JSAnalyzer) ListDependencies(pkg string) ([]*lang.Dep, error) { return nil, nil }
 
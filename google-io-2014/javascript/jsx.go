@@ -0,0 +1,186 @@
+package javascript
+
+import "strings"
+
+// jsxPrecedes lists keywords after which a "<" starts a JSX element.
+var jsxPrecedes = map[string]bool{
+	"return": true, "yield": true, "await": true, "case": true, "default": true, "else": true,
+	"do": true, "in": true, "of": true, "typeof": true, "void": true, "delete": true, "throw": true,
+}
+
+// startsJSX reports whether the "<" at z.i starts a JSX element: it must be
+// where an expression can start (where "<" can't be an operator) and be
+// followed by a tag name or ">" (for a fragment). TypeScript generic arrow
+// functions ("<T,>(x: T) => x" and "<T extends U>...") are not JSX.
+func (z *tokenizer) startsJSX() bool {
+	if len(z.toks) > 0 {
+		prev := z.toks[len(z.toks)-1]
+		switch prev.kind {
+		case tokPunct:
+			switch prev.text {
+			case ")", "]", "}", "++", "--":
+				return false
+			}
+		case tokIdent:
+			if !jsxPrecedes[prev.text] {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	rest := z.s[z.i+1:]
+	if strings.HasPrefix(rest, ">") {
+		return true
+	}
+	if rest == "" || !isIdentStart(rest[0]) {
+		return false
+	}
+	n := 0
+	for n < len(rest) && isIdentPart(rest[n]) {
+		n++
+	}
+	after := strings.TrimLeft(rest[n:], " \t\r\n")
+	return !strings.HasPrefix(after, ",") && !strings.HasPrefix(after, "extends ")
+}
+
+// jsxElement scans the JSX element or fragment starting at the "<" at z.i,
+// including nested elements. JSX text and attribute names aren't JavaScript,
+// so the only tokens emitted are:
+//
+//   - tokJSX tokens for "<" and for the closing tag (or "/>"), so that the
+//     element is an operand in the surrounding expression;
+//   - the names in component tags (such as "Foo" in <Foo> or "ui.Button" in
+//     <ui.Button>, but not intrinsic HTML tags like <div>), which refer to
+//     JavaScript values;
+//   - the contents of {...} expression containers, with the braces emitted as
+//     "(" and ")" so that the parser treats them as parenthesized expressions.
+func (z *tokenizer) jsxElement() {
+	s := z.s
+	start := z.i
+	z.emit(tokJSX, "<", z.i, z.i+1)
+	z.i++
+	if z.jsxName() {
+		z.jsxTypeArgs()
+	}
+
+	// Attributes.
+	for z.i < len(s) {
+		c := s[z.i]
+		switch {
+		case c == '{':
+			z.jsxExpr()
+			continue
+		case strings.HasPrefix(s[z.i:], "/>"):
+			z.emit(tokJSX, "/>", z.i, z.i+2)
+			z.i += 2
+			return
+		case c == '>':
+			z.i++
+		case c == '"' || c == '\'':
+			// JSX attribute strings have no escapes.
+			if end := strings.IndexByte(s[z.i+1:], c); end != -1 {
+				z.i += end + 2
+			} else {
+				z.unterminated("JSX attribute string", z.i, len(s))
+				z.i = len(s)
+			}
+			continue
+		case c == '<':
+			z.jsxElement()
+			continue
+		default:
+			z.i++
+			continue
+		}
+		break
+	}
+
+	// Children, up to the closing tag.
+	for z.i < len(s) {
+		switch {
+		case strings.HasPrefix(s[z.i:], "</"):
+			end := strings.IndexByte(s[z.i:], '>')
+			if end == -1 {
+				z.unterminated("JSX closing tag", z.i, len(s))
+				end = len(s) - z.i - 1
+			}
+			z.emit(tokJSX, s[z.i:z.i+end+1], z.i, z.i+end+1)
+			z.i += end + 1
+			return
+		case s[z.i] == '<':
+			z.jsxElement()
+		case s[z.i] == '{':
+			z.jsxExpr()
+		default:
+			z.i++
+		}
+	}
+	z.unterminated("JSX element", start, len(s))
+}
+
+// jsxName scans the tag name at z.i, emitting tokens for it if it names a
+// component (it's capitalized or a member expression), and reports whether
+// there is one.
+func (z *tokenizer) jsxName() bool {
+	s := z.s
+	start := z.i
+	for z.i < len(s) && (isIdentPart(s[z.i]) || s[z.i] == '.' || s[z.i] == '-' || s[z.i] == ':') {
+		z.i++
+	}
+	name := s[start:z.i]
+	if name == "" || !(strings.Contains(name, ".") || ('A' <= name[0] && name[0] <= 'Z')) {
+		return name != ""
+	}
+	offset := start
+	for k, part := range strings.Split(name, ".") {
+		if k > 0 {
+			z.emit(tokPunct, ".", offset, offset+1)
+			offset++
+		}
+		z.emit(tokIdent, part, offset, offset+len(part))
+		offset += len(part)
+	}
+	return true
+}
+
+// jsxTypeArgs skips the TSX type arguments after a tag name at z.i, if any,
+// as in <Select<Option> value={v} />. They aren't attributes or children.
+func (z *tokenizer) jsxTypeArgs() {
+	s := z.s
+	i := z.i
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r' || s[i] == '\n') {
+		i++
+	}
+	if i == len(s) || s[i] != '<' {
+		return
+	}
+	depth := 0
+	for ; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "=>"):
+			i++ // a function type's arrow
+		case s[i] == '<':
+			depth++
+		case s[i] == '>':
+			if depth--; depth == 0 {
+				z.i = i + 1
+				return
+			}
+		}
+	}
+	z.unterminated("JSX type arguments", z.i, len(s))
+	z.i = len(s)
+}
+
+// jsxExpr scans the {...} expression container at z.i.
+func (z *tokenizer) jsxExpr() {
+	z.emit(tokPunct, "(", z.i, z.i+1)
+	z.i++
+	z.js(true)
+	if z.i < len(z.s) {
+		z.nl = false
+		z.emit(tokPunct, ")", z.i, z.i+1)
+		z.i++
+	}
+}
@@ -0,0 +1,1036 @@
+package javascript
+
+import (
+	"strconv"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// A scope maps names declared in a function (or the file) to their defs.
+// Parameters are recorded with a nil def: they shadow outer names but aren't
+// defs themselves.
+type scope struct {
+	parent *scope
+	names  map[string]*lang.Def
+	path   string // path prefix of defs declared in this scope
+	module bool   // the file (or a TypeScript namespace), so names aren't local
+}
+
+func newScope(parent *scope, path string) *scope {
+	return &scope{parent: parent, names: make(map[string]*lang.Def), path: path}
+}
+
+func (s *scope) lookup(name string) (*lang.Def, bool) {
+	for ; s != nil; s = s.parent {
+		if def, ok := s.names[name]; ok {
+			return def, true
+		}
+	}
+	return nil, false
+}
+
+type blockKind int
+
+const (
+	blockOther blockKind = iota
+	blockFunc
+	blockClass
+	blockObject
+)
+
+// A block is a region of tokens, usually delimited by braces, that ends at
+// token index end.
+type block struct {
+	kind   blockKind
+	end    int
+	scope  *scope
+	owner  *lang.Def // def whose body this is (and whose End is set at the end of the block)
+	object *lang.Def // for an object literal assigned to a def, the def
+	arrow  bool      // an arrow function's body, which doesn't bind this
+}
+
+// A use is an identifier that may refer to a def. Uses are resolved after the
+// whole file is parsed, since function and var declarations are hoisted.
+type use struct {
+	tok       token
+	scope     *scope
+	enclosing *lang.Def
+	kind      string // lang.RefRead, lang.RefCall, etc.
+}
+
+type parser struct {
+	file string
+	src  string
+	ts   bool // TypeScript
+	toks []token
+	pair map[int]int // index of matching bracket, for every bracket token
+
+	defs   []*lang.Def
+	uses   []use
+	paths  map[string]bool
+	blocks []*block
+
+	declNames map[int]*lang.Def // tokens that name declared defs
+	fnOwners  map[int]*lang.Def // tokens starting a function, class or object expression assigned to a def
+
+	types   map[int]int          // TypeScript types, from first to last token index
+	members map[string]*lang.Def // TypeScript class and interface members, by path
+	ambient map[int]*scope       // TypeScript ambient module bodies, by index of their "{"
+	private map[*lang.Def]bool   // TypeScript private class members
+
+	// Type inference (see infer.go).
+	inits      []varInit
+	sigs       map[*lang.Def]*signature
+	declared   map[*lang.Def]string // TypeScript type annotations of vars
+	memberUses []*memberUse
+	memberAt   map[int]*memberUse   // by token index of the member name
+	thisAt     map[int]string       // paths of the classes that "this" tokens refer to
+	byPath     map[string]*lang.Def // built once parsing is done
+	inferred   map[*lang.Def]*jsType
+	retTypes   map[*lang.Def]*jsType
+
+	// topDecls are the file-level var declarators not yet fully parsed, in
+	// order. The first one, once reached, encloses the tokens in its range.
+	topDecls []declRange
+	topDecl  *lang.Def
+}
+
+type declRange struct {
+	def        *lang.Def
+	start, end int // token indexes
+}
+
+// config is the configuration of the analyzer for a unit, from its
+// SourceUnit.Config (e.g., in the repo's Srcfile).
+type config struct {
+	jsx   bool // the source may contain JSX ("JSX"; by default, unless it's a .ts file)
+	infer bool // infer def types, and resolve member accesses with them ("Infer"; true by default)
+}
+
+// unitConfig returns the config for file, in a unit with config u (which
+// may be nil).
+func unitConfig(file string, u *lang.SourceUnit) config {
+	_, jsx := dialect(file)
+	c := config{jsx: jsx, infer: true}
+	if u != nil {
+		c.jsx = u.ConfigBool("JSX", c.jsx)
+		c.infer = u.ConfigBool("Infer", c.infer)
+	}
+	return c
+}
+
+// analyze parses the JavaScript (or TypeScript, depending on the file name)
+// source of file and returns its defs and the refs to them.
+func analyze(file string, src []byte) ([]*lang.Def, []*lang.Ref, error) {
+	return analyzeConfig(file, src, unitConfig(file, nil))
+}
+
+// analyzeConfig is like analyze, with the given config. The parser recovers
+// from syntax errors; the ones it notices (such as unterminated literals and
+// unbalanced brackets) are returned as lang.Diagnostics, along with the defs
+// and refs.
+func analyzeConfig(file string, src []byte, c config) ([]*lang.Def, []*lang.Ref, error) {
+	ts, _ := dialect(file)
+	toks, diags := tokenize(file, src, c.jsx)
+	p := &parser{
+		file:      file,
+		src:       string(src),
+		ts:        ts,
+		toks:      toks,
+		paths:     make(map[string]bool),
+		declNames: make(map[int]*lang.Def),
+		fnOwners:  make(map[int]*lang.Def),
+		types:     make(map[int]int),
+		members:   make(map[string]*lang.Def),
+		ambient:   make(map[int]*scope),
+		private:   make(map[*lang.Def]bool),
+		sigs:      make(map[*lang.Def]*signature),
+		declared:  make(map[*lang.Def]string),
+		inferred:  make(map[*lang.Def]*jsType),
+		retTypes:  make(map[*lang.Def]*jsType),
+		memberAt:  make(map[int]*memberUse),
+		thisAt:    make(map[int]string),
+	}
+	p.pair = p.matchBrackets(&diags)
+	p.blocks = []*block{{kind: blockFunc, end: len(p.toks), scope: newScope(nil, "")}}
+	p.blocks[0].scope.module = true
+	p.parse()
+	p.markExports()
+	p.setScopes()
+	refs := append(p.declRefs(), p.imports()...)
+	refs = append(refs, p.resolve()...)
+	if c.infer {
+		p.infer()
+		refs = append(refs, p.resolveMembers()...)
+	}
+	if len(diags) > 0 {
+		return p.defs, refs, diags
+	}
+	return p.defs, refs, nil
+}
+
+// closers maps each opening bracket to its closing bracket.
+var closers = map[string]string{"(": ")", "[": "]", "{": "}"}
+
+// matchBrackets pairs up (), [] and {} tokens. A closing bracket closes the
+// innermost open bracket of its kind; the brackets opened after that one are
+// unclosed. Unclosed brackets are paired with the token before the one that
+// closes an outer bracket (or with the end of the file), and they and
+// unmatched closing brackets are added to diags.
+func (p *parser) matchBrackets(diags *lang.Diagnostics) map[int]int {
+	pair := make(map[int]int)
+	var stack []int
+	unclosed := func(open, last int) {
+		pair[open] = last
+		t := p.toks[open]
+		*diags = append(*diags, &lang.Diagnostic{File: p.file, Start: t.start, End: t.end, Message: "unclosed " + t.text})
+	}
+	for i, t := range p.toks {
+		if t.kind != tokPunct {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			stack = append(stack, i)
+		case ")", "]", "}":
+			k := len(stack) - 1
+			for k >= 0 && closers[p.toks[stack[k]].text] != t.text {
+				k--
+			}
+			if k < 0 {
+				*diags = append(*diags, &lang.Diagnostic{File: p.file, Start: t.start, End: t.end, Message: "unmatched " + t.text})
+				continue
+			}
+			for _, open := range stack[k+1:] {
+				unclosed(open, i-1)
+			}
+			pair[stack[k]], pair[i] = i, stack[k]
+			stack = stack[:k]
+		}
+	}
+	for _, open := range stack {
+		unclosed(open, len(p.toks)-1)
+	}
+	return pair
+}
+
+func (p *parser) tok(i int) token {
+	if i < 0 || i >= len(p.toks) {
+		return token{kind: tokPunct, start: -1}
+	}
+	return p.toks[i]
+}
+
+func (p *parser) block() *block { return p.blocks[len(p.blocks)-1] }
+
+// scope returns the innermost function scope.
+func (p *parser) scope() *scope {
+	for i := len(p.blocks) - 1; ; i-- {
+		if p.blocks[i].scope != nil {
+			return p.blocks[i].scope
+		}
+	}
+}
+
+// enclosing returns the def whose body the parser is in: the innermost named
+// function, method or class, or else the file-level var declaration.
+func (p *parser) enclosing() *lang.Def {
+	for i := len(p.blocks) - 1; i >= 0; i-- {
+		if p.blocks[i].owner != nil {
+			return p.blocks[i].owner
+		}
+	}
+	return p.topDecl
+}
+
+func (p *parser) parse() {
+	for i := 0; i < len(p.toks); i++ {
+		for len(p.blocks) > 1 && i > p.block().end {
+			p.popBlock()
+		}
+		for len(p.topDecls) > 0 && i > p.topDecls[0].end {
+			p.topDecls = p.topDecls[1:]
+		}
+		p.topDecl = nil
+		if len(p.topDecls) > 0 && i >= p.topDecls[0].start {
+			p.topDecl = p.topDecls[0].def
+		}
+
+		if end, ok := p.types[i]; ok {
+			i = end
+			continue
+		}
+
+		t := p.toks[i]
+		switch {
+		case t.is("function"):
+			i = p.function(i)
+		case t.is("class"):
+			i = p.class(i)
+		case (t.is("var") || t.is("let") || t.is("const")) && !(p.ts && p.tok(i+1).is("enum")):
+			p.varDecl(i) // but not "const enum E {...}", which tsDeclaration handles
+		case t.is("=>"):
+			start := i - 1
+			if p.tok(start).is(")") {
+				start = p.pair[start]
+			}
+			i = p.arrowBody(i, nil, start)
+		case t.is("("):
+			if p.startsArrow(i) {
+				i = p.arrowParams(i)
+			}
+		case p.ts && t.is("<"):
+			i = p.typeArgs(i)
+		case p.ts && (t.is("as") || t.is("satisfies")) && endsExpr(p.tok(i-1)) && !p.tok(i-1).is("*"):
+			end := p.typeEnd(i + 1)
+			p.typeRefs(i+1, end, p.enclosing())
+			i = end
+		case t.is("{"):
+			b := &block{kind: blockOther, end: p.pair[i]}
+			if p.startsObject(i) {
+				b.kind, b.object = blockObject, p.fnOwners[i]
+			}
+			p.blocks = append(p.blocks, b)
+		case t.is("return"):
+			p.addReturn(i)
+		case t.kind == tokIdent:
+			if p.ts {
+				if end, ok := p.tsDeclaration(i); ok {
+					i = end
+					break
+				}
+			}
+			i = p.ident(i)
+		}
+	}
+	for len(p.blocks) > 1 {
+		p.popBlock()
+	}
+}
+
+func (p *parser) popBlock() {
+	b := p.block()
+	if b.owner != nil && b.end < len(p.toks) {
+		p.setEnd(b.owner, p.toks[b.end].end)
+	}
+	p.blocks = p.blocks[:len(p.blocks)-1]
+}
+
+func (p *parser) setEnd(def *lang.Def, end int) {
+	if end > def.End {
+		def.End = end
+	}
+}
+
+// ident handles an identifier that isn't a declaration keyword.
+func (p *parser) ident(i int) int {
+	t := p.toks[i]
+	if t.is("this") {
+		if path := p.thisPath(); path != "" {
+			p.thisAt[i] = path
+		}
+	}
+	if _, isDecl := p.declNames[i]; isDecl || keywords[t.text] {
+		return i
+	}
+	prev, next := p.tok(i-1), p.tok(i+1)
+	if prev.is(".") && p.tok(i-2).is("this") && !p.tok(i-3).is(".") && next.is("=") {
+		if p.thisMember(i); p.declNames[i] != nil {
+			return i
+		}
+	}
+	if prev.is(".") || prev.is("?.") {
+		p.addMemberUse(i)
+		return i // property access
+	}
+	b := p.block()
+	if b.kind == blockObject && (next.is(":") || next.is("(")) {
+		def := p.objectMember(i, b.object)
+		if next.is("(") {
+			// Method shorthand: { foo() { ... } }
+			return p.functionRest(i+1, def, nil)
+		}
+		return i // property key
+	}
+	if b.kind == blockClass && p.startsMember(i) {
+		return p.classMember(i)
+	}
+	if next.is("=>") {
+		// Single-parameter arrow function: x => ...
+		s := newScope(p.scope(), p.scope().path)
+		s.names[t.text] = nil
+		return p.arrowBody(i+1, s, i)
+	}
+	if next.is(".") && p.tok(i+2).is("prototype") && p.tok(i+3).is(".") && p.tok(i+4).kind == tokIdent && p.tok(i+5).is("=") {
+		// Foo.prototype.bar = function ...
+		def := p.addDef(p.tok(i+4), t.text+"/"+p.tok(i+4).text, "method", t.start)
+		p.declNames[i+4] = def
+		p.fnOwners[i+6] = def
+		p.setEnd(def, p.toks[p.exprEnd(i+6)].end)
+	}
+	p.uses = append(p.uses, use{tok: t, scope: p.scope(), enclosing: p.enclosing(), kind: p.useKind(i)})
+	return i
+}
+
+// startsObject reports whether the "{" at i starts an object literal (rather
+// than a block statement).
+func (p *parser) startsObject(i int) bool {
+	prev := p.tok(i - 1)
+	switch prev.kind {
+	case tokPunct:
+		switch prev.text {
+		case ")", "]", "}", ";", "=>":
+			return false
+		}
+		return prev.start >= 0
+	case tokIdent:
+		return prev.text == "return" || prev.text == "yield" || prev.text == "typeof"
+	}
+	return false
+}
+
+// addDef records a def named by tok. Unlike declare, it doesn't bind the name
+// in any scope.
+func (p *parser) addDef(tok token, path, kind string, start int) *lang.Def {
+	def := &lang.Def{
+		Name:  tok.text,
+		Path:  p.uniquePath(path),
+		Kind:  kind,
+		File:  p.file,
+		Start: start,
+		End:   tok.end,
+	}
+	p.defs = append(p.defs, def)
+	return def
+}
+
+func (p *parser) declare(s *scope, tok token, kind string, start int) *lang.Def {
+	if def, ok := s.names[tok.text]; ok && def != nil {
+		return def // redeclaration (e.g., "var x" twice)
+	}
+	def := p.addDef(tok, joinPath(s.path, tok.text), kind, start)
+	def.Scope = lang.ScopeLocal
+	if s.module {
+		def.Scope = lang.ScopeFile
+	}
+	s.names[tok.text] = def
+	return def
+}
+
+// uniquePath disambiguates paths of same-named defs in different anonymous
+// functions by appending "$2", "$3", etc.
+func (p *parser) uniquePath(path string) string {
+	unique := path
+	for n := 2; p.paths[unique]; n++ {
+		unique = path + "$" + strconv.Itoa(n)
+	}
+	p.paths[unique] = true
+	return unique
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+// function handles a function declaration or expression starting at the
+// "function" keyword at i, and returns the index of the last token of its
+// header.
+func (p *parser) function(i int) int {
+	start := p.toks[i].start
+	if p.tok(i - 1).is("async") {
+		start = p.tok(i - 1).start
+	}
+	owner := p.fnOwners[i]
+	if owner == nil && p.tok(i-1).is("async") {
+		owner = p.fnOwners[i-1]
+	}
+	j := i + 1
+	if p.tok(j).is("*") {
+		j++
+	}
+	if name := p.tok(j); name.kind == tokIdent && !keywords[name.text] {
+		if owner == nil {
+			owner = p.declare(p.scope(), name, "function", start)
+			owner.Exported = p.exported(i)
+		}
+		p.declNames[j] = owner
+		j++
+	}
+	if owner != nil {
+		owner.Callable = true
+	}
+	end := p.functionRest(p.typeParams(j), owner, nil)
+	if sig := p.sigs[owner]; sig != nil {
+		sig.async, sig.generator = p.tok(i-1).is("async"), p.tok(i+1).is("*")
+	}
+	if owner != nil && p.ts && !p.tok(end).is("{") {
+		p.setEnd(owner, p.toks[end].end) // overload signature or declaration
+	}
+	return end
+}
+
+// functionRest handles a function's parameter list (starting at the "(" at
+// i), return type and body, and returns the index of the "{" that starts the
+// body, or of the last token handled if there is no body (as in TypeScript
+// overload signatures). The body's scope is a child of the current scope
+// unless s is given.
+func (p *parser) functionRest(i int, owner *lang.Def, s *scope) int {
+	if !p.tok(i).is("(") {
+		return i - 1
+	}
+	if s == nil {
+		path := p.scope().path
+		if owner != nil {
+			path = owner.Path
+		}
+		s = newScope(p.scope(), path)
+	}
+	close := p.pair[i]
+	p.params(i, close, s)
+	body := close + 1
+	if owner != nil {
+		p.sigs[owner] = &signature{params: p.sigParams(i, close)}
+	}
+	if p.ts {
+		end := p.annotation(body, owner)
+		if owner != nil {
+			p.sigs[owner].ret = p.annotationText(body)
+		}
+		if !p.tok(end + 1).is("{") {
+			return end
+		}
+		body = end + 1
+	}
+	for body < len(p.toks) && !p.toks[body].is("{") && !p.toks[body].is(";") {
+		body++ // skip anything between the parameters and the body
+	}
+	if p.tok(body).is("{") {
+		p.blocks = append(p.blocks, &block{kind: blockFunc, end: p.pair[body], scope: s, owner: owner})
+		return body
+	}
+	return close
+}
+
+// params declares the parameters between the brackets at open and close in
+// s. Identifiers in default values are uses.
+func (p *parser) params(open, close int, s *scope) {
+	depth, defaultDepth := 0, -1
+	for j := open + 1; j < close; j++ {
+		t := p.toks[j]
+		switch {
+		case t.is("(") || t.is("[") || t.is("{"):
+			depth++
+		case t.is(")") || t.is("]") || t.is("}"):
+			if depth--; depth < defaultDepth {
+				defaultDepth = -1
+			}
+		case t.is("="):
+			if defaultDepth == -1 {
+				defaultDepth = depth
+			}
+		case t.is(",") && depth == defaultDepth:
+			defaultDepth = -1
+		case p.ts && t.is(":") && depth == 0 && defaultDepth == -1:
+			end := p.typeEnd(j + 1)
+			p.typeRefs(j+1, end, p.enclosing())
+			j = end
+		case p.ts && tsModifiers[t.text] && p.tok(j+1).kind == tokIdent:
+			// parameter property, as in constructor(private x: T)
+			if !tsModifiers[p.tok(j-1).text] {
+				p.paramProperty(open, j)
+			}
+		case t.kind == tokIdent && !keywords[t.text] && !p.tok(j-1).is("."):
+			switch {
+			case defaultDepth != -1:
+				p.uses = append(p.uses, use{tok: t, scope: p.scope(), enclosing: p.enclosing(), kind: lang.RefRead})
+			case p.tok(j+1).is(":") && depth > 0:
+				// key in a destructuring pattern
+			default:
+				s.names[t.text] = nil
+			}
+		}
+	}
+}
+
+// paramProperty declares the class property that a TypeScript constructor
+// parameter property (as in constructor(private x: T)), whose first
+// modifier is at i, declares. open is the index of the parameter list's "(".
+func (p *parser) paramProperty(open, i int) {
+	class := p.block()
+	if class.kind != blockClass || class.owner == nil || !p.tok(open-1).is("constructor") {
+		return
+	}
+	j := i
+	for tsModifiers[p.tok(j).text] && p.tok(j+1).kind == tokIdent {
+		j++
+	}
+	name := p.toks[j]
+	path := class.owner.Path + "/" + name.text
+	if p.members[path] != nil {
+		return
+	}
+	def := p.addDef(name, path, "property", p.toks[i].start)
+	p.markPrivate(def, i, j)
+	p.members[path] = def
+	p.declNames[j] = def
+
+	// The parameter ends at the next "," or ")" outside of brackets.
+	last := j
+	for k := j + 1; k < len(p.toks) && !p.toks[k].is(",") && !p.toks[k].is(")"); k++ {
+		if t := p.toks[k]; t.is("(") || t.is("[") || t.is("{") {
+			k = p.pair[k]
+		}
+		last = k
+	}
+	p.setEnd(def, p.toks[last].end)
+	colon := j + 1
+	if p.tok(colon).is("?") {
+		colon++
+	}
+	if p.tok(colon).is(":") {
+		def.Type = p.text(colon+1, p.typeEnd(colon+1))
+	}
+}
+
+// startsArrow reports whether the "(" at i starts the parameters of an arrow
+// function.
+func (p *parser) startsArrow(i int) bool {
+	next := p.pair[i] + 1
+	if p.ts && p.tok(next).is(":") {
+		next = p.typeEnd(next+1) + 1 // return type
+	}
+	return p.tok(next).is("=>")
+}
+
+// arrowParams handles the parenthesized parameters (and TypeScript return
+// type) of an arrow function starting at i, and returns the index of the last
+// token handled.
+func (p *parser) arrowParams(i int) int {
+	close := p.pair[i]
+	s := newScope(p.scope(), p.scope().path)
+	p.params(i, close, s)
+	return p.arrowBody(p.annotation(close+1, p.enclosing())+1, s, i)
+}
+
+// arrowBody handles the body of an arrow function whose "=>" is at i and
+// whose parameters start at start, and returns the index of the last token
+// handled.
+func (p *parser) arrowBody(i int, s *scope, start int) int {
+	if s == nil {
+		s = newScope(p.scope(), p.scope().path)
+	}
+	owner := p.arrowOwner(start)
+	if owner != nil {
+		owner.Callable = true
+		s.path = owner.Path
+		sig := &signature{async: p.tok(start - 1).is("async")}
+		if p.tok(start).is("(") {
+			sig.params = p.sigParams(start, p.pair[start])
+			sig.ret = p.annotationText(p.pair[start] + 1)
+		} else {
+			sig.params = []param{{name: p.toks[start].text}}
+		}
+		p.sigs[owner] = sig
+	}
+	if p.tok(i + 1).is("{") {
+		p.blocks = append(p.blocks, &block{kind: blockFunc, end: p.pair[i+1], scope: s, owner: owner, arrow: true})
+		return i + 1
+	}
+	end := p.exprEnd(i + 1)
+	if sig := p.sigs[owner]; sig != nil {
+		sig.returns = append(sig.returns, expr{start: i + 1, end: end, scope: s})
+	}
+	p.blocks = append(p.blocks, &block{kind: blockFunc, end: end, scope: s, owner: owner, arrow: true})
+	return i
+}
+
+// arrowOwner returns the def that the arrow function starting at start is
+// assigned to, if any.
+func (p *parser) arrowOwner(start int) *lang.Def {
+	if p.tok(start - 1).is("async") {
+		start--
+	}
+	return p.fnOwners[start]
+}
+
+// class handles a class declaration or expression starting at the "class"
+// keyword at i, and returns the index of the "{" that starts its body.
+func (p *parser) class(i int) int {
+	owner := p.fnOwners[i]
+	j := i + 1
+	if name := p.tok(j); name.kind == tokIdent && name.text != "extends" {
+		if owner == nil {
+			owner = p.declare(p.scope(), name, "class", p.toks[i].start)
+			owner.Exported = p.exported(i)
+		}
+		p.declNames[j] = owner
+		j++
+	}
+	for j < len(p.toks) && !p.toks[j].is("{") {
+		if close := p.angleClose(j); p.ts && p.toks[j].is("<") && close != -1 {
+			j = close // type parameters or arguments
+		}
+		j++ // superclass expression (and, in TypeScript, implemented interfaces)
+	}
+	if j >= len(p.toks) {
+		return i
+	}
+	if owner != nil {
+		owner.Callable = true
+		owner.Kind = "class"
+	}
+	path := p.scope().path
+	if owner != nil {
+		path = owner.Path
+	}
+	// Identifiers in the superclass expression (and implemented interfaces)
+	// are type uses in the outer scope.
+	for k := i + 1; k < j; k++ {
+		if _, isDecl := p.declNames[k]; !isDecl && p.toks[k].kind == tokIdent && !keywords[p.toks[k].text] {
+			p.uses = append(p.uses, use{tok: p.toks[k], scope: p.scope(), enclosing: p.enclosing(), kind: lang.RefType})
+		}
+	}
+	p.blocks = append(p.blocks, &block{kind: blockClass, end: p.pair[j], scope: newScope(p.scope(), path), owner: owner})
+	return j
+}
+
+// startsMember reports whether the identifier at i, directly inside a class
+// body, is a modifier or name at the start of a class member (rather than
+// part of a field initializer).
+func (p *parser) startsMember(i int) bool {
+	prev := p.tok(i - 1)
+	return prev.is("{") || prev.is("}") || prev.is(";") || prev.is("*") || classModifiers[prev.text] || p.toks[i].nl && !prev.is("=")
+}
+
+// classMember handles the start of a member directly inside a class body, and
+// returns the index of the last token handled.
+func (p *parser) classMember(i int) int {
+	t := p.toks[i]
+	if classModifiers[t.text] && p.tok(i+1).kind == tokIdent {
+		return i
+	}
+	b := p.block()
+	next := i + 1
+	if p.ts && p.tok(next).is("?") && (p.tok(next+1).is("(") || p.tok(next+1).is("<")) {
+		next++ // optional method
+	}
+	if p.ts && p.tok(next).is("<") {
+		next = p.typeParams(next)
+	}
+	if !p.tok(next).is("(") {
+		return p.classField(i, next, b.owner)
+	}
+	var def *lang.Def
+	if b.owner != nil {
+		path := b.owner.Path + "/" + t.text
+		if def = p.members[path]; def == nil {
+			def = p.addDef(t, path, "method", p.memberStart(i))
+			p.markPrivate(def, p.firstModifier(i), i)
+			if p.ts {
+				p.members[path] = def // overloads share a def
+			}
+		}
+		def.Callable = true
+		p.declNames[i] = def
+	}
+	s := newScope(b.scope, b.scope.path)
+	if def != nil {
+		s.path = def.Path
+	}
+	end := p.functionRest(next, def, s)
+	if sig := p.sigs[def]; sig != nil {
+		for j := i - 1; classModifiers[p.tok(j).text] || p.tok(j).is("*"); j-- {
+			sig.async = sig.async || p.tok(j).is("async")
+			sig.generator = sig.generator || p.tok(j).is("*")
+		}
+	}
+	if def != nil && !p.tok(end).is("{") {
+		p.setEnd(def, p.toks[end].end)
+	}
+	return end
+}
+
+// classField declares the field named at i (whose type annotation or
+// initializer, if any, starts at next) of the class owner, and returns the
+// index of the last token handled. The main loop handles the initializer.
+func (p *parser) classField(i, next int, owner *lang.Def) int {
+	end := p.annotation(next, owner)
+	if owner == nil {
+		return end
+	}
+	t := p.toks[i]
+	path := owner.Path + "/" + t.text
+	if p.members[path] != nil {
+		return end // also declared as a constructor parameter property
+	}
+	def := p.addDef(t, path, "property", p.memberStart(i))
+	p.markPrivate(def, p.firstModifier(i), i)
+	p.members[path] = def
+	p.declNames[i] = def
+	if typ := p.annotationText(next); typ != "" {
+		def.Type = typ
+	}
+	last := end
+	if p.tok(end + 1).is("=") {
+		last = p.exprEnd(end + 2)
+		p.fnOwners[end+2] = def
+		p.inits = append(p.inits, varInit{def, expr{start: end + 2, end: last, scope: p.scope()}})
+	}
+	if last < i {
+		last = i
+	}
+	p.setEnd(def, p.toks[last].end)
+	return end
+}
+
+// thisMember declares the member that "this.name = ..." (with the name at i)
+// assigns to in a constructor or method, unless it's already declared, as
+// Foo.prototype.bar assignments declare methods.
+func (p *parser) thisMember(i int) {
+	owner := p.thisPath()
+	if owner == "" {
+		return
+	}
+	path := owner + "/" + p.toks[i].text
+	if p.paths[path] {
+		return
+	}
+	kind := "property"
+	if p.tok(i+2).is("function") || p.tok(i+2).is("async") && p.tok(i+3).is("function") {
+		kind = "method"
+	}
+	def := p.addDef(p.toks[i], path, kind, p.toks[i-2].start)
+	end := p.exprEnd(i + 2)
+	p.setEnd(def, p.toks[end].end)
+	p.declNames[i] = def
+	p.fnOwners[i+2] = def
+	if kind == "property" {
+		p.inits = append(p.inits, varInit{def, expr{start: i + 2, end: end, scope: p.scope()}})
+	}
+}
+
+// objectMember declares the property whose key is at i in an object literal
+// assigned to obj, as in "const obj = { key: value }" or "{ key() { ... } }",
+// and returns its def. Unless the object is assigned to a def, its
+// properties aren't defs, and objectMember returns nil.
+func (p *parser) objectMember(i int, obj *lang.Def) *lang.Def {
+	if obj == nil || !p.tok(i-1).is("{") && !p.tok(i-1).is(",") {
+		return nil // not a key, as in { a: b ? c : d }
+	}
+	path := obj.Path + "/" + p.toks[i].text
+	if p.paths[path] {
+		return nil // a duplicate key
+	}
+	kind := "property"
+	if p.tok(i+1).is("(") || p.tok(i+2).is("function") || p.tok(i+2).is("async") && p.tok(i+3).is("function") {
+		kind = "method"
+	}
+	def := p.addDef(p.toks[i], path, kind, p.toks[i].start)
+	p.declNames[i] = def
+	if p.tok(i + 1).is("(") {
+		def.Callable = true
+		return def
+	}
+	end := p.exprEnd(i + 2)
+	p.setEnd(def, p.toks[end].end)
+	p.fnOwners[i+2] = def
+	if kind == "property" {
+		p.inits = append(p.inits, varInit{def, expr{start: i + 2, end: end, scope: p.scope()}})
+	}
+	return def
+}
+
+// memberStart returns the offset of the first modifier (e.g., "static") of
+// the class member named at i.
+func (p *parser) memberStart(i int) int {
+	return p.toks[p.firstModifier(i)].start
+}
+
+// firstModifier returns the index of the first modifier of the class member
+// named at i, or i if it has none.
+func (p *parser) firstModifier(i int) int {
+	for classModifiers[p.tok(i-1).text] || p.tok(i-1).is("*") {
+		i--
+	}
+	return i
+}
+
+// markPrivate records that def, a class member, is private if its modifiers,
+// the tokens from first to name (its name), include TypeScript's "private".
+func (p *parser) markPrivate(def *lang.Def, first, name int) {
+	for j := first; j < name; j++ {
+		if p.toks[j].is("private") {
+			p.private[def] = true
+		}
+	}
+}
+
+// varDecl handles a var, let or const declaration starting at i. It declares
+// each name and records where each declarator ends; the main loop then
+// handles the initializers.
+func (p *parser) varDecl(i int) {
+	keyword := p.toks[i]
+	s := p.scope()
+	start := keyword.start
+	for j := i + 1; j < len(p.toks); {
+		end := p.exprEnd(j)
+		name := p.toks[j]
+		next := j + 1 // after the name (or pattern) and type annotation
+		if name.is("{") || name.is("[") {
+			next = p.pair[j] + 1
+		}
+		switch {
+		case name.kind == tokIdent && !keywords[name.text]:
+			def := p.declare(s, name, "var", start)
+			def.Exported = def.Exported || p.exported(i)
+			p.declNames[j] = def
+			if typ := p.annotation(next, p.varEnclosing(def)); typ >= next {
+				p.declared[def] = p.annotationText(next)
+				next = typ + 1
+				end = typ
+				if p.tok(next).is("=") {
+					end = p.exprEnd(next)
+				}
+			}
+			p.setEnd(def, p.toks[end].end)
+			if p.tok(next).is("=") {
+				p.fnOwners[next+1] = def
+				p.inits = append(p.inits, varInit{def, expr{start: next + 1, end: end, scope: s}})
+			}
+			if len(p.blocks) == 1 {
+				p.topDecls = append(p.topDecls, declRange{def, j, end})
+			}
+		case name.is("{") || name.is("["):
+			p.pattern(j, p.pair[j], s, start)
+			if typ := p.annotation(next, p.enclosing()); typ >= next {
+				end = typ
+				if p.tok(typ + 1).is("=") {
+					end = p.exprEnd(typ + 1)
+				}
+			}
+		}
+		if !p.tok(end + 1).is(",") {
+			return
+		}
+		j = end + 2
+		start = p.tok(j).start
+	}
+}
+
+// varEnclosing returns the def that encloses refs in the declaration of def:
+// def itself at file level (as for refs in its initializer), or else the
+// enclosing function.
+func (p *parser) varEnclosing(def *lang.Def) *lang.Def {
+	if len(p.blocks) == 1 {
+		return def
+	}
+	return p.enclosing()
+}
+
+// pattern declares the names bound by a destructuring pattern between the
+// brackets at open and close.
+func (p *parser) pattern(open, close int, s *scope, start int) {
+	for j := open + 1; j < close; j++ {
+		t := p.toks[j]
+		if t.kind != tokIdent || keywords[t.text] || p.tok(j+1).is(":") || p.tok(j-1).is("=") {
+			continue
+		}
+		def := p.declare(s, t, "var", start)
+		p.declNames[j] = def
+		p.setEnd(def, p.toks[close].end)
+	}
+}
+
+// exprEnd returns the index of the last token of the expression (or
+// declarator) starting at i: the token before the next ",", ";" or closing
+// bracket at the same nesting level, or before an automatically inserted
+// semicolon.
+func (p *parser) exprEnd(i int) int {
+	for j := i; j < len(p.toks); j++ {
+		t := p.toks[j]
+		switch {
+		case t.is("(") || t.is("[") || t.is("{"):
+			j = p.pair[j]
+			continue
+		case t.is(",") || t.is(";") || t.is(")") || t.is("]") || t.is("}"):
+			if j == i {
+				return i
+			}
+			return j - 1
+		case p.ts && t.is("<"):
+			if close := p.typeArgsEnd(j); close != -1 {
+				j = close
+				continue
+			}
+		case p.ts && (t.is("as") || t.is("satisfies")) && j > i:
+			j = p.typeEnd(j + 1)
+			continue
+		}
+		if j > i && t.nl && endsExpr(p.toks[j-1]) && startsStatement(t) {
+			return j - 1
+		}
+	}
+	return len(p.toks) - 1
+}
+
+// endsExpr reports whether t can end an expression statement.
+func endsExpr(t token) bool {
+	switch t.kind {
+	case tokPunct:
+		return t.text == ")" || t.text == "]" || t.text == "}" || t.text == "++" || t.text == "--"
+	case tokIdent:
+		return !keywords[t.text] || t.text == "this" || t.text == "null" || t.text == "true" || t.text == "false"
+	}
+	return true
+}
+
+// startsStatement reports whether t can't continue the expression on the
+// previous line, so a semicolon is inserted before it.
+func startsStatement(t token) bool {
+	switch t.kind {
+	case tokPunct:
+		return t.text == "++" || t.text == "--" || t.text == "{"
+	case tokIdent:
+		return t.text != "in" && t.text != "instanceof"
+	}
+	return true
+}
+
+// resolve turns uses into refs to the defs they refer to. Uses of names that
+// aren't declared in the file (e.g., globals like "console") are dropped.
+func (p *parser) resolve() []*lang.Ref {
+	var refs []*lang.Ref
+	for _, u := range p.uses {
+		def, _ := u.scope.lookup(u.tok.text)
+		if def == nil {
+			continue
+		}
+		ref := &lang.Ref{DefPath: def.Path, File: p.file, Start: u.tok.start, End: u.tok.end, Kind: u.kind}
+		if u.enclosing != nil {
+			ref.Enclosing = u.enclosing.Path
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+var classModifiers = map[string]bool{
+	"static": true, "async": true, "get": true, "set": true,
+	// TypeScript
+	"public": true, "private": true, "protected": true, "readonly": true, "abstract": true,
+	"declare": true, "override": true, "accessor": true,
+}
+
+var keywords = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true,
+	"debugger": true, "default": true, "delete": true, "do": true, "else": true, "export": true,
+	"extends": true, "finally": true, "for": true, "function": true, "if": true, "import": true,
+	"in": true, "instanceof": true, "new": true, "return": true, "super": true, "switch": true,
+	"this": true, "throw": true, "try": true, "typeof": true, "var": true, "void": true,
+	"while": true, "with": true, "yield": true, "let": true, "static": true, "await": true,
+	"async": true, "of": true, "null": true, "true": true, "false": true, "undefined": true,
+	"arguments": true,
+}
@@ -0,0 +1,148 @@
+package javascript
+
+import (
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// assignOps are the operators that assign to their left operand.
+var assignOps = map[string]bool{
+	"=": true, "+=": true, "-=": true, "*=": true, "/=": true, "%=": true, "**=": true,
+	"<<=": true, ">>=": true, ">>>=": true, "&=": true, "|=": true, "^=": true,
+	"&&=": true, "||=": true, "??=": true,
+}
+
+// useKind returns how the identifier (or property name) at i is used: called,
+// assigned to, or read.
+func (p *parser) useKind(i int) string {
+	prev, next := p.tok(i-1), p.tok(i+1)
+	switch {
+	case next.is("(") || next.kind == tokTemplate || prev.is("new"):
+		return lang.RefCall // including tagged templates and "new Foo"
+	case p.ts && next.is("<") && p.typeArgsEnd(i+1) != -1:
+		return lang.RefCall // f<T>(x)
+	case next.kind == tokPunct && assignOps[next.text]:
+		return lang.RefWrite
+	case (next.is("++") || next.is("--")) && !next.nl, prev.is("++") || prev.is("--"):
+		return lang.RefWrite
+	}
+	return lang.RefRead
+}
+
+// setScopes sets the Scope of each def, and sets Exported to match it.
+// Exported defs are exported; defs declared in a scope already have the scope
+// that declare gave them; and members (of classes, interfaces, etc.) have the
+// scope of the def they're members of, except that private class members
+// aren't visible outside the file.
+func (p *parser) setScopes() {
+	byPath := make(map[string]*lang.Def, len(p.defs))
+	for _, def := range p.defs {
+		byPath[def.Path] = def
+	}
+	var scopeOf func(def *lang.Def) string
+	scopeOf = func(def *lang.Def) string {
+		if def.Exported {
+			return lang.ScopeExported
+		}
+		if def.Scope != "" {
+			return def.Scope
+		}
+		def.Scope = lang.ScopeFile
+		if i := strings.LastIndex(def.Path, "/"); i != -1 {
+			if owner := byPath[def.Path[:i]]; owner != nil {
+				def.Scope = scopeOf(owner)
+			}
+		}
+		if p.private[def] && (def.Scope == lang.ScopeExported || def.Scope == lang.ScopePackage) {
+			def.Scope = lang.ScopeFile
+		}
+		return def.Scope
+	}
+	for _, def := range p.defs {
+		def.Scope = scopeOf(def)
+		def.Exported = def.Scope == lang.ScopeExported
+	}
+}
+
+// declRefs returns refs from the names in declarations to the defs they
+// declare.
+func (p *parser) declRefs() []*lang.Ref {
+	var refs []*lang.Ref
+	for i, t := range p.toks {
+		if def := p.declNames[i]; def != nil {
+			refs = append(refs, &lang.Ref{DefPath: def.Path, File: p.file, Start: t.start, End: t.end, Enclosing: def.Path, Kind: lang.RefDecl})
+		}
+	}
+	return refs
+}
+
+// imports returns refs to the names that ES module import (and re-export)
+// declarations import from other modules. DefPkg is the module specifier as
+// written (e.g., "./util" or "react"), and DefPath is the imported name:
+// "default" for default imports, or empty for namespace imports and imports
+// for side effects only, which import the module as a whole.
+func (p *parser) imports() []*lang.Ref {
+	var refs []*lang.Ref
+	for i := 0; i < len(p.toks); i++ {
+		t := p.toks[i]
+		if !t.is("import") && !t.is("export") || p.tok(i-1).is(".") {
+			continue
+		}
+		j := i + 1
+		if p.tok(j).is("type") && !p.tok(j+1).is("from") && !p.tok(j+1).is(",") {
+			j++ // TypeScript's import type
+		}
+		if close, ok := p.pair[j]; t.is("export") && !(p.tok(j).is("*") || p.tok(j).is("{") && ok && p.tok(close+1).is("from")) {
+			continue // an exported declaration
+		}
+
+		var names []token // imported names, with "default" for default imports
+		module := -1
+	clause:
+		for ; j < len(p.toks); j++ {
+			switch tj := p.toks[j]; {
+			case tj.kind == tokString:
+				module = j
+				break clause
+			case tj.is("{"):
+				close, ok := p.pair[j]
+				if !ok {
+					break clause
+				}
+				for k := j + 1; k < close; k++ {
+					name := p.toks[k]
+					if (name.is("type") || name.is("as")) && p.tok(k+1).kind == tokIdent || name.kind != tokIdent && name.kind != tokString {
+						continue
+					}
+					if !p.tok(k - 1).is("as") {
+						names = append(names, name)
+					}
+				}
+				j = close
+			case tj.is("*") && p.tok(j+1).is("as"):
+				j += 2 // a namespace import, of the module as a whole
+			case tj.is("*") || tj.is(",") || tj.is("from"):
+			case tj.kind == tokIdent && t.is("import"):
+				def := tj
+				def.text = "default"
+				names = append(names, def)
+			default:
+				break clause // not an import declaration, as in "import x = require(...)"
+			}
+		}
+		if module == -1 {
+			continue
+		}
+		pkg := strings.Trim(p.toks[module].text, "\"'")
+		if len(names) == 0 || p.tok(i+1).is("*") || p.tok(module-3).is("*") {
+			m := p.toks[module]
+			refs = append(refs, &lang.Ref{DefPkg: pkg, File: p.file, Start: m.start, End: m.end, Kind: lang.RefImport})
+		}
+		for _, name := range names {
+			refs = append(refs, &lang.Ref{DefPkg: pkg, DefPath: strings.Trim(name.text, "\"'"), File: p.file, Start: name.start, End: name.end, Kind: lang.RefImport})
+		}
+		i = module
+	}
+	return refs
+}
@@ -0,0 +1,270 @@
+package javascript
+
+import (
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+type tokKind int
+
+const (
+	tokIdent tokKind = iota // identifiers and keywords
+	tokNumber
+	tokString
+	tokTemplate
+	tokRegexp
+	tokPunct
+	tokJSX // the start or end of a JSX element
+)
+
+type token struct {
+	kind       tokKind
+	text       string
+	start, end int  // byte offsets in the source
+	nl         bool // preceded by a line break
+	sub        bool // a template literal piece followed by a ${...} substitution
+}
+
+func (t token) is(text string) bool {
+	return (t.kind == tokIdent || t.kind == tokPunct) && t.text == text
+}
+
+// puncts lists multi-character punctuators, longest first within each prefix.
+var puncts = []string{
+	">>>=", "...", "===", "!==", "**=", "<<=", ">>=", ">>>", "&&=", "||=", "??=",
+	"=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--", "+=", "-=", "*=", "/=", "%=",
+	"&=", "|=", "^=", "<<", ">>", "**",
+}
+
+// regexpPrecedes lists keywords after which a "/" starts a regexp literal
+// rather than a division.
+var regexpPrecedes = map[string]bool{
+	"return": true, "typeof": true, "case": true, "do": true, "else": true, "in": true,
+	"instanceof": true, "new": true, "delete": true, "void": true, "throw": true, "yield": true,
+	"await": true,
+}
+
+// tokenize splits JavaScript source (the contents of file) into tokens,
+// skipping whitespace and comments. It is deliberately forgiving: anything it
+// doesn't understand becomes a single-character punctuator, and unterminated
+// comments, literals and JSX elements extend to the end of the source (and
+// are reported as diagnostics). If jsx is set, JSX elements are recognized
+// (see jsxElement).
+func tokenize(file string, src []byte, jsx bool) ([]token, lang.Diagnostics) {
+	z := &tokenizer{file: file, s: string(src), jsx: jsx}
+	z.js(false)
+	return z.toks, z.diags
+}
+
+type tokenizer struct {
+	file  string
+	s     string
+	i     int
+	toks  []token
+	nl    bool // a line break precedes the next token
+	jsx   bool
+	diags lang.Diagnostics
+}
+
+// unterminated records a diagnostic about the unterminated comment, literal
+// or element what, from offset start to end.
+func (z *tokenizer) unterminated(what string, start, end int) {
+	z.diags = append(z.diags, &lang.Diagnostic{File: z.file, Start: start, End: end, Message: "unterminated " + what})
+}
+
+func (z *tokenizer) emit(kind tokKind, text string, start, end int) {
+	z.toks = append(z.toks, token{kind: kind, text: text, start: start, end: end, nl: z.nl})
+	z.nl = false
+}
+
+// js scans JavaScript tokens. If inBraces is set, it stops at (without
+// consuming) the "}" that closes the enclosing "{".
+func (z *tokenizer) js(inBraces bool) {
+	s := z.s
+	depth := 0
+	for z.i < len(s) {
+		i := z.i
+		c := s[i]
+		switch {
+		case c == '\n':
+			z.nl = true
+			z.i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			z.i++
+			continue
+		case strings.HasPrefix(s[i:], "//"):
+			for z.i < len(s) && s[z.i] != '\n' {
+				z.i++
+			}
+			continue
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end == -1 {
+				z.unterminated("comment", i, len(s))
+				end = len(s) - i - 4
+			}
+			if strings.Contains(s[i:i+end+4], "\n") {
+				z.nl = true
+			}
+			z.i += end + 4
+			continue
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth == 0 && inBraces {
+				return
+			}
+			depth--
+		case c == '<' && z.jsx && z.startsJSX():
+			z.jsxElement()
+			continue
+		}
+
+		start := i
+		kind := tokPunct
+		switch {
+		case isIdentStart(c):
+			kind = tokIdent
+			for i < len(s) && isIdentPart(s[i]) {
+				i++
+			}
+		case isDigit(c) || (c == '.' && i+1 < len(s) && isDigit(s[i+1])):
+			kind = tokNumber
+			for i < len(s) && (isIdentPart(s[i]) || s[i] == '.') {
+				i++
+			}
+		case c == '"' || c == '\'':
+			kind = tokString
+			var ok bool
+			if i, ok = skipQuoted(s, i, c); !ok {
+				z.unterminated("string literal", start, i)
+			}
+		case c == '`':
+			z.template()
+			continue
+		case c == '/' && slashStartsRegexp(z.toks):
+			kind = tokRegexp
+			i = skipRegexp(s, i)
+		default:
+			i++
+			for _, p := range puncts {
+				if strings.HasPrefix(s[start:], p) {
+					i = start + len(p)
+					break
+				}
+			}
+		}
+		z.emit(kind, s[start:i], start, i)
+		z.i = i
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool { return isIdentStart(c) || isDigit(c) }
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// skipQuoted returns the offset just past the string literal starting at i,
+// and whether the literal is terminated (before the end of the line).
+func skipQuoted(s string, i int, quote byte) (int, bool) {
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1, true
+		case '\n':
+			return i, false
+		}
+	}
+	return len(s), false
+}
+
+// template scans the template literal starting at the "`" at z.i. The text
+// of a literal without substitutions is a single tokTemplate token. A
+// literal with substitutions is emitted as the concatenation it evaluates
+// to, so that the parser sees the substituted expressions: `a ${x} b`
+// becomes the tokens
+//
+//	`a   +   (   x   )   +   b`
+//
+// where the tokTemplate pieces ("`a " and " b`") have sub set if a
+// substitution follows them, "+(" are at the "${" and ")" is at the "}"
+// (the second "+" is empty, just after it).
+func (z *tokenizer) template() {
+	s := z.s
+	start, first := z.i, z.i
+	for i := z.i + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '`':
+			z.emit(tokTemplate, s[start:i+1], start, i+1)
+			z.i = i + 1
+			return
+		case strings.HasPrefix(s[i:], "${"):
+			z.emit(tokTemplate, s[start:i], start, i)
+			z.toks[len(z.toks)-1].sub = true
+			z.emit(tokPunct, "+", i, i+1)
+			z.emit(tokPunct, "(", i+1, i+2)
+			z.i = i + 2
+			z.js(true)
+			if z.i >= len(s) {
+				z.unterminated("template literal", first, len(s))
+				return
+			}
+			z.nl = false
+			z.emit(tokPunct, ")", z.i, z.i+1)
+			z.emit(tokPunct, "+", z.i+1, z.i+1)
+			start = z.i + 1
+			i = z.i
+		}
+	}
+	z.emit(tokTemplate, s[start:], start, len(s))
+	z.unterminated("template literal", first, len(s))
+	z.i = len(s)
+}
+
+func skipRegexp(s string, i int) int {
+	inClass := false
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				for i++; i < len(s) && isIdentPart(s[i]); i++ {
+				}
+				return i
+			}
+		case '\n':
+			return i
+		}
+	}
+	return len(s)
+}
+
+// slashStartsRegexp reports whether a "/" following toks begins a regexp
+// literal (as opposed to a division operator).
+func slashStartsRegexp(toks []token) bool {
+	if len(toks) == 0 {
+		return true
+	}
+	prev := toks[len(toks)-1]
+	switch prev.kind {
+	case tokIdent:
+		return regexpPrecedes[prev.text]
+	case tokPunct:
+		return prev.text != ")" && prev.text != "]" && prev.text != "}"
+	}
+	return false
+}
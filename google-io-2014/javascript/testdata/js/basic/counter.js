@@ -0,0 +1,38 @@
+// A counter, as a fixture for the JavaScript analyzer.
+function Counter(start) {
+  this.n = start;
+}
+
+Counter.prototype.inc = function () {
+  this.n++;
+  return this;
+};
+
+class Timer {
+  constructor(ms) {
+    this.ms = ms;
+  }
+  start(cb) {
+    return setTimeout(cb, this.ms);
+  }
+}
+
+const c = new Counter(1).inc();
+const t = new Timer(c.n);
+t.start(function () {});
+
+module.exports = { Counter, Timer };
+
+const clock = {
+  ticks: 0,
+  tick() {
+    this.ticks++;
+    return this;
+  },
+  reset: function () {
+    this.ticks = 0;
+  },
+};
+clock.tick().tick();
+clock.reset();
+new Timer(clock.ticks).start(function () {});
@@ -0,0 +1,9 @@
+import { Counter } from "./counter";
+
+export function count(n) {
+  const c = new Counter(0);
+  for (let i = 0; i < n; i++) {
+    c.inc();
+  }
+  return `counted ${c.n} of ${n}`;
+}
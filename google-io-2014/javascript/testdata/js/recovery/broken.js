@@ -0,0 +1,13 @@
+// Syntax errors are reported as diagnostics, and the rest of the file is
+// still analyzed.
+function ok() {
+  return 1;
+}
+
+function unclosed() {
+  const s = "no end quote;
+  return ok(;
+}
+
+function later() {
+  return `never closed ${ok()}
@@ -0,0 +1,10 @@
+declare module "left-pad" {
+  function leftPad(s: string, n: number): string;
+  export = leftPad;
+}
+
+declare global {
+  interface Window {
+    app: string;
+  }
+}
@@ -0,0 +1,25 @@
+// Shapes, as a fixture for the TypeScript analyzer.
+export interface Shape {
+  area(): number;
+}
+
+export class Rect implements Shape {
+  private label = "rect";
+  constructor(public w: number, public h: number) {}
+  area(): number {
+    return this.w * this.h;
+  }
+}
+
+export enum Color { Red, Green }
+
+export namespace Util {
+  export function square(n: number): Rect {
+    return new Rect(n, n);
+  }
+}
+
+export type Pair<T> = [T, T];
+
+const r = <Rect>Util.square(2);
+export const a = r.area();
@@ -0,0 +1,6 @@
+// A const enum, which isn't a const declaration.
+export const enum Dir { Up, Down }
+
+declare const enum Mode { Read = 1, Write = 2 }
+
+export const d = Dir.Up;
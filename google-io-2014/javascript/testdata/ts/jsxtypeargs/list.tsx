@@ -0,0 +1,12 @@
+// A JSX element with type arguments, followed by more defs.
+function List<T>(props: { items: T[] }) {
+  return <ul>{props.items.length}</ul>;
+}
+
+export function App() {
+  return <List<string> items={["a"]} />;
+}
+
+export function after(): number {
+  return 1;
+}
@@ -0,0 +1,9 @@
+// A namespace with a dotted name declares namespaces in namespaces.
+namespace Geo.Units.Metric {
+  export const meter = 1;
+  export function km(n: number): number { return n * 1000 * meter; }
+}
+
+namespace Geo {
+  export const origin = 0;
+}
@@ -0,0 +1,8 @@
+// Constructor parameter properties declare class properties.
+export class Point {
+  constructor(public readonly x: number, private y?: number, z = 0) {}
+
+  norm(): number {
+    return this.x + (this.y || 0);
+  }
+}
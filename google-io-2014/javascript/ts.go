@@ -0,0 +1,525 @@
+package javascript
+
+import (
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// TypeScript support. Types are skipped over by the parser: identifiers in
+// them are recorded as uses (so that refs to interfaces, type aliases,
+// classes and enums are found), but nothing in a type declares a def or opens
+// a block. Type declarations (interfaces, type aliases, enums and
+// namespaces) become defs with those kinds.
+
+// dialect returns whether file is TypeScript and whether it may contain JSX,
+// from its name. JSX is allowed everywhere except in .ts files, where "<T>x"
+// is a type assertion.
+func dialect(file string) (ts, jsx bool) {
+	switch {
+	case strings.HasSuffix(file, ".tsx"):
+		return true, true
+	case strings.HasSuffix(file, ".ts") || strings.HasSuffix(file, ".mts") || strings.HasSuffix(file, ".cts"):
+		return true, false
+	}
+	return false, true
+}
+
+// tsModifiers are the modifiers that can precede parameter properties and
+// interface members.
+var tsModifiers = map[string]bool{
+	"public": true, "private": true, "protected": true, "readonly": true, "override": true,
+}
+
+// typePrefixes are the keywords that can precede a type.
+var typePrefixes = map[string]bool{
+	"keyof": true, "typeof": true, "readonly": true, "infer": true, "unique": true, "new": true,
+	"asserts": true, "abstract": true,
+}
+
+// typeKeywords are the words in types that aren't type names.
+var typeKeywords = map[string]bool{
+	"keyof": true, "infer": true, "readonly": true, "unique": true, "is": true, "asserts": true,
+	"extends": true, "as": true, "satisfies": true, "abstract": true,
+}
+
+// tsDeclaration handles a TypeScript declaration (interface, type alias, enum
+// or namespace) starting at the identifier at i, if there is one. It returns
+// the index of the last token handled.
+func (p *parser) tsDeclaration(i int) (int, bool) {
+	t, name := p.toks[i], p.tok(i+1)
+	if name.kind != tokIdent || keywords[name.text] || name.nl {
+		switch {
+		case (t.is("module") || t.is("namespace")) && name.kind == tokString:
+			return p.ambientModule(i), true // declare module "foo" { ... }
+		case t.is("global") && name.is("{") && p.tok(i-1).is("declare"):
+			return p.namespace(i, nil), true // declare global { ... }
+		}
+		return i, false
+	}
+	start := p.declStart(i)
+	switch {
+	case t.is("interface"):
+		def := p.tsDef(i, "interface", start)
+		k := p.typeParams(i + 2)
+		j := k
+		for j < len(p.toks) && !p.toks[j].is("{") {
+			j++ // extends clause
+		}
+		p.typeRefs(k, j-1, def)
+		if j >= len(p.toks) {
+			return j, true
+		}
+		close := p.typeMembers(j, def)
+		p.setEnd(def, p.toks[close].end)
+		return close, true
+
+	case t.is("type") && (p.tok(i+2).is("=") || p.tok(i+2).is("<")):
+		def := p.tsDef(i, "type", start)
+		j := p.typeParams(i + 2)
+		if !p.tok(j).is("=") {
+			return j - 1, true
+		}
+		end := p.typeEnd(j + 1)
+		p.typeRefs(j+1, end, def)
+		if end > j {
+			def.Type = p.text(j+1, end)
+			p.setEnd(def, p.toks[end].end)
+		}
+		return end, true
+
+	case t.is("enum") && p.tok(i+2).is("{"):
+		def := p.tsDef(i, "enum", start)
+		return p.enumBody(i+2, def), true
+
+	case (t.is("namespace") || t.is("module")):
+		j := i + 1
+		for p.tok(j+1).is(".") && p.tok(j+2).kind == tokIdent {
+			j += 2 // namespace A.B.C
+		}
+		if !p.tok(j + 1).is("{") {
+			return i, false
+		}
+		def := p.tsDef(i, "namespace", start)
+		// In "namespace A.B { ... }", B is an exported namespace in A.
+		end := p.toks[p.pair[j+1]].end
+		for k := i + 3; k <= j; k += 2 {
+			p.setEnd(def, end)
+			def = p.member(p.toks[k], def, "namespace", start, end)
+			def.Exported = true
+			p.declNames[k] = def
+		}
+		return p.namespace(j, def), true
+	}
+	return i, false
+}
+
+// declStart returns the offset of the start of the declaration whose keyword
+// is at i, including "declare", "abstract" or "const" (as in "const enum").
+func (p *parser) declStart(i int) int {
+	for p.tok(i-1).is("declare") || p.tok(i-1).is("abstract") || p.tok(i-1).is("const") {
+		i--
+	}
+	return p.toks[i].start
+}
+
+// tsDef declares the type declaration whose keyword is at i and name is at
+// i+1.
+func (p *parser) tsDef(i int, kind string, start int) *lang.Def {
+	def := p.declare(p.scope(), p.toks[i+1], kind, start)
+	def.Exported = def.Exported || p.exported(i)
+	p.declNames[i+1] = def
+	return def
+}
+
+// ambientModule handles an ambient module declaration (declare module "foo"
+// { ... }) whose keyword is at i. The module is an exported def, named by its
+// module specifier, and the defs in its body are its members rather than
+// file-level defs.
+func (p *parser) ambientModule(i int) int {
+	name := p.toks[i+1]
+	name.text = name.text[1 : len(name.text)-1]
+	def := p.addDef(name, joinPath(p.scope().path, name.text), "module", p.declStart(i))
+	def.Exported = true
+	p.declNames[i+1] = def
+	open := p.namespace(i+1, def)
+	if p.toks[open].is("{") {
+		p.ambient[open] = p.scope()
+	}
+	return open
+}
+
+// namespace handles the body of a namespace (or module) whose name ends at i.
+// Defs in the body are members of def, if any.
+func (p *parser) namespace(i int, def *lang.Def) int {
+	open := i + 1
+	if !p.tok(open).is("{") {
+		return i
+	}
+	path := p.scope().path
+	if def != nil {
+		path = def.Path
+	}
+	s := newScope(p.scope(), path)
+	s.module = true
+	p.blocks = append(p.blocks, &block{kind: blockFunc, end: p.pair[open], scope: s, owner: def})
+	return open
+}
+
+// typeMembers handles the members of an interface (or object type) whose
+// body starts at the "{" at open, declaring them as members of owner. It
+// returns the index of the closing "}".
+func (p *parser) typeMembers(open int, owner *lang.Def) int {
+	close := p.pair[open]
+	for j := open + 1; j < close; {
+		if p.toks[j].is(";") || p.toks[j].is(",") {
+			j++
+			continue
+		}
+		start := j
+		for (tsModifiers[p.toks[j].text] || p.toks[j].is("get") || p.toks[j].is("set")) && p.tok(j+1).kind == tokIdent && !p.tok(j+1).nl {
+			j++
+		}
+		name := p.toks[j]
+		k := j + 1
+		if p.tok(k).is("?") {
+			k++
+		}
+		var end int
+		switch {
+		case (name.kind == tokIdent || name.kind == tokString) && (p.tok(k).is("(") || p.tok(k).is("<")):
+			sig := k
+			k = p.typeParams(k)
+			end = k
+			if p.tok(k).is("(") {
+				end = p.pair[k]
+				p.typeRefs(k+1, end-1, owner)
+				end = p.annotationOr(end+1, owner, end)
+			}
+			def := p.member(name, owner, "method", p.toks[start].start, p.toks[end].end)
+			def.Callable = true
+			p.declNames[j] = def
+			def.Type = p.text(sig, end)
+		case (name.kind == tokIdent || name.kind == tokString) && p.tok(k).is(":"):
+			end = p.typeEnd(k + 1)
+			p.typeRefs(k+1, end, owner)
+			def := p.member(name, owner, "property", p.toks[start].start, p.toks[end].end)
+			def.Type = p.text(k+1, end)
+			p.declNames[j] = def
+		default:
+			// Call, construct and index signatures.
+			end = j
+			if p.tok(end).is("new") {
+				end++
+			}
+			end = p.typeParams(end)
+			if p.tok(end).is("(") || p.tok(end).is("[") {
+				close := p.pair[end]
+				p.typeRefs(j, close, owner)
+				end = p.annotationOr(close+1, owner, close)
+			}
+		}
+		if end < j {
+			end = j
+		}
+		j = end + 1
+	}
+	return close
+}
+
+// member declares the member of owner named by tok, or returns the existing
+// def if there is one (interfaces may be declared several times, and methods
+// may have several overloaded signatures).
+func (p *parser) member(tok token, owner *lang.Def, kind string, start, end int) *lang.Def {
+	if tok.kind == tokString {
+		tok.text = strings.Trim(tok.text, `"'`)
+	}
+	path := owner.Path + "/" + tok.text
+	if def := p.members[path]; def != nil {
+		p.setEnd(def, end)
+		return def
+	}
+	def := p.addDef(tok, path, kind, start)
+	def.End = end
+	p.members[path] = def
+	return def
+}
+
+// enumBody declares the members of the enum whose body starts at the "{" at
+// open, and returns the index of the closing "}".
+func (p *parser) enumBody(open int, owner *lang.Def) int {
+	close := p.pair[open]
+	for j := open + 1; j < close; j++ {
+		t := p.toks[j]
+		switch {
+		case (t.kind == tokIdent || t.kind == tokString) && (p.tok(j-1).is("{") || p.tok(j-1).is(",")):
+			end := p.exprEnd(j)
+			def := p.member(t, owner, "member", t.start, p.toks[end].end)
+			p.declNames[j] = def
+			if p.tok(j + 1).is("=") {
+				p.inits = append(p.inits, varInit{def, expr{start: j + 2, end: end, scope: p.scope()}})
+			} else {
+				def.Type = "number" // auto-incremented
+			}
+		case t.kind == tokIdent && !keywords[t.text] && !p.tok(j-1).is("."):
+			p.uses = append(p.uses, use{tok: t, scope: p.scope(), enclosing: owner, kind: lang.RefRead})
+		}
+	}
+	p.setEnd(owner, p.toks[close].end)
+	return close
+}
+
+// annotation handles the type annotation (": T", "?: T" or "!: T") starting
+// at i, if any, and returns the index of its last token, or i-1 if there is
+// none. Refs in the type are enclosed by enclosing.
+func (p *parser) annotation(i int, enclosing *lang.Def) int {
+	return p.annotationOr(i, enclosing, i-1)
+}
+
+func (p *parser) annotationOr(i int, enclosing *lang.Def, none int) int {
+	if !p.ts {
+		return none
+	}
+	j := i
+	if (p.tok(j).is("?") || p.tok(j).is("!")) && p.tok(j+1).is(":") {
+		j++
+	}
+	if !p.tok(j).is(":") {
+		return none
+	}
+	end := p.typeEnd(j + 1)
+	p.typeRefs(j+1, end, enclosing)
+	return end
+}
+
+// annotationText returns the text of the type in the type annotation
+// starting at i, which annotation has already handled, or "" if there is
+// none.
+func (p *parser) annotationText(i int) string {
+	if (p.tok(i).is("?") || p.tok(i).is("!")) && p.tok(i+1).is(":") {
+		i++
+	}
+	if !p.ts || !p.tok(i).is(":") {
+		return ""
+	}
+	if end, ok := p.types[i+1]; ok {
+		return p.text(i+1, end)
+	}
+	return ""
+}
+
+// typeParams handles the type parameter list (or type argument list)
+// starting at the "<" at i, if any, and returns the index of the token after
+// it (i if there is none).
+func (p *parser) typeParams(i int) int {
+	if !p.ts || !p.tok(i).is("<") {
+		return i
+	}
+	close := p.angleClose(i)
+	if close == -1 {
+		return i
+	}
+	p.typeRefs(i+1, close-1, p.enclosing())
+	return close + 1
+}
+
+// typeRefs records the type names in the tokens from start to end
+// (inclusive) as uses, and marks the tokens as a type so that the main loop
+// skips them.
+func (p *parser) typeRefs(start, end int, enclosing *lang.Def) {
+	if end < start {
+		return
+	}
+	p.types[start] = end
+	for j := start; j <= end; j++ {
+		t := p.toks[j]
+		if t.kind != tokIdent || keywords[t.text] || typeKeywords[t.text] {
+			continue
+		}
+		prev, next := p.tok(j-1), p.tok(j+1)
+		switch {
+		case prev.is(".") || prev.is("infer"):
+			continue // member of a qualified name, or a type variable
+		case (next.is(":") || next.is("?") && (p.tok(j+2).is(":") || p.tok(j+2).is("("))) && startsKey(prev, t):
+			continue // property or parameter name
+		case next.is("in") || next.is("is"):
+			continue // mapped type key or type predicate parameter
+		case next.is("(") && (prev.is("{") || prev.is(";") || prev.is(",")):
+			continue // method signature in an object type
+		}
+		p.uses = append(p.uses, use{tok: t, scope: p.scope(), enclosing: enclosing, kind: lang.RefType})
+	}
+}
+
+// typeEnd returns the index of the last token of the type starting at i, or
+// i-1 if no type starts there.
+func (p *parser) typeEnd(i int) int {
+	operand := false // just after a complete type operand
+	conds, colons := 0, 0
+	for j := i; j < len(p.toks); j++ {
+		t := p.toks[j]
+		if !operand {
+			switch {
+			case t.is("|") || t.is("&") || t.is("-"):
+				continue // leading union or intersection, or negative literal
+			case t.kind == tokIdent && typePrefixes[t.text] && p.startsType(j+1):
+				continue
+			case t.is("("):
+				close := p.pair[j]
+				if p.tok(close + 1).is("=>") {
+					j = close + 1 // function type; the result type follows
+					continue
+				}
+				j = close
+			case t.is("[") || t.is("{"):
+				j = p.pair[j]
+			case t.is("<"):
+				// Type parameters of a generic function type.
+				close := p.angleClose(j)
+				if close == -1 {
+					return j - 1
+				}
+				j = close
+				continue
+			case t.kind == tokTemplate:
+				j = p.templateEnd(j) // a template literal type, as in `id-${T}`
+			case t.kind == tokIdent || t.kind == tokString || t.kind == tokNumber:
+			default:
+				return j - 1
+			}
+			operand = true
+			continue
+		}
+
+		switch {
+		case t.is(".") || t.is("|") || t.is("&"):
+			operand = false
+		case t.is("[") && !t.nl:
+			j = p.pair[j] // array type or indexed access
+		case t.is("<") && !t.nl && p.tok(j-1).kind == tokIdent:
+			close := p.angleClose(j)
+			if close == -1 {
+				return j - 1
+			}
+			j = close
+		case t.is("extends") && !t.nl:
+			conds++ // conditional type
+			operand = false
+		case t.is("?") && conds > 0:
+			conds--
+			colons++
+			operand = false
+		case t.is(":") && colons > 0:
+			colons--
+			operand = false
+		case t.is("is") && !t.nl:
+			operand = false // type predicate
+		default:
+			return j - 1
+		}
+	}
+	return len(p.toks) - 1
+}
+
+// startsKey reports whether t, which precedes a ":", is a property or
+// parameter name (rather than, say, a type in a conditional type).
+func startsKey(prev, t token) bool {
+	return t.nl || prev.is("{") || prev.is(";") || prev.is(",") || prev.is("(") || prev.is("...") || tsModifiers[prev.text]
+}
+
+func (p *parser) startsType(i int) bool {
+	t := p.tok(i)
+	switch t.kind {
+	case tokIdent, tokString, tokNumber, tokTemplate:
+		return true
+	case tokPunct:
+		return t.text == "(" || t.text == "[" || t.text == "{" || t.text == "<" || t.text == "-"
+	}
+	return false
+}
+
+// angleClose returns the index of the ">" that closes the "<" at i, or -1 if
+// the tokens after i can't be a type parameter or argument list.
+func (p *parser) angleClose(i int) int {
+	depth := 0
+	for j := i; j < len(p.toks); j++ {
+		t := p.toks[j]
+		if t.kind != tokPunct {
+			continue
+		}
+		switch t.text {
+		case "<":
+			depth++
+		case ">":
+			depth--
+		case ">>":
+			depth -= 2
+		case ">>>":
+			depth -= 3
+		case "(", "[", "{":
+			j = p.pair[j]
+		case ";", "&&", "||", ")", "]", "}":
+			return -1
+		}
+		if depth <= 0 {
+			return j
+		}
+	}
+	return -1
+}
+
+// typeArgs handles a "<" in an expression, which may start type arguments
+// (as in "f<T>(x)") or the type parameters of a generic arrow function (as in
+// "<T>(x: T) => x"). It returns the index of the last token handled.
+func (p *parser) typeArgs(i int) int {
+	if close := p.typeArgsEnd(i); close != -1 {
+		p.typeRefs(i+1, close-1, p.enclosing())
+		return close
+	}
+	if endsExpr(p.tok(i - 1)) {
+		return i // less-than operator
+	}
+	close := p.angleClose(i)
+	if close == -1 || !p.tok(close+1).is("(") || !p.startsArrow(close+1) {
+		return i
+	}
+	p.typeRefs(i+1, close-1, p.enclosing())
+	if owner := p.arrowOwner(i); owner != nil {
+		p.fnOwners[close+1] = owner
+	}
+	return close
+}
+
+// typeArgsEnd returns the index of the ">" that closes the type arguments of
+// a call (as in "f<T>(x)" or "new Map<K, V>()") starting at the "<" at i, or
+// -1 if the "<" is a less-than operator.
+func (p *parser) typeArgsEnd(i int) int {
+	if prev := p.tok(i - 1); prev.kind != tokIdent || keywords[prev.text] {
+		return -1
+	}
+	close := p.angleClose(i)
+	if close == -1 {
+		return -1
+	}
+	if next := p.tok(close + 1); next.is("(") || next.kind == tokTemplate {
+		return close
+	}
+	return -1
+}
+
+// templateEnd returns the index of the last token of the template literal
+// starting at i (see tokenizer.template).
+func (p *parser) templateEnd(i int) int {
+	for p.tok(i).sub && p.tok(i+2).is("(") {
+		i = p.pair[i+2] + 2
+	}
+	return i
+}
+
+// text returns the source text of the tokens from start to end (inclusive).
+func (p *parser) text(start, end int) string {
+	if end < start || start < 0 || end >= len(p.toks) {
+		return ""
+	}
+	return p.src[p.toks[start].start:p.toks[end].end]
+}
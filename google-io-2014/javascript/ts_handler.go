@@ -0,0 +1,38 @@
+package javascript
+
+import (
+	"io/ioutil"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// TSAnalyzer analyzes TypeScript files (including TSX and .d.ts declaration
+// files) with the JavaScript parser. Interfaces, type aliases, enums and
+// namespaces become defs with those kinds.
+type TSAnalyzer struct{}
+
+func (_ TSAnalyzer) Analyze(file string) ([]*lang.Def, []*lang.Ref, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return analyze(file, src)
+}
+
+// AnalyzeUnit is like JSAnalyzer.AnalyzeUnit.
+func (_ TSAnalyzer) AnalyzeUnit(dir string, u *lang.SourceUnit) ([]*lang.Def, []*lang.Ref, error) {
+	return analyzeUnit(dir, u)
+}
+
+// Scan returns the TypeScript files under dir. Each file is analyzed on its
+// own.
+func (_ TSAnalyzer) Scan(dir string) ([]string, error) {
+	return scanFiles(dir, ".ts", ".tsx", ".mts", ".cts")
+}
+
+// dummy
+func (_ TSAnalyzer) ListDependencies(pkg string) ([]*lang.Dep, error) { return nil, nil }
+
+var _ lang.Analyzer = &TSAnalyzer{}
+var _ lang.Scanner = &TSAnalyzer{}
+var _ lang.UnitAnalyzer = &TSAnalyzer{}
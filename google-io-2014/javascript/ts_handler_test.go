@@ -0,0 +1,9 @@
+package javascript
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang/langtest"
+)
+
+func TestTSAnalyzer(t *testing.T) { langtest.Run(t, "ts", "testdata/ts") }
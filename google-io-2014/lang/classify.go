@@ -0,0 +1,253 @@
+package lang
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// File classes. Files that aren't in one of these classes are the repo's own
+// source.
+const (
+	FileIgnored   = "ignored"   // excluded by .gitignore (e.g., build output)
+	FileVendored  = "vendored"  // a copy of third-party code (e.g., in node_modules)
+	FileGenerated = "generated" // generated by a tool (e.g., protoc output or a minified bundle)
+)
+
+// vendorDirs are the names of dirs whose contents are vendored.
+var vendorDirs = map[string]bool{
+	"node_modules":     true,
+	"bower_components": true,
+	"jspm_packages":    true,
+	"vendor":           true,
+	"third_party":      true,
+	"Godeps":           true,
+}
+
+// A Classifier classifies the files in a repository, so that indexing can
+// skip ignored and vendored files and tag generated ones.
+//
+// Files are ignored if .gitignore (or .git/info/exclude) says so; vendored if
+// they're in a dir such as node_modules or vendor; and generated if they have
+// a "Code generated ... DO NOT EDIT." or "@generated" header, or are
+// minified JavaScript. A repo can override the vendored and generated
+// heuristics in its .gitattributes, with the same attributes GitHub uses:
+//
+//	lib/jquery.js  -linguist-vendored
+//	gen/*.js       linguist-generated
+type Classifier struct {
+	dir string
+
+	ignores    map[string][]*ignorePattern // by slash-separated dir, from .gitignore files
+	attributes []*attrPattern              // from .gitattributes
+	classes    map[string]string           // memoized, by file
+}
+
+type attrPattern struct {
+	*ignorePattern
+	attr string // "linguist-vendored" or "linguist-generated"
+	set  bool
+}
+
+// NewClassifier returns a Classifier for the files in the repo rooted at dir.
+func NewClassifier(dir string) *Classifier {
+	c := &Classifier{
+		dir:     dir,
+		ignores: make(map[string][]*ignorePattern),
+		classes: make(map[string]string),
+	}
+	c.ignores["."] = append(readPatterns(filepath.Join(dir, ".git", "info", "exclude")), readPatterns(filepath.Join(dir, ".gitignore"))...)
+	for _, line := range readLines(filepath.Join(dir, ".gitattributes")) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		p := parseIgnorePattern(fields[0])
+		if p == nil || p.negate {
+			continue // negative patterns are forbidden in .gitattributes
+		}
+		for _, f := range fields[1:] {
+			set := !strings.HasPrefix(f, "-") && !strings.HasSuffix(f, "=false")
+			attr := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(f, "-"), "=true"), "=false")
+			if attr == "linguist-vendored" || attr == "linguist-generated" {
+				c.attributes = append(c.attributes, &attrPattern{p, attr, set})
+			}
+		}
+	}
+	return c
+}
+
+// Classify returns the class of file (FileIgnored, FileVendored or
+// FileGenerated), or "" if it's the repo's own source. The file (or dir) is
+// slash-separated and relative to the repo root.
+func (c *Classifier) Classify(file string) string {
+	file = path.Clean(file)
+	if class, ok := c.classes[file]; ok {
+		return class
+	}
+	class := c.classify(file)
+	c.classes[file] = class
+	return class
+}
+
+func (c *Classifier) classify(file string) string {
+	fi, err := os.Stat(filepath.Join(c.dir, filepath.FromSlash(file)))
+	isDir := err == nil && fi.IsDir()
+
+	// A file in an ignored dir is ignored (and can't be re-included).
+	if file != "." {
+		if parent := path.Dir(file); parent != "." && c.Classify(parent) == FileIgnored {
+			return FileIgnored
+		}
+		if c.ignored(file, isDir) {
+			return FileIgnored
+		}
+	}
+
+	vendored, ok := c.attribute("linguist-vendored", file, isDir)
+	if !ok {
+		for _, name := range strings.Split(file, "/") {
+			if vendorDirs[name] {
+				vendored = true
+				break
+			}
+		}
+	}
+	if vendored {
+		return FileVendored
+	}
+	generated, ok := c.attribute("linguist-generated", file, isDir)
+	if !ok && !isDir && err == nil {
+		generated = isGenerated(filepath.Join(c.dir, filepath.FromSlash(file)))
+	}
+	if generated {
+		return FileGenerated
+	}
+	return ""
+}
+
+// ignored reports whether the .gitignore files in file's ancestor dirs
+// exclude it. Later patterns (and those in deeper dirs) take precedence.
+func (c *Classifier) ignored(file string, isDir bool) bool {
+	dirs := []string{"."}
+	for i, ch := range file {
+		if ch == '/' {
+			dirs = append(dirs, file[:i])
+		}
+	}
+	ignored := false
+	for _, dir := range dirs {
+		patterns, ok := c.ignores[dir]
+		if !ok {
+			patterns = readPatterns(filepath.Join(c.dir, filepath.FromSlash(dir), ".gitignore"))
+			c.ignores[dir] = patterns
+		}
+		rel := file
+		if dir != "." {
+			rel = file[len(dir)+1:]
+		}
+		for _, p := range patterns {
+			if p.match(rel, isDir) {
+				ignored = !p.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// attribute returns whether the .gitattributes set attr for file (or one of
+// its dirs), and whether they say anything about it at all.
+func (c *Classifier) attribute(attr, file string, isDir bool) (set, ok bool) {
+	for _, p := range c.attributes {
+		if p.attr == attr && (p.match(file, isDir) || p.matchDir(file)) {
+			set, ok = p.set, true
+		}
+	}
+	return set, ok
+}
+
+// matchDir reports whether p matches one of the dirs that contain file.
+func (p *attrPattern) matchDir(file string) bool {
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' && p.match(file[:i], true) {
+			return true
+		}
+	}
+	return false
+}
+
+var goGeneratedHeader = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether the file (on disk) has a generated-code header
+// or, for JavaScript, is minified.
+func isGenerated(file string) bool {
+	if strings.HasSuffix(file, ".min.js") {
+		return true
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 64<<10)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+
+	// Look for a header in the leading comments.
+	s := bufio.NewScanner(bytes.NewReader(head))
+	s.Buffer(make([]byte, 4096), len(head)+1)
+	for lines := 0; s.Scan() && lines < 50; lines++ {
+		line := strings.TrimSpace(s.Text())
+		if goGeneratedHeader.MatchString(line) || strings.Contains(line, "@generated") {
+			return true
+		}
+		if line != "" && !strings.HasPrefix(line, "//") && !strings.HasPrefix(line, "/*") && !strings.HasPrefix(line, "*") && !strings.HasPrefix(line, "#") {
+			break // past the header comments
+		}
+	}
+
+	switch filepath.Ext(file) {
+	case ".js", ".mjs", ".cjs":
+		return minified(head)
+	}
+	return false
+}
+
+// minified reports whether src (the start of a JavaScript file) looks
+// minified: long, with very long lines on average.
+func minified(src []byte) bool {
+	if len(src) < 4096 {
+		return false
+	}
+	lines := bytes.Count(src, []byte("\n")) + 1
+	return len(src)/lines > 250
+}
+
+func readPatterns(file string) []*ignorePattern {
+	var patterns []*ignorePattern
+	for _, line := range readLines(file) {
+		if p := parseIgnorePattern(line); p != nil {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func readLines(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines
+}
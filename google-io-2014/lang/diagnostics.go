@@ -0,0 +1,39 @@
+package lang
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Diagnostic is a problem in the analyzed source, such as a syntax error.
+type Diagnostic struct {
+	File       string
+	Start, End int // byte offsets in File
+	Message    string
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s:#%d: %s", d.File, d.Start, d.Message)
+}
+
+// Diagnostics is the error an Analyzer returns when the source has problems
+// but it still found some defs and refs. Callers should keep the defs and
+// refs returned along with Diagnostics (unlike with other errors).
+type Diagnostics []*Diagnostic
+
+func (ds Diagnostics) Error() string {
+	msgs := make([]string, len(ds))
+	for i, d := range ds {
+		msgs[i] = d.String()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// SplitDiagnostics returns the Diagnostics in err, if any, and err itself if
+// it is some other (fatal) error.
+func SplitDiagnostics(err error) (Diagnostics, error) {
+	if ds, ok := err.(Diagnostics); ok {
+		return ds, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,202 @@
+package lang
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// UnitGlobber is implemented by analyzers whose source units are dirs, to
+// say which files in a unit's Dir belong to the unit.
+type UnitGlobber interface {
+	// UnitGlobs returns globs (relative to a unit's Dir) of its files.
+	UnitGlobs() []string
+}
+
+// ExpandGlobs adds the files that match u's Globs (which are relative to
+// u.Dir, with "**" matching any number of dirs) to u.Files, in the repo
+// rooted at dir. Files that c classifies as ignored or vendored, and hidden
+// dirs, are skipped. The resulting Files are sorted and unique.
+func ExpandGlobs(dir string, u *SourceUnit, c *Classifier) error {
+	if len(u.Globs) == 0 {
+		return nil
+	}
+	res := compileGlobs(u.Globs)
+	deep := false // whether any glob can match files in subdirs
+	for _, glob := range u.Globs {
+		if strings.Contains(glob, "/") || strings.Contains(glob, "**") {
+			deep = true
+		}
+	}
+	files := make(map[string]bool, len(u.Files))
+	for _, f := range u.Files {
+		files[f] = true
+	}
+
+	unitDir := path.Clean(u.Dir)
+	root := filepath.Join(dir, filepath.FromSlash(unitDir))
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		file := path.Join(unitDir, rel)
+		if fi.IsDir() {
+			if p != root && (!deep || strings.HasPrefix(fi.Name(), ".") || excluded(c, file)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !excluded(c, file) && matchAny(res, rel) {
+			files[file] = true
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil // a unit declared (e.g., in a Srcfile) for a dir that doesn't exist
+	}
+
+	u.Files = make([]string, 0, len(files))
+	for f := range files {
+		u.Files = append(u.Files, f)
+	}
+	sort.Strings(u.Files)
+	return err
+}
+
+func excluded(c *Classifier, file string) bool {
+	switch c.Classify(file) {
+	case FileIgnored, FileVendored:
+		return true
+	}
+	return false
+}
+
+func (u *SourceUnit) Key() graph.UnitKey { return graph.UnitKey{UnitType: u.Type, Unit: u.Name} }
+
+// A FileConflict is a file that more than one source unit claims.
+type FileConflict struct {
+	File   string
+	Owner  graph.UnitKey   // the unit that keeps the file
+	Others []graph.UnitKey // the units it was removed from
+}
+
+// Ownership describes how the files in a repo are divided among its source
+// units.
+type Ownership struct {
+	Conflicts []*FileConflict `json:",omitempty"`
+	Uncovered []string        `json:",omitempty"` // source files that no unit covers
+}
+
+// AssignFiles makes each file belong to exactly one of units, by removing it
+// from the Files of all but one of the units that claim it: the unit with
+// the deepest Dir (the most specific one) or, of those, the first by type and
+// name. It returns the conflicts it resolved, sorted by file.
+func AssignFiles(units []*SourceUnit) []*FileConflict {
+	sorted := make([]*SourceUnit, len(units))
+	copy(sorted, units)
+	sort.Sort(unitsByPrecedence(sorted))
+
+	owners := make(map[string]*SourceUnit)
+	conflicts := make(map[string]*FileConflict)
+	for _, u := range sorted {
+		var kept []string
+		for _, f := range u.Files {
+			owner, claimed := owners[f]
+			if !claimed {
+				owners[f] = u
+				kept = append(kept, f)
+				continue
+			}
+			c, ok := conflicts[f]
+			if !ok {
+				c = &FileConflict{File: f, Owner: owner.Key()}
+				conflicts[f] = c
+			}
+			c.Others = append(c.Others, u.Key())
+		}
+		u.Files = kept
+	}
+
+	list := make([]*FileConflict, 0, len(conflicts))
+	for _, c := range conflicts {
+		list = append(list, c)
+	}
+	sort.Sort(conflictsByFile(list))
+	return list
+}
+
+// UncoveredFiles returns the source files in the repo rooted at dir that none
+// of units cover. Source files are those with the extension of a file that
+// some unit covers (e.g., ".go"), except for files that c classifies as
+// ignored or vendored, those in hidden dirs, and those that sf excludes.
+func UncoveredFiles(dir string, units []*SourceUnit, c *Classifier, sf *Srcfile) ([]string, error) {
+	covered := make(map[string]bool)
+	exts := make(map[string]bool)
+	for _, u := range units {
+		for _, f := range u.Files {
+			covered[f] = true
+			exts[path.Ext(f)] = true
+		}
+	}
+	delete(exts, "")
+
+	var uncovered []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		file := filepath.ToSlash(rel)
+		if fi.IsDir() {
+			if p != dir && (strings.HasPrefix(fi.Name(), ".") || excluded(c, file)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if exts[path.Ext(file)] && !covered[file] && !excluded(c, file) && sf.Included(file) {
+			uncovered = append(uncovered, file)
+		}
+		return nil
+	})
+	return uncovered, err
+}
+
+type unitsByPrecedence []*SourceUnit
+
+func (v unitsByPrecedence) Len() int      { return len(v) }
+func (v unitsByPrecedence) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v unitsByPrecedence) Less(i, j int) bool {
+	if di, dj := dirDepth(v[i].Dir), dirDepth(v[j].Dir); di != dj {
+		return di > dj
+	}
+	if v[i].Type != v[j].Type {
+		return v[i].Type < v[j].Type
+	}
+	return v[i].Name < v[j].Name
+}
+
+func dirDepth(dir string) int {
+	dir = path.Clean(dir)
+	if dir == "." || dir == "/" {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+type conflictsByFile []*FileConflict
+
+func (v conflictsByFile) Len() int           { return len(v) }
+func (v conflictsByFile) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v conflictsByFile) Less(i, j int) bool { return v[i].File < v[j].File }
@@ -0,0 +1,102 @@
+package lang
+
+import (
+	"regexp"
+	"strings"
+)
+
+// compileGlob compiles a slash-separated glob pattern, as used in .gitignore
+// files, into a regexp that matches whole paths. In addition to "*", "?" and
+// "[...]" (which don't match "/"), "**" matches any number of directories:
+// "**/x" matches x in any dir, "x/**" matches everything in x, and "a/**/b"
+// matches a/b, a/x/b, a/x/y/b, etc.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case pattern[i:] == "**" && (i == 0 || pattern[i-1] == '/'):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// An ignorePattern is a line of a .gitignore file (or of the patterns in a
+// .gitattributes file).
+type ignorePattern struct {
+	re       *regexp.Regexp
+	negate   bool // "!pattern" re-includes what earlier patterns excluded
+	dirOnly  bool // "pattern/" only matches dirs
+	anchored bool // matched against the whole path, not just the base name
+}
+
+// parseIgnorePattern parses a line of a .gitignore file. It returns nil for
+// blank lines, comments and invalid patterns.
+func parseIgnorePattern(line string) *ignorePattern {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	var p ignorePattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+	re, err := compileGlob(line)
+	if err != nil {
+		return nil
+	}
+	p.re = re
+	return &p
+}
+
+// match reports whether p matches path, which is slash-separated and relative
+// to the dir of the file that p came from.
+func (p *ignorePattern) match(path string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !p.anchored {
+		path = path[strings.LastIndex(path, "/")+1:]
+	}
+	return p.re.MatchString(path)
+}
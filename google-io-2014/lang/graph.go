@@ -0,0 +1,59 @@
+package lang
+
+import "github.com/sourcegraph/talks/google-io-2014/graph"
+
+// ToGraph converts the output of the analyzer registered for unitType, run
+// on source unit unit of repo at commitID, into graph defs and refs. Refs to
+// defs in other source units of repo (those with InRepo set) are to those
+// units in repo. Refs to defs in other packages keep the package as their
+// DefUnit, but their DefRepo is unknown and left empty.
+func ToGraph(repo, commitID, unitType, unit string, ldefs []*Def, lrefs []*Ref) ([]*graph.Def, []*graph.Ref) {
+	defs := make([]*graph.Def, len(ldefs))
+	for i, d := range ldefs {
+		defs[i] = &graph.Def{
+			DefKey:   graph.DefKey{Repo: repo, CommitID: commitID, UnitType: unitType, Unit: unit, Path: d.Path},
+			Kind:     d.Kind,
+			Name:     d.Name,
+			Type:     d.Type,
+			Callable: d.Callable,
+			Exported: d.Exported,
+			Scope:    d.Scope,
+			File:     d.File,
+			DefStart: d.Start,
+			DefEnd:   d.End,
+		}
+	}
+
+	refs := make([]*graph.Ref, len(lrefs))
+	for i, r := range lrefs {
+		ref := &graph.Ref{
+			DefRepo:     repo,
+			DefUnitType: unitType,
+			DefUnit:     unit,
+			DefPath:     r.DefPath,
+			Repo:        repo,
+			CommitID:    commitID,
+			UnitType:    unitType,
+			Unit:        unit,
+			File:        r.File,
+			Start:       r.Start,
+			End:         r.End,
+			Enclosing:   r.Enclosing,
+			Kind:        r.Kind,
+		}
+		if r.DefPkg != "" {
+			ref.DefUnit = r.DefPkg
+			if !r.InRepo {
+				ref.DefRepo = ""
+			}
+		}
+		refs[i] = ref
+	}
+	return defs, refs
+}
+
+// ToGraph converts the defs and refs of u, a unit returned by AnalyzeDir,
+// with the ToGraph func.
+func (u *Unit) ToGraph(repo, commitID string) ([]*graph.Def, []*graph.Ref) {
+	return ToGraph(repo, commitID, u.Lang, u.Pkg, u.Defs, u.Refs)
+}
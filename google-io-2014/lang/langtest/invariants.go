@@ -0,0 +1,102 @@
+package langtest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+// CheckInvariants returns the ways in which the output of analyzing dir is
+// inconsistent with itself or with the source files:
+//
+//   - every def, ref and diagnostic is in a file under dir (or, for
+//     diagnostics, is about a package dir), and its byte range is within the
+//     file;
+//   - defs have a name and a path, and no two defs in a unit have the same
+//     path;
+//   - defs are Exported if and only if their Scope is ScopeExported;
+//   - refs have a def path, except imports of a whole package;
+//   - refs to defs in the analyzed package (those with an empty DefPkg) and
+//     Enclosing paths name defs in the unit;
+//   - refs to defs in other units of the repo (those with InRepo set) name a
+//     unit of the same type, and a def in it.
+func CheckInvariants(dir string, units []*lang.Unit) []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	sizes := make(map[string]int)
+	checkRange := func(what, file string, start, end int) {
+		size, ok := sizes[file]
+		if !ok {
+			fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file)))
+			switch {
+			case err != nil:
+				size = -1
+			case fi.IsDir():
+				size = 0 // a diagnostic about a whole package dir
+			default:
+				size = int(fi.Size())
+			}
+			sizes[file] = size
+		}
+		switch {
+		case size == -1:
+			report("%s: file %q not found in %s", what, file, dir)
+		case start < 0 || end < start || end > size:
+			report("%s: range %d-%d out of bounds (file is %d bytes)", what, start, end, size)
+		}
+	}
+
+	unitPaths := make(map[[2]string]map[string]bool, len(units))
+	for _, u := range units {
+		paths := make(map[string]bool, len(u.Defs))
+		for _, def := range u.Defs {
+			what := fmt.Sprintf("%s: def %s", u.Pkg, def.Path)
+			if def.Name == "" || def.Path == "" {
+				report("%s: empty name or path", what)
+			}
+			if paths[def.Path] {
+				report("%s: duplicate path", what)
+			}
+			if def.Exported != (def.Scope == lang.ScopeExported) {
+				report("%s: Exported is %v but Scope is %q", what, def.Exported, def.Scope)
+			}
+			paths[def.Path] = true
+			checkRange(what, def.File, def.Start, def.End)
+		}
+		unitPaths[[2]string{u.Lang, u.Pkg}] = paths
+	}
+
+	for _, u := range units {
+		paths := unitPaths[[2]string{u.Lang, u.Pkg}]
+		for _, ref := range u.Refs {
+			what := fmt.Sprintf("%s: ref to %s at %s:#%d", u.Pkg, ref.DefPath, ref.File, ref.Start)
+			if ref.DefPath == "" && ref.Kind != lang.RefImport {
+				report("%s: empty def path", what)
+			}
+			if ref.DefPkg == "" && !paths[ref.DefPath] {
+				report("%s: no such def in %s (and DefPkg is empty)", what, u.Pkg)
+			}
+			if ref.InRepo {
+				if defPaths, ok := unitPaths[[2]string{u.Lang, ref.DefPkg}]; !ok {
+					report("%s: no such unit %s in the repo (and InRepo is set)", what, ref.DefPkg)
+				} else if ref.DefPath != "" && !defPaths[ref.DefPath] {
+					report("%s: no such def in %s", what, ref.DefPkg)
+				}
+			}
+			if ref.Enclosing != "" && !paths[ref.Enclosing] {
+				report("%s: enclosing def %s not found", what, ref.Enclosing)
+			}
+			checkRange(what, ref.File, ref.Start, ref.End)
+		}
+
+		for _, d := range u.Diagnostics {
+			checkRange(fmt.Sprintf("%s: diagnostic %q", u.Pkg, d.Message), d.File, d.Start, d.End)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,117 @@
+// Package langtest checks lang.Analyzer implementations against fixtures.
+//
+// Each subdirectory of a fixtures dir (usually "testdata") is analyzed with
+// the analyzer registered for a language, and the output (sorted, with file
+// names relative to the fixture) is compared with the fixture's golden file:
+// "testdata/foo" is checked against "testdata/foo.golden.json". Run tests
+// with -update to (re)write the golden files. Every fixture's output is also
+// checked for invariants that any analyzer should satisfy.
+//
+// A typical analyzer test is:
+//
+//	func TestAnalyzer(t *testing.T) { langtest.Run(t, "go", "testdata") }
+package langtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/talks/google-io-2014/lang"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// Run analyzes each fixture in fixturesDir with the analyzer registered for
+// language, checks invariants and compares the output to the fixture's
+// golden file.
+func Run(t *testing.T, language, fixturesDir string) {
+	fis, err := ioutil.ReadDir(fixturesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		n++
+		dir := filepath.Join(fixturesDir, fi.Name())
+		t.Run(fi.Name(), func(t *testing.T) { RunFixture(t, language, dir) })
+	}
+	if n == 0 {
+		t.Errorf("no fixtures in %s", fixturesDir)
+	}
+}
+
+// RunFixture is like Run, but for a single fixture dir.
+func RunFixture(t *testing.T, language, dir string) {
+	units, err := lang.AnalyzeDirLang(dir, language)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Normalize(units)
+
+	for _, problem := range CheckInvariants(dir, units) {
+		t.Error(problem)
+	}
+
+	got, err := json.MarshalIndent(units, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	golden := filepath.Clean(dir) + ".golden.json"
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if os.IsNotExist(err) {
+		t.Fatalf("no golden file %s (run with -update to create it)", golden)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run with -update if the change is intended):\n%s", golden, firstDiff(string(want), string(got)))
+	}
+}
+
+// Normalize sorts the units and their defs, refs and diagnostics so that
+// output doesn't depend on the order an analyzer happens to produce them in.
+func Normalize(units []*lang.Unit) {
+	sort.Sort(unitsByKey(units))
+	for _, u := range units {
+		sort.Sort(defsByPos(u.Defs))
+		sort.Sort(refsByPos(u.Refs))
+		sort.Sort(diagsByPos(u.Diagnostics))
+	}
+}
+
+// firstDiff describes the first line where want and got differ.
+func firstDiff(want, got string) string {
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n\twant: %s\n\tgot:  %s", i+1, w, g)
+		}
+	}
+	return ""
+}
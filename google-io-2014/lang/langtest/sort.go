@@ -0,0 +1,56 @@
+package langtest
+
+import "github.com/sourcegraph/talks/google-io-2014/lang"
+
+type unitsByKey []*lang.Unit
+
+func (v unitsByKey) Len() int      { return len(v) }
+func (v unitsByKey) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v unitsByKey) Less(i, j int) bool {
+	if v[i].Lang != v[j].Lang {
+		return v[i].Lang < v[j].Lang
+	}
+	return v[i].Pkg < v[j].Pkg
+}
+
+type defsByPos []*lang.Def
+
+func (v defsByPos) Len() int      { return len(v) }
+func (v defsByPos) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v defsByPos) Less(i, j int) bool {
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	if v[i].Start != v[j].Start {
+		return v[i].Start < v[j].Start
+	}
+	return v[i].Path < v[j].Path
+}
+
+type refsByPos []*lang.Ref
+
+func (v refsByPos) Len() int      { return len(v) }
+func (v refsByPos) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v refsByPos) Less(i, j int) bool {
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	if v[i].Start != v[j].Start {
+		return v[i].Start < v[j].Start
+	}
+	return v[i].DefPath < v[j].DefPath
+}
+
+type diagsByPos []*lang.Diagnostic
+
+func (v diagsByPos) Len() int      { return len(v) }
+func (v diagsByPos) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v diagsByPos) Less(i, j int) bool {
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	if v[i].Start != v[j].Start {
+		return v[i].Start < v[j].Start
+	}
+	return v[i].Message < v[j].Message
+}
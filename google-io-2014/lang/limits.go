@@ -0,0 +1,201 @@
+package lang
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Limits bounds the resources an analyzer may use to analyze one package, so
+// that a huge minified file or a runaway toolchain can't take down the
+// indexer. A zero field means no limit.
+type Limits struct {
+	MaxFileSize int64         // bytes; larger source files are skipped
+	MaxDefs     int           // defs beyond this many are dropped
+	MaxRefs     int           // refs beyond this many are dropped
+	Timeout     time.Duration // wall-clock time to analyze a package (in a worker, see ServeWorker)
+	MaxMemory   int64         // bytes of data memory for a worker or other subprocess started with Run
+}
+
+// DefaultLimits are the limits for analyzers that don't implement Limiter and
+// whose languages have no limits registered with RegisterLimits.
+var DefaultLimits = Limits{
+	MaxFileSize: 1 << 20,
+	MaxDefs:     100000,
+	MaxRefs:     1000000,
+	Timeout:     5 * time.Minute,
+	MaxMemory:   4 << 30,
+}
+
+// Limiter is implemented by analyzers that set their own limits, instead of
+// DefaultLimits.
+type Limiter interface {
+	Limits() Limits
+}
+
+var limits = make(map[string]Limits)
+
+// RegisterLimits sets the limits for the analyzer for language, overriding
+// its own (if it implements Limiter) and DefaultLimits. Like Register, it
+// should be called from an init func, so that the limits also apply in
+// worker processes (see ServeWorker).
+func RegisterLimits(language string, l Limits) {
+	limits[language] = l
+}
+
+// LimitsFor returns the limits for the analyzer registered for language.
+func LimitsFor(language string) Limits {
+	if l, ok := limits[language]; ok {
+		return l
+	}
+	if l, ok := analyzers[language].(Limiter); ok {
+		return l.Limits()
+	}
+	return DefaultLimits
+}
+
+// A LimitError is returned when analyzing a package exceeds one of its
+// Limits. AnalyzeDir records it as a diagnostic instead of failing.
+type LimitError struct {
+	File    string // the file (or package dir) being analyzed
+	Message string
+}
+
+func (e *LimitError) Error() string { return e.File + ": " + e.Message }
+
+// CheckFileSize returns a *LimitError if file, which is size bytes, is larger
+// than the MaxFileSize limit for language. Analyzers that read the files of a
+// package dir themselves should call it (and skip the file if it returns an
+// error); AnalyzeDir checks packages that are single files.
+func CheckFileSize(language, file string, size int64) error {
+	if max := LimitsFor(language).MaxFileSize; max > 0 && size > max {
+		return &LimitError{File: file, Message: fmt.Sprintf("file is %d bytes, more than the limit of %d; skipped", size, max)}
+	}
+	return nil
+}
+
+// Run runs cmd, a worker (see ServeWorker) or a subprocess toolchain (such as
+// a compiler or type checker) used by the analyzer for language, and returns
+// its standard output. The subprocess's data memory (its heap, but not
+// address space it only reserves, as the Go runtime does) is capped at the
+// language's MaxMemory using the shell's ulimit, and it is killed if it runs
+// longer than Timeout, in which case Run returns a *LimitError.
+func Run(language string, cmd *exec.Cmd) ([]byte, error) {
+	l := LimitsFor(language)
+	name := cmd.Args[0]
+	if l.MaxMemory > 0 {
+		path, err := exec.LookPath(cmd.Path)
+		if err != nil {
+			return nil, err
+		}
+		script := "ulimit -d " + strconv.FormatInt(l.MaxMemory/1024, 10) + ` && exec "$0" "$@"`
+		cmd.Args = append([]string{"sh", "-c", script, path}, cmd.Args[1:]...)
+		if cmd.Path, err = exec.LookPath("sh"); err != nil {
+			return nil, err
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var timeout <-chan time.Time
+	if l.Timeout > 0 {
+		timer := time.NewTimer(l.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s\n%s", name, err, stderr.Bytes())
+		}
+		return stdout.Bytes(), nil
+	case <-timeout:
+		cmd.Process.Kill()
+		<-done
+		return nil, &LimitError{File: cmd.Dir, Message: fmt.Sprintf("%s ran longer than the limit of %s; killed", name, l.Timeout)}
+	}
+}
+
+// analyzeLimited analyzes u (in the repo rooted at dir) with the analyzer for
+// its type, within the limits for that language. Exceeding a limit (or a
+// crash of the analyzer) is reported as a diagnostic on the unit's package,
+// along with whatever defs and refs were kept. The analyzer runs in a worker
+// process, which is killed if it exceeds the Timeout or MaxMemory, if the
+// program called ServeWorker; otherwise it runs in this process and only the
+// other limits apply.
+func analyzeLimited(dir string, u *SourceUnit) ([]*Def, []*Ref, error) {
+	language := u.Type
+	pkg := filepath.Join(dir, filepath.FromSlash(u.Name))
+	l := LimitsFor(language)
+	if fi, err := os.Stat(pkg); err == nil && !fi.IsDir() {
+		if err := CheckFileSize(language, pkg, fi.Size()); err != nil {
+			return nil, nil, limitDiagnostics(nil, err.(*LimitError))
+		}
+	}
+
+	var r *workerResult
+	if workers {
+		var err error
+		if r, err = analyzeInWorker(dir, u); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		r = analyzeUnit(dir, u)
+	}
+
+	diags, err := SplitDiagnostics(r.err())
+	if err != nil {
+		le, ok := err.(*LimitError)
+		if !ok {
+			return nil, nil, err
+		}
+		if le.File == "" {
+			le.File = pkg
+		}
+		diags = limitDiagnostics(diags, le)
+	}
+	if l.MaxDefs > 0 && len(r.Defs) > l.MaxDefs {
+		diags = limitDiagnostics(diags, &LimitError{File: pkg, Message: fmt.Sprintf("%d defs, more than the limit of %d; dropped the rest", len(r.Defs), l.MaxDefs)})
+		r.Defs = r.Defs[:l.MaxDefs]
+		r.Refs = withDefs(r.Refs, r.Defs)
+	}
+	if l.MaxRefs > 0 && len(r.Refs) > l.MaxRefs {
+		diags = limitDiagnostics(diags, &LimitError{File: pkg, Message: fmt.Sprintf("%d refs, more than the limit of %d; dropped the rest", len(r.Refs), l.MaxRefs)})
+		r.Refs = r.Refs[:l.MaxRefs]
+	}
+	if len(diags) > 0 {
+		return r.Defs, r.Refs, diags
+	}
+	return r.Defs, r.Refs, nil
+}
+
+func limitDiagnostics(diags Diagnostics, e *LimitError) Diagnostics {
+	return append(diags, &Diagnostic{File: e.File, Message: e.Message})
+}
+
+// withDefs returns the refs that don't refer to (or occur in) dropped defs,
+// that is, defs in the analyzed package that aren't in defs.
+func withDefs(refs []*Ref, defs []*Def) []*Ref {
+	kept := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		kept[def.Path] = true
+	}
+	var keep []*Ref
+	for _, ref := range refs {
+		if (ref.DefPkg == "" && ref.DefPath != "" && !kept[ref.DefPath]) || (ref.Enclosing != "" && !kept[ref.Enclosing]) {
+			continue
+		}
+		keep = append(keep, ref)
+	}
+	return keep
+}
@@ -0,0 +1,144 @@
+package lang
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A Region is a range of a file written in another language than the file
+// itself, such as a <script> block in an HTML file.
+type Region struct {
+	Lang       string
+	Start, End int // byte offsets in the host file
+
+	// Regions with the same non-empty Group (and Lang) are analyzed together,
+	// as one source, because they share a scope: e.g., the classic scripts of
+	// an HTML page, whose top-level names are all globals of the page.
+	Group string
+}
+
+// AnalyzeRegions analyzes each region of src (the contents of file) with the
+// SourceAnalyzer registered for the region's language, and returns the defs,
+// refs and diagnostics with offsets in the host file. Regions in languages
+// with no registered SourceAnalyzer are skipped.
+//
+// Regions in the same Group are analyzed as one source, in which the text
+// between them is blanked out. Other regions are analyzed on their own, so
+// defs with the same path in different sources are renamed ("x", "x$2", ...)
+// to keep paths unique in the file.
+func AnalyzeRegions(file string, src []byte, regions []Region) ([]*Def, []*Ref, error) {
+	var defs []*Def
+	var refs []*Ref
+	var diags Diagnostics
+	taken := make(map[string]bool)
+	for _, g := range groupRegions(regions) {
+		a, ok := analyzers[g[0].Lang].(SourceAnalyzer)
+		if !ok {
+			continue
+		}
+		offset := g[0].Start
+		rdefs, rrefs, err := a.AnalyzeSource(file, joinRegions(src, g))
+		rdiags, err := SplitDiagnostics(err)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		renamed := make(map[string]string)
+		for _, def := range rdefs {
+			path := renamePath(renamed, def.Path)
+			unique := path
+			for n := 2; taken[unique]; n++ {
+				unique = path + "$" + strconv.Itoa(n)
+			}
+			taken[unique] = true
+			if unique != def.Path {
+				renamed[def.Path] = unique
+				def.Path = unique
+			}
+			def.Start += offset
+			def.End += offset
+		}
+		for _, ref := range rrefs {
+			if ref.DefPkg == "" {
+				ref.DefPath = renamePath(renamed, ref.DefPath)
+			}
+			ref.Enclosing = renamePath(renamed, ref.Enclosing)
+			ref.Start += offset
+			ref.End += offset
+		}
+		for _, d := range rdiags {
+			d.Start += offset
+			d.End += offset
+		}
+		defs = append(defs, rdefs...)
+		refs = append(refs, rrefs...)
+		diags = append(diags, rdiags...)
+	}
+	if len(diags) > 0 {
+		return defs, refs, diags
+	}
+	return defs, refs, nil
+}
+
+// groupRegions returns the regions in the order they're analyzed: each
+// ungrouped region on its own, and the regions of each group together, in
+// the order in which their first regions appear.
+func groupRegions(regions []Region) [][]Region {
+	var groups [][]Region
+	index := make(map[[2]string]int)
+	for _, r := range regions {
+		if r.Group == "" {
+			groups = append(groups, []Region{r})
+			continue
+		}
+		key := [2]string{r.Lang, r.Group}
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], r)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []Region{r})
+	}
+	return groups
+}
+
+// joinRegions returns the source of the regions g (in order) of src, from the
+// start of the first to the end of the last, with the text between them
+// replaced by spaces, so that offsets in it are offsets in src. Each gap
+// between regions starts with a newline (ending any line comment) and ends
+// with a ";", so that a statement left unterminated at the end of one region
+// doesn't run into the next.
+func joinRegions(src []byte, g []Region) []byte {
+	first, last := g[0], g[len(g)-1]
+	if len(g) == 1 {
+		return src[first.Start:first.End]
+	}
+	out := make([]byte, last.End-first.Start)
+	for i := range out {
+		out[i] = ' '
+	}
+	for i, r := range g {
+		copy(out[r.Start-first.Start:], src[r.Start:r.End])
+		if i > 0 {
+			out[g[i-1].End-first.Start] = '\n'
+			out[r.Start-first.Start-1] = ';'
+		}
+	}
+	return out
+}
+
+// renamePath applies the longest matching rename of path or one of its
+// parents ("x" in "x/y") to path.
+func renamePath(renamed map[string]string, path string) string {
+	for prefix := path; prefix != ""; {
+		if to, ok := renamed[prefix]; ok {
+			return to + path[len(prefix):]
+		}
+		i := strings.LastIndex(prefix, "/")
+		if i == -1 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return path
+}
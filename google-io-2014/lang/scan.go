@@ -0,0 +1,186 @@
+package lang
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// A Unit is the output of analyzing one package.
+type Unit struct {
+	Lang string
+	Pkg  string // file or dir, relative to the analyzed dir
+	Defs []*Def
+	Refs []*Ref
+
+	Diagnostics Diagnostics `json:",omitempty"`
+
+	// FileClasses is the class (e.g., FileGenerated) of each file in the unit
+	// that isn't the repo's own source.
+	FileClasses map[string]string `json:",omitempty"`
+}
+
+// AnalyzeDir analyzes every package under dir that a registered Analyzer
+// finds with its Scan method, except those that NewClassifier(dir) classifies
+// as ignored or vendored, as configured by the Srcfile at dir (if any). Each
+// file is analyzed in only one package (see ScanDir). File names in the
+// output are relative to dir.
+func AnalyzeDir(dir string) ([]*Unit, error) {
+	return analyzeDir(dir, scannerLangs())
+}
+
+// AnalyzeDirLang is like AnalyzeDir but only runs the analyzer registered for
+// lang. If that analyzer doesn't implement Scanner, dir is analyzed as a
+// single package. Packages are analyzed within the Limits for lang, and
+// exceeding them is reported in the unit's Diagnostics.
+func AnalyzeDirLang(dir, lang string) ([]*Unit, error) {
+	if _, ok := analyzers[lang]; !ok {
+		return nil, fmt.Errorf("no analyzer registered for %q", lang)
+	}
+	return analyzeDir(dir, []string{lang})
+}
+
+// ScanDir returns the source units that AnalyzeDir would analyze under dir,
+// with their globs expanded into Files and each file assigned to only one
+// unit, and a report of the files that more than one unit (or no unit)
+// claimed.
+func ScanDir(dir string) ([]*SourceUnit, *Ownership, error) {
+	sf, err := ReadSrcfile(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := NewClassifier(dir)
+	units, conflicts, err := scanDir(dir, scannerLangs(), sf, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	uncovered, err := UncoveredFiles(dir, units, c, sf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return units, &Ownership{Conflicts: conflicts, Uncovered: uncovered}, nil
+}
+
+// scanDir scans dir for the source units of langs, applies sf to them and
+// assigns their files (see AssignFiles). Units left with no files (that had
+// some) are dropped.
+func scanDir(dir string, langs []string, sf *Srcfile, c *Classifier) ([]*SourceUnit, []*FileConflict, error) {
+	var units []*SourceUnit
+	for _, lang := range langs {
+		lunits, err := scanUnits(dir, lang, c)
+		if err != nil {
+			return nil, nil, err
+		}
+		units = append(units, lunits...)
+	}
+	units = sf.Apply(units)
+
+	hadFiles := make(map[*SourceUnit]bool, len(units))
+	for _, u := range units {
+		if err := ExpandGlobs(dir, u, c); err != nil {
+			return nil, nil, err
+		}
+		hadFiles[u] = len(u.Files) > 0
+		var files []string
+		for _, f := range u.Files {
+			if sf.Included(f) {
+				files = append(files, f)
+			}
+		}
+		u.Files = files
+	}
+	conflicts := AssignFiles(units)
+
+	var kept []*SourceUnit
+	for _, u := range units {
+		if hadFiles[u] && len(u.Files) == 0 {
+			continue
+		}
+		kept = append(kept, u)
+	}
+	return kept, conflicts, nil
+}
+
+func scannerLangs() []string {
+	var langs []string
+	for lang, a := range analyzers {
+		if _, ok := a.(Scanner); ok {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+func analyzeDir(dir string, langs []string) ([]*Unit, error) {
+	sf, err := ReadSrcfile(dir)
+	if err != nil {
+		return nil, err
+	}
+	c := NewClassifier(dir)
+	sus, _, err := scanDir(dir, langs, sf, c)
+	if err != nil {
+		return nil, err
+	}
+
+	analyzed := make(map[string]bool, len(langs))
+	for _, lang := range langs {
+		analyzed[lang] = true
+	}
+	var units []*Unit
+	for _, su := range sus {
+		if !analyzed[su.Type] {
+			continue // added by the Srcfile, for another language
+		}
+		defs, refs, err := analyzeLimited(dir, su)
+		diags, err := SplitDiagnostics(err)
+		if err != nil {
+			return nil, err
+		}
+		for _, def := range defs {
+			def.File = relPath(dir, def.File)
+		}
+		for _, ref := range refs {
+			ref.File = relPath(dir, ref.File)
+		}
+		for _, d := range diags {
+			d.File = relPath(dir, d.File)
+		}
+		u := &Unit{Lang: su.Type, Pkg: su.Name, Defs: defs, Refs: refs, Diagnostics: diags}
+		u.FileClasses = fileClasses(c, u)
+		units = append(units, u)
+	}
+	return units, nil
+}
+
+// fileClasses returns the classes of the files in u that aren't the repo's
+// own source, or nil if there are none.
+func fileClasses(c *Classifier, u *Unit) map[string]string {
+	files := []string{u.Pkg}
+	for _, def := range u.Defs {
+		files = append(files, def.File)
+	}
+	for _, ref := range u.Refs {
+		files = append(files, ref.File)
+	}
+	var classes map[string]string
+	for _, file := range files {
+		if _, seen := classes[file]; seen {
+			continue
+		}
+		if class := c.Classify(file); class != "" {
+			if classes == nil {
+				classes = make(map[string]string)
+			}
+			classes[file] = class
+		}
+	}
+	return classes
+}
+
+func relPath(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
@@ -0,0 +1,233 @@
+package lang
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// SrcfileName is the name of the file at a repo's root that configures how
+// the repo is analyzed.
+const SrcfileName = "Srcfile"
+
+// A Srcfile is a repo's analysis configuration, in JSON or YAML. For
+// example:
+//
+//	SourceUnits:
+//	  - Type: js
+//	    Name: lib/legacy.es6
+//	  - Type: go
+//	    Name: cmd/tool
+//	    Config: {Tests: false}
+//	Exclude: ["examples/**"]
+//	Config:
+//	  js: {JSX: false}
+//	SkipToolchains: [html]
+type Srcfile struct {
+	// SourceUnits are source units to analyze in addition to the scanned
+	// ones. A unit with the same Type and Name as a scanned unit overrides
+	// the scanned unit's fields that it sets (and its Config keys).
+	SourceUnits []*SourceUnit
+
+	// Include and Exclude are globs (relative to the repo root, with "**"
+	// matching any number of dirs) of the units and files to analyze: if
+	// Include is set, only units and files matching it are analyzed, and
+	// none matching Exclude are. Dir units (such as Go packages) are
+	// analyzed if Include matches them or could match files in them, as
+	// "cmd/tool/*.go" does in cmd/tool.
+	Include []string
+	Exclude []string
+
+	// Config is the config for each toolchain (unit type, such as "go"),
+	// which is merged into the Config of every unit of that type. A unit's
+	// own Config in SourceUnits takes precedence.
+	Config map[string]map[string]interface{}
+
+	// SkipToolchains are the unit types not to analyze at all.
+	SkipToolchains []string
+
+	include, exclude []*regexp.Regexp // compiled Include and Exclude
+}
+
+// ReadSrcfile reads the Srcfile at the root of the repo in dir. It returns
+// nil if there is none.
+func ReadSrcfile(dir string) (*Srcfile, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, SrcfileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var sf Srcfile
+	if err := yaml.Unmarshal(b, &sf); err != nil { // YAML is a superset of JSON
+		return nil, fmt.Errorf("%s: %s", SrcfileName, err)
+	}
+	for _, globs := range [][]string{sf.Include, sf.Exclude} {
+		for _, glob := range globs {
+			if _, err := compileGlob(glob); err != nil {
+				return nil, fmt.Errorf("%s: bad glob %q: %s", SrcfileName, glob, err)
+			}
+		}
+	}
+	return &sf, nil
+}
+
+// Apply returns the units after applying sf to them: adding and overriding
+// units, filtering units by name with Include and Exclude, merging config
+// and skipping toolchains. (Their files are filtered with Included after
+// their globs are expanded.) A nil Srcfile leaves units as they are.
+func (sf *Srcfile) Apply(units []*SourceUnit) []*SourceUnit {
+	if sf == nil {
+		return units
+	}
+
+	byKey := make(map[graph.UnitKey]*SourceUnit, len(units))
+	for _, u := range units {
+		byKey[u.Key()] = u
+	}
+	unitConfig := make(map[*SourceUnit]map[string]interface{})
+	for _, o := range sf.SourceUnits {
+		u, ok := byKey[o.Key()]
+		if !ok {
+			u = &SourceUnit{Name: o.Name, Type: o.Type, Dir: o.Dir}
+			units = append(units, u)
+			byKey[u.Key()] = u
+		}
+		override(u, o)
+		unitConfig[u] = o.Config
+	}
+
+	skip := make(map[string]bool, len(sf.SkipToolchains))
+	for _, t := range sf.SkipToolchains {
+		skip[t] = true
+	}
+	var kept []*SourceUnit
+	for _, u := range units {
+		if skip[u.Type] || !sf.includedUnit(u) {
+			continue
+		}
+		if len(sf.Config[u.Type]) > 0 || len(unitConfig[u]) > 0 {
+			u.Config = mergeConfig(u.Config, sf.Config[u.Type], unitConfig[u])
+		}
+		kept = append(kept, u)
+	}
+	return kept
+}
+
+// override sets the fields of u that o sets (except Config).
+func override(u, o *SourceUnit) {
+	if o.Repo != "" {
+		u.Repo = o.Repo
+	}
+	if o.Globs != nil {
+		u.Globs = o.Globs
+	}
+	if o.Files != nil {
+		u.Files = o.Files
+	}
+	if o.Dir != "" {
+		u.Dir = o.Dir
+	}
+	if o.Dependencies != nil {
+		u.Dependencies = o.Dependencies
+	}
+	if o.Data != nil {
+		u.Data = o.Data
+	}
+}
+
+// mergeConfig returns the keys of all the configs, with later ones taking
+// precedence.
+func mergeConfig(configs ...map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for _, c := range configs {
+		for k, v := range c {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// Included reports whether sf's Include and Exclude globs let file (or the
+// package of a unit) be analyzed. Everything is included if sf is nil.
+func (sf *Srcfile) Included(file string) bool {
+	if sf == nil {
+		return true
+	}
+	if sf.include == nil {
+		sf.include, sf.exclude = compileGlobs(sf.Include), compileGlobs(sf.Exclude)
+	}
+	if len(sf.Include) > 0 && !matchAny(sf.include, file) {
+		return false
+	}
+	return !matchAny(sf.exclude, file)
+}
+
+// includedUnit reports whether sf's Include and Exclude globs let u be
+// analyzed. Unlike a file unit, a dir unit is included if Include could match
+// files in it; which of its files are analyzed is up to Included, once its
+// globs are expanded.
+func (sf *Srcfile) includedUnit(u *SourceUnit) bool {
+	if sf.Included(u.Name) {
+		return true
+	}
+	if len(u.Files) == 1 && u.Files[0] == u.Name || matchAny(sf.exclude, u.Name) {
+		return false // a file unit, or excluded
+	}
+	for _, glob := range sf.Include {
+		if mayMatchIn(glob, u.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayMatchIn reports whether glob could match files in dir (or its subdirs):
+// whether dir's path segments match glob's leading ones, up to a "**".
+func mayMatchIn(glob, dir string) bool {
+	if dir == "." {
+		return true
+	}
+	segs := strings.Split(glob, "/")
+	for i, seg := range strings.Split(dir, "/") {
+		switch {
+		case i < len(segs) && segs[i] == "**":
+			return true
+		case i >= len(segs)-1:
+			return false // the glob's last segment matches files in its dir, not subdirs
+		}
+		if re, err := compileGlob(segs[i]); err != nil || !re.MatchString(seg) {
+			return false
+		}
+	}
+	return true
+}
+
+// compileGlobs compiles globs, skipping invalid ones. The result is never
+// nil, so that Included can tell whether it has compiled its globs.
+func compileGlobs(globs []string) []*regexp.Regexp {
+	res := []*regexp.Regexp{}
+	for _, glob := range globs {
+		if re, err := compileGlob(glob); err == nil {
+			res = append(res, re)
+		}
+	}
+	return res
+}
+
+// matchAny reports whether one of res matches file. A dir (such as the dir
+// of a Go package) matches globs of its contents, such as "dir/**".
+func matchAny(res []*regexp.Regexp, file string) bool {
+	for _, re := range res {
+		if re.MatchString(file) || re.MatchString(file+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,60 @@
 package lang
 
+import "github.com/sourcegraph/talks/google-io-2014/graph"
+
 type Def struct {
 	Name string
 	Type string
+
+	Path     string // unique identifier for this definition in its package (e.g., "Router/ServeHTTP")
+	Kind     string // e.g., "func", "method", "type", "var", "function", "class"
+	Callable bool
+	Exported bool
+	Scope    string // where the def is visible: ScopeLocal, ScopeFile, ScopePackage or ScopeExported
+
+	File       string
+	Start, End int // byte offsets of the whole definition in File
 }
 
-type Ref struct{}
+// Def scopes, from narrowest to widest (see graph.ScopeLocal, etc.).
+const (
+	ScopeLocal    = graph.ScopeLocal
+	ScopeFile     = graph.ScopeFile
+	ScopePackage  = graph.ScopePackage
+	ScopeExported = graph.ScopeExported
+)
+
+type Ref struct {
+	// The definition to which this reference points. DefPkg is empty if the
+	// def is in the analyzed package; otherwise it's the package (or module)
+	// that defines it, such as "net/http". If InRepo is set, the def is in
+	// another source unit of the same repo, and DefPkg is that unit's name
+	// (as Scan returns it), such as "sub".
+	DefPkg  string
+	DefPath string
+	InRepo  bool `json:",omitempty"`
+
+	File       string
+	Start, End int
+
+	// Enclosing is the Path of the def (in the analyzed package) whose body
+	// contains this reference, such as the function that makes a call. It is
+	// empty for references outside of any def.
+	Enclosing string
+
+	Kind string // how the reference uses the def: RefCall, RefRead, etc.
+}
+
+// Ref kinds (see graph.RefCall, etc.).
+const (
+	RefCall   = graph.RefCall
+	RefRead   = graph.RefRead
+	RefWrite  = graph.RefWrite
+	RefImport = graph.RefImport
+	RefType   = graph.RefType
+	RefDecl   = graph.RefDecl
+	RefImpl   = graph.RefImpl
+)
 
 type Dep struct{}
 
@@ -23,3 +72,17 @@ type DependencyLister interface {
 }
 
 // END 2 OMIT
+
+// Scanner is implemented by analyzers that can find the packages they analyze
+// in a directory tree.
+type Scanner interface {
+	// Scan returns the packages (files or dirs) under dir, relative to dir.
+	Scan(dir string) ([]string, error)
+}
+
+// SourceAnalyzer is implemented by analyzers that can analyze source that
+// isn't (all of) a file on disk, such as a script block in an HTML file.
+type SourceAnalyzer interface {
+	// AnalyzeSource analyzes src as if it were the contents of file.
+	AnalyzeSource(file string, src []byte) ([]*Def, []*Ref, error)
+}
@@ -0,0 +1,85 @@
+package lang
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// A SourceUnit is a package (or file) that an analyzer analyzes as a whole,
+// such as a Go package dir or a JavaScript file. Its paths are
+// slash-separated and relative to the repo root.
+type SourceUnit struct {
+	// Name is an opaque identifier for this source unit that MUST be unique
+	// among all other source units of the same type in the same repository.
+	// It is the package (file or dir) that the analyzer is run on, as Scan
+	// returns it.
+	Name string
+
+	// Type is the type of source unit this represents, which is the name its
+	// analyzer is registered under, such as "go" or "js".
+	Type string
+
+	Repo string `json:",omitempty"`
+
+	Globs        []string      `json:",omitempty"`
+	Files        []string      `json:",omitempty"`
+	Dir          string        `json:",omitempty"`
+	Dependencies []interface{} `json:",omitempty"`
+
+	Data   interface{}            `json:",omitempty"`
+	Config map[string]interface{} `json:",omitempty"` // from the repo's Srcfile
+}
+
+// ConfigBool returns the boolean config value for key, or dflt if it isn't
+// set (or isn't a boolean).
+func (u *SourceUnit) ConfigBool(key string, dflt bool) bool {
+	if v, ok := u.Config[key].(bool); ok {
+		return v
+	}
+	return dflt
+}
+
+// UnitAnalyzer is implemented by analyzers that honor a source unit's Files
+// or Config. AnalyzeDir calls AnalyzeUnit instead of Analyze for them.
+type UnitAnalyzer interface {
+	// AnalyzeUnit analyzes u, in the repo rooted at dir.
+	AnalyzeUnit(dir string, u *SourceUnit) ([]*Def, []*Ref, error)
+}
+
+// scanUnits returns the source units of type lang under dir, as the analyzer
+// registered for lang finds them with its Scan method (or all of dir as one
+// unit, if it doesn't implement Scanner). Units that c classifies as ignored
+// or vendored are skipped. Dir units get the analyzer's UnitGlobs, if it
+// implements UnitGlobber.
+func scanUnits(dir, lang string, c *Classifier) ([]*SourceUnit, error) {
+	pkgs := []string{"."}
+	if s, ok := analyzers[lang].(Scanner); ok {
+		var err error
+		if pkgs, err = s.Scan(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var globs []string
+	if g, ok := analyzers[lang].(UnitGlobber); ok {
+		globs = g.UnitGlobs()
+	}
+
+	var units []*SourceUnit
+	for _, pkg := range pkgs {
+		pkg = filepath.ToSlash(pkg)
+		switch c.Classify(pkg) {
+		case FileIgnored, FileVendored:
+			continue
+		}
+		u := &SourceUnit{Name: pkg, Type: lang, Dir: pkg}
+		if fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(pkg))); err == nil && !fi.IsDir() {
+			u.Dir, u.Files = path.Dir(pkg), []string{pkg}
+		} else {
+			u.Globs = globs
+		}
+		units = append(units, u)
+	}
+	return units, nil
+}
@@ -0,0 +1,135 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// workerEnv is set in the environment of worker processes.
+const workerEnv = "SRCGRAPH_ANALYZE_WORKER"
+
+// workers is whether analyzeLimited runs analyzers in worker processes (see
+// ServeWorker).
+var workers bool
+
+// ServeWorker lets AnalyzeDir run each analyzer in a worker process, which is
+// this program started again, so that an analyzer that exceeds its Timeout or
+// MaxMemory can be killed. Programs should call it at the start of main. In a
+// worker, ServeWorker analyzes the unit it reads from stdin, writes the
+// result to stdout and exits; otherwise it returns.
+func ServeWorker() {
+	if os.Getenv(workerEnv) == "" {
+		workers = true
+		return
+	}
+	var req workerRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fmt.Fprintln(os.Stderr, "worker:", err)
+		os.Exit(1)
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(analyzeUnit(req.Dir, req.Unit)); err != nil {
+		fmt.Fprintln(os.Stderr, "worker:", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+type workerRequest struct {
+	Dir  string
+	Unit *SourceUnit
+}
+
+// A workerResult is what an analyzer returned for a unit.
+type workerResult struct {
+	Defs        []*Def
+	Refs        []*Ref
+	Diagnostics Diagnostics `json:",omitempty"`
+	Limit       *LimitError `json:",omitempty"` // a limit was exceeded, or the analyzer crashed
+	Error       string      `json:",omitempty"` // any other error
+}
+
+func (r *workerResult) err() error {
+	switch {
+	case r.Limit != nil:
+		return r.Limit
+	case r.Error != "":
+		return errors.New(r.Error)
+	case len(r.Diagnostics) > 0:
+		return r.Diagnostics
+	}
+	return nil
+}
+
+// analyzeUnit analyzes u (in the repo rooted at dir) in this process, with
+// the analyzer for its type.
+func analyzeUnit(dir string, u *SourceUnit) (r *workerResult) {
+	pkg := filepath.Join(dir, filepath.FromSlash(u.Name))
+	defer func() {
+		if v := recover(); v != nil {
+			r = &workerResult{Limit: &LimitError{File: pkg, Message: fmt.Sprintf("analyzer crashed: %v", v)}}
+		}
+	}()
+
+	r = &workerResult{}
+	var err error
+	if ua, ok := analyzers[u.Type].(UnitAnalyzer); ok {
+		r.Defs, r.Refs, err = ua.AnalyzeUnit(dir, u)
+	} else {
+		r.Defs, r.Refs, err = analyzers[u.Type].Analyze(pkg)
+	}
+	switch err := err.(type) {
+	case nil:
+	case Diagnostics:
+		r.Diagnostics = err
+	case *LimitError:
+		r.Limit = err
+	default:
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// analyzeInWorker analyzes u (in the repo rooted at dir) in a worker process,
+// within the Timeout and MaxMemory limits for its type. A worker that is
+// killed or crashes yields a result with a Limit error.
+func analyzeInWorker(dir string, u *SourceUnit) (*workerResult, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	req, err := json.Marshal(workerRequest{Dir: dir, Unit: u})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe)
+	cmd.Env = append(os.Environ(), workerEnv+"=1")
+	cmd.Stdin = bytes.NewReader(req)
+
+	pkg := filepath.Join(dir, filepath.FromSlash(u.Name))
+	out, err := Run(u.Type, cmd)
+	if le, ok := err.(*LimitError); ok {
+		le.File = pkg
+		return &workerResult{Limit: le}, nil
+	} else if err != nil {
+		// Keep the error and the first line of the worker's stderr (such as
+		// "fatal error: runtime: out of memory"), not its stack traces.
+		lines := strings.SplitN(err.Error(), "\n", 3)
+		if len(lines) > 2 {
+			lines = lines[:2]
+		}
+		msg := strings.Join(lines, ": ")
+		return &workerResult{Limit: &LimitError{File: pkg, Message: "analyzer failed: " + msg}}, nil
+	}
+
+	var r workerResult
+	if err := json.Unmarshal(out, &r); err != nil {
+		return nil, fmt.Errorf("analyzing %s: bad worker output: %s", pkg, err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,52 @@
+package data
+
+import (
+	"encoding/json"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// ToGraph converts defs and refs in this older format, whose Lang is the
+// unit type, into graph defs and refs. They don't record a commit, so
+// CommitID is left empty.
+func ToGraph(ddefs []*Def, drefs []*Ref) ([]*graph.Def, []*graph.Ref) {
+	defs := make([]*graph.Def, len(ddefs))
+	for i, d := range ddefs {
+		defs[i] = &graph.Def{
+			DefKey:   graph.DefKey{Repo: d.Repo, UnitType: d.Lang, Unit: d.Unit, Path: d.Path},
+			Kind:     d.Kind,
+			Name:     d.Name,
+			Type:     d.Type,
+			Callable: d.Callable,
+			Exported: d.Exported,
+			Scope:    d.Scope,
+			File:     d.File,
+			DefStart: d.Start,
+			DefEnd:   d.End,
+		}
+		if d.Data != nil {
+			if b, err := json.Marshal(d.Data); err == nil {
+				defs[i].Data = b
+			}
+		}
+	}
+
+	refs := make([]*graph.Ref, len(drefs))
+	for i, r := range drefs {
+		refs[i] = &graph.Ref{
+			DefRepo:     r.DefRepo,
+			DefUnitType: r.Lang,
+			DefUnit:     r.DefUnit,
+			DefPath:     r.DefPath,
+			Repo:        r.Repo,
+			UnitType:    r.Lang,
+			Unit:        r.Unit,
+			File:        r.File,
+			Start:       r.Start,
+			End:         r.End,
+			Enclosing:   r.Enclosing,
+			Kind:        r.Kind,
+		}
+	}
+	return defs, refs
+}
@@ -1,3 +1,7 @@
+// Package data holds the older stored def and ref types.
+//
+// Deprecated: Use the graph package, whose defs and refs have full srclib
+// keys; ToGraph converts these.
 package data
 
 // START OMIT
@@ -5,8 +9,14 @@ package data
 type Def struct {
 	Path       string // unique identifier for this definition in its package
 	Name       string
+	Kind       string // kind of definition, such as "func", "type" or "var"
+	Type       string
+	Callable   bool
+	Exported   bool
+	Scope      string // "local", "file", "package" or "exported" (see lang.ScopeLocal, etc.)
 	Start, End int
 	File       string
+	Unit       string // source unit (e.g., Go package or JS file) that defines it
 	Repo       string
 	Lang       string
 	Data       interface{} // extra language-specific info about this definition
@@ -14,11 +24,15 @@ type Def struct {
 
 type Ref struct {
 	DefPath    string
+	DefUnit    string
 	DefRepo    string
 	File       string
+	Unit       string
 	Repo       string
 	Start, End int
 	Lang       string
+	Enclosing  string // path of the def (in Repo and Unit) whose body contains this ref
+	Kind       string // "call", "read", "write", "import", "type", "decl" or "impl" (see lang.RefCall, etc.)
 }
 
 // END OMIT
@@ -6,8 +6,12 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/google/go-querystring/query"
+	"github.com/sourcegraph/talks/google-io-2014/defsearch"
+	"github.com/sourcegraph/talks/google-io-2014/graph"
 	"github.com/sqs/mux"
 	"github.com/sqs/schema"
 )
@@ -17,6 +21,7 @@ type RepositoriesService interface {
 	Get(name string) (*Repo, error)
 	List() ([]*Repo, error)
 	Search(opt *SearchOptions) ([]*Repo, error)
+	SearchDefs(opt *defsearch.Options) ([]*defsearch.Result, error) // OMIT
 	// ...
 }
 
@@ -73,17 +78,27 @@ func handleRepoSearch(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
+func handleDefSearch(w http.ResponseWriter, r *http.Request) {
+	var opt defsearch.Options
+	d.Decode(&opt, r.URL.Query())
+	results, _ := repoDataStore.SearchDefs(&opt)
+	b, _ := json.Marshal(results)
+	w.Write(b)
+}
+
 // START API ROUTER OMIT
 const (
-	RepoGetRoute    = "repo"
-	RepoListRoute   = "repo.list"
-	RepoSearchRoute = "repo.search" // OMIT
+	RepoGetRoute        = "repo"
+	RepoListRoute       = "repo.list"
+	RepoSearchRoute     = "repo.search"      // OMIT
+	RepoSearchDefsRoute = "repo.search-defs" // OMIT
 )
 
 func NewAPIRouter() *mux.Router {
 	m := mux.NewRouter()
 	// define the routes // HL
-	m.Path("/api/repos/search").Name(RepoSearchRoute) // OMIT
+	m.Path("/api/repos/search").Name(RepoSearchRoute)          // OMIT
+	m.Path("/api/repos/search/defs").Name(RepoSearchDefsRoute) // OMIT
 	m.Path("/api/repos/{Name:.*}").Name(RepoGetRoute)
 	m.Path("/api/repos").Name(RepoListRoute)
 	return m
@@ -95,6 +110,7 @@ func init() {
 	m.Get(RepoGetRoute).HandlerFunc(handleRepoGet)
 	m.Get(RepoListRoute).HandlerFunc(handleRepoList)
 	m.Get(RepoSearchRoute).HandlerFunc(handleRepoSearch)
+	m.Get(RepoSearchDefsRoute).HandlerFunc(handleDefSearch) // OMIT
 	http.Handle("/api/", m)
 }
 
@@ -184,6 +200,19 @@ func (s *repoClient) Search(opt *SearchOptions) ([]*Repo, error) {
 
 // END CLIENT SEARCH OMIT
 
+func (s *repoClient) SearchDefs(opt *defsearch.Options) ([]*defsearch.Result, error) {
+	url, _ := apiRouter.Get(RepoSearchDefsRoute).URL()
+	q, _ := query.Values(opt)
+	resp, err := http.Get(s.baseURL + url.String() + "?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var results []*defsearch.Result
+	return results, json.NewDecoder(resp.Body).Decode(&results)
+}
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // START STORE OMIT
@@ -203,12 +232,57 @@ func (s *repoStore) Search(opt *SearchOptions) ([]*Repo, error) {
 	return []*Repo{{"myrepo", "git://github.com/foo/myrepo.git"}, {"mux", "git://github.com/gorilla/mux.git"}}, nil
 }
 
+// The def index is built from all stored defs and refs, and rebuilt on the
+// next search after a graph is stored (when the latest stored_at changes).
+var defIndex struct {
+	sync.Mutex
+	storedAt time.Time // of the latest graph in the index
+	index    *defsearch.Index
+}
+
+func (s *repoStore) SearchDefs(opt *defsearch.Options) ([]*defsearch.Result, error) {
+	var storedAt time.Time
+	if err := s.db.Select(&storedAt, "SELECT max(stored_at) FROM graph"); err != nil {
+		return nil, err
+	}
+
+	defIndex.Lock()
+	defer defIndex.Unlock()
+	if defIndex.index == nil || !storedAt.Equal(defIndex.storedAt) {
+		var defs []*graph.Def
+		var refs []*graph.Ref
+		if err := s.db.Select(&defs, "SELECT * FROM def"); err != nil {
+			return nil, err
+		}
+		if err := s.db.Select(&refs, "SELECT * FROM ref"); err != nil {
+			return nil, err
+		}
+		defIndex.index, defIndex.storedAt = defsearch.New(defs, refs), storedAt
+	}
+	return defIndex.index.Search(opt), nil
+}
+
 type db struct{}
 
 func (_ *db) Select(v interface{}, sql string, args ...interface{}) error {
-	if repo, ok := v.(**Repo); ok {
+	switch v := v.(type) {
+	case *time.Time:
+		*v = time.Date(2014, 6, 25, 0, 0, 0, 0, time.UTC)
+	case **Repo:
 		name, _ := args[0].(string)
-		*repo = &Repo{filepath.Base(name), "git://" + name + ".git"}
+		*v = &Repo{filepath.Base(name), "git://" + name + ".git"}
+	case *[]*graph.Def:
+		*v = []*graph.Def{
+			{DefKey: graph.DefKey{Repo: "github.com/gorilla/mux", UnitType: "go", Path: "NewRouter"}, Name: "NewRouter", Kind: "func", Exported: true},
+			{DefKey: graph.DefKey{Repo: "github.com/gorilla/mux", UnitType: "go", Path: "Router/HandleFunc"}, Name: "HandleFunc", Kind: "method", Exported: true},
+			{DefKey: graph.DefKey{Repo: "github.com/gorilla/mux", UnitType: "go", Path: "newRouteRegexp"}, Name: "newRouteRegexp", Kind: "func"},
+			{DefKey: graph.DefKey{Repo: "myrepo", UnitType: "js", Path: "openFile"}, Name: "openFile", Kind: "function"},
+		}
+	case *[]*graph.Ref:
+		*v = []*graph.Ref{
+			{DefPath: "NewRouter", DefRepo: "github.com/gorilla/mux", DefUnitType: "go", Repo: "myrepo", UnitType: "go"},
+			{DefPath: "Router/HandleFunc", DefRepo: "github.com/gorilla/mux", DefUnitType: "go", Repo: "myrepo", UnitType: "go"},
+		}
 	}
 	return nil
 }
@@ -1,7 +1,10 @@
 package apihandlers
 
 import (
+	"encoding/json"
+	"log"
 	"net/http"
+	"sort"
 
 	"github.com/sourcegraph/talks/google-io-2014/part1/client"
 	"github.com/sourcegraph/talks/google-io-2014/part1/datastore"
@@ -10,14 +13,58 @@ import (
 )
 
 // use github.com/gorilla/schema to decode querystrings to param structs
-var schemaDecoder = schema.NewDecoder()
+var schemaDecoder = queryDecoder{schema.NewDecoder()}
+
+// A queryDecoder decodes querystrings to param structs. If a querystring
+// can't be decoded, Decode returns a 400 *client.ErrorResponse with an error
+// for each invalid param, instead of an error that handleErr would respond to
+// with a 500.
+type queryDecoder struct{ *schema.Decoder }
+
+func (d queryDecoder) Decode(dst interface{}, src map[string][]string) error {
+	err := d.Decoder.Decode(dst, src)
+	if err == nil {
+		return nil
+	}
+	errResp := &client.ErrorResponse{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "invalid",
+		Message:        "invalid query parameters",
+	}
+	multi, ok := err.(schema.MultiError)
+	if !ok {
+		errResp.Message = err.Error()
+		return errResp
+	}
+	fields := make([]string, 0, len(multi))
+	for field := range multi {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		errResp.Errors = append(errResp.Errors, &client.FieldError{Field: field, Code: "invalid", Message: multi[field].Error()})
+	}
+	return errResp
+}
 
 // START ROUTER OMIT
 func init() {
 	r := client.NewAPIRouter()
 	// Get existing named route and mount a handler on it
+	r.Get(client.ReposRoute).Handler(handleErr(serveRepos))
 	r.Get(client.RepoRoute).Handler(handleErr(serveRepo))
-	http.Handle("/api", r)
+	r.Get(client.RepoDependenciesRoute).Handler(handleErr(serveRepoDependencies))
+	r.Get(client.DefsRoute).Handler(handleErr(serveDefs))
+	r.Get(client.DefRoute).Handler(handleErr(serveDef))
+	r.Get(client.DefRefsRoute).Handler(handleErr(serveDefRefs))
+	r.Get(client.DefCallersRoute).Handler(handleErr(serveDefCallers))
+	r.Get(client.DefCalleesRoute).Handler(handleErr(serveDefCallees))
+	r.Get(client.DefCallPathsRoute).Handler(handleErr(serveDefCallPaths))
+	r.Get(client.RepoUnusedRoute).Handler(handleErr(serveRepoUnused))
+	r.Get(client.RepoDiffRoute).Handler(handleErr(serveRepoDiff))
+	r.Get(client.RepoAuthorsRoute).Handler(handleErr(serveRepoAuthors))
+	r.Get(client.CodeSearchRoute).Handler(handleErr(serveCodeSearch))
+	http.Handle("/api/", http.StripPrefix("/api", r))
 }
 
 // END ROUTER OMIT
@@ -33,19 +80,61 @@ func serveRepo(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	repo, resp, err := store.Repositories.Get(routeVars["Repo"], &opt) // reuse data store // HL
+	repo, resp, err := store.Repositories.GetContext(r.Context(), routeVars["Repo"], &opt) // reuse data store // HL
 	if err != nil {
 		return err
 	}
 
 	// check authorization, rate limits, etc., here.
 
-	return writeJSON(repo, resp) // reuse pagination & cache info from data store // HL
+	return writeJSON(w, repo, resp) // reuse pagination & cache info from data store // HL
 }
 
 // END OMIT
 
+// writeJSON writes v as the JSON response body, with the caching headers of
+// resp (from the data store), if any.
+func writeJSON(w http.ResponseWriter, v interface{}, resp *client.Response) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if resp != nil {
+		if resp.ETag != "" {
+			w.Header().Set("ETag", resp.ETag)
+		}
+		if !resp.LastModified.IsZero() {
+			w.Header().Set("Last-Modified", resp.LastModified.UTC().Format(http.TimeFormat))
+		}
+		if resp.CacheControl != "" {
+			w.Header().Set("Cache-Control", resp.CacheControl)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, err = w.Write(data)
+	return err
+}
+
+// handleErr serves an API endpoint. If it fails, handleErr responds with the
+// error's HTTP status and an ErrorResponse JSON body, which the API client
+// decodes (see client.CheckResponse). Errors that aren't *ErrorResponses
+// are logged and responded to with a 500.
 type handleErr func(http.ResponseWriter, *http.Request) error
 
-// dummy
-func (_ handleErr) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+func (h handleErr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := h(w, r)
+	if err == nil {
+		return
+	}
+	errResp, ok := err.(*client.ErrorResponse)
+	if !ok {
+		log.Printf("%s: %s", r.URL, err)
+		errResp = &client.ErrorResponse{
+			HTTPStatusCode: http.StatusInternalServerError,
+			Message:        http.StatusText(http.StatusInternalServerError),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errResp.HTTPStatusCode)
+	json.NewEncoder(w).Encode(errResp)
+}
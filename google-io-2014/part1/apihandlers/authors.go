@@ -0,0 +1,23 @@
+package apihandlers
+
+import (
+	"net/http"
+
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+	"github.com/sqs/mux"
+)
+
+// serveRepoAuthors lists the authors of the defs in a repo, by the amount of
+// code they wrote.
+func serveRepoAuthors(w http.ResponseWriter, r *http.Request) error {
+	var opt client.ListAuthorsOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	authors, resp, err := store.Repositories.ListAuthorsContext(r.Context(), mux.Vars(r)["Repo"], &opt)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, authors, resp)
+}
@@ -0,0 +1,54 @@
+package apihandlers
+
+import (
+	"net/http"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+	"github.com/sqs/mux"
+)
+
+// routeDefKey returns the key (without a CommitID) of the def in r's route.
+func routeDefKey(r *http.Request) graph.DefKey {
+	v := mux.Vars(r)
+	return graph.DefKey{Repo: v["Repo"], UnitType: v["UnitType"], Unit: client.UnitFromRouteVar(v["Unit"]), Path: v["Path"]}
+}
+
+func serveDefCallers(w http.ResponseWriter, r *http.Request) error {
+	var opt client.CallGraphOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	calls, resp, err := store.Code.CallersContext(r.Context(), routeDefKey(r), &opt)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, calls, resp)
+}
+
+func serveDefCallees(w http.ResponseWriter, r *http.Request) error {
+	var opt client.CallGraphOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	calls, resp, err := store.Code.CalleesContext(r.Context(), routeDefKey(r), &opt)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, calls, resp)
+}
+
+func serveDefCallPaths(w http.ResponseWriter, r *http.Request) error {
+	var opt client.CallPathsOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	paths, resp, err := store.Code.CallPathsContext(r.Context(), routeDefKey(r), &opt)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, paths, resp)
+}
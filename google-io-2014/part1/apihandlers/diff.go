@@ -0,0 +1,22 @@
+package apihandlers
+
+import (
+	"net/http"
+
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+	"github.com/sqs/mux"
+)
+
+// serveRepoDiff compares the defs and refs of a repo at two commits.
+func serveRepoDiff(w http.ResponseWriter, r *http.Request) error {
+	var opt client.CodeDiffOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	diff, resp, err := store.Code.DiffContext(r.Context(), mux.Vars(r)["Repo"], &opt)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, diff, resp)
+}
@@ -0,0 +1,50 @@
+package apihandlers
+
+import (
+	"net/http"
+
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+)
+
+func serveDef(w http.ResponseWriter, r *http.Request) error {
+	var opt client.CodeGetOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	def, resp, err := store.Code.GetContext(r.Context(), routeDefKey(r), &opt)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, def, resp)
+}
+
+func serveDefs(w http.ResponseWriter, r *http.Request) error {
+	var opt client.CodeListDefOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	defs, resp, err := store.Code.ListContext(r.Context(), &opt)
+	if err != nil {
+		return err
+	}
+	setLinkHeader(w, r, resp)
+	return writeJSON(w, defs, resp)
+}
+
+// serveDefRefs lists the refs to a def in its repo, optionally only those of
+// the kinds in CodeListRefsOptions.Kind.
+func serveDefRefs(w http.ResponseWriter, r *http.Request) error {
+	var opt client.CodeListRefsOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	refs, resp, err := store.Code.ListRefsContext(r.Context(), routeDefKey(r), &opt)
+	if err != nil {
+		return err
+	}
+	setLinkHeader(w, r, resp)
+	return writeJSON(w, refs, resp)
+}
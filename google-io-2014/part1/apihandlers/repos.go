@@ -0,0 +1,64 @@
+package apihandlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+	"github.com/sqs/mux"
+)
+
+func serveRepos(w http.ResponseWriter, r *http.Request) error {
+	var opt client.ListOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	repos, resp, err := store.Repositories.ListContext(r.Context(), &opt)
+	if err != nil {
+		return err
+	}
+	setLinkHeader(w, r, resp)
+	return writeJSON(w, repos, resp)
+}
+
+func serveRepoDependencies(w http.ResponseWriter, r *http.Request) error {
+	var opt client.ListDependenciesOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	deps, resp, err := store.Repositories.ListDependenciesContext(r.Context(), mux.Vars(r)["Repo"], &opt)
+	if err != nil {
+		return err
+	}
+	setLinkHeader(w, r, resp)
+	return writeJSON(w, deps, resp)
+}
+
+// setLinkHeader sets the Link header to link to the pages in resp (from the
+// data store), which are the same URL as r with a different Page.
+func setLinkHeader(w http.ResponseWriter, r *http.Request, resp *client.Response) {
+	if resp == nil {
+		return
+	}
+	var links []string
+	for _, l := range []struct {
+		rel  string
+		page int
+	}{{"first", resp.FirstPage}, {"prev", resp.PrevPage}, {"next", resp.NextPage}, {"last", resp.LastPage}} {
+		if l.page == 0 {
+			continue
+		}
+		u := *r.URL
+		q := u.Query()
+		q.Set("Page", strconv.Itoa(l.page))
+		u.RawQuery = q.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel=%q`, u.String(), l.rel))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
@@ -0,0 +1,21 @@
+package apihandlers
+
+import (
+	"net/http"
+
+	"github.com/sourcegraph/talks/google-io-2014/codesearch"
+)
+
+// serveCodeSearch searches the contents of the indexed repos' files.
+func serveCodeSearch(w http.ResponseWriter, r *http.Request) error {
+	var q codesearch.Query
+	if err := schemaDecoder.Decode(&q, r.URL.Query()); err != nil {
+		return err
+	}
+
+	matches, resp, err := store.Code.SearchContext(r.Context(), &q)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, matches, resp)
+}
@@ -0,0 +1,35 @@
+package apihandlers
+
+import (
+	"net/http"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+	"github.com/sourcegraph/talks/google-io-2014/unused"
+	"github.com/sqs/mux"
+)
+
+// serveRepoUnused lists the defs in a repo that nothing refers to, in the same
+// JSON format as "srcgraph unused".
+func serveRepoUnused(w http.ResponseWriter, r *http.Request) error {
+	repo := mux.Vars(r)["Repo"]
+	var opt client.UnusedOptions
+	if err := schemaDecoder.Decode(&opt, r.URL.Query()); err != nil {
+		return err
+	}
+
+	defs, err := store.Graph.DefsContext(r.Context(), repo, opt.CommitID)
+	if err != nil {
+		return err
+	}
+	refs, err := store.Graph.RefsContext(r.Context(), repo, opt.CommitID)
+	if err != nil {
+		return err
+	}
+
+	found := unused.Find(defs, refs)
+	if found == nil {
+		found = []*graph.Def{}
+	}
+	return writeJSON(w, found, nil)
+}
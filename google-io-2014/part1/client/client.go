@@ -1,13 +1,111 @@
 package client
 
-import "net/http"
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-querystring/query"
+)
 
 // START OMIT
 
 func New(c *http.Client) *Client {
-	return &Client{Repositories: &repositoriesClient{c}}
+	if c == nil {
+		c = http.DefaultClient
+	}
+	baseURL, _ := url.Parse(defaultBaseURL)
+	client := &Client{BaseURL: baseURL, httpClient: c}
+	client.Repositories = &repositoriesClient{client}
+	client.Code = &codeService{client}
+	return client
 }
 
-type Client struct{ Repositories RepositoriesService }
+type Client struct {
+	Repositories RepositoriesService
+	Code         CodeService
+
+	// BaseURL is the URL of the API, which the paths of the API router's
+	// routes are relative to. It must end in a slash.
+	BaseURL *url.URL
+
+	httpClient *http.Client
+}
 
 // END OMIT
+
+const defaultBaseURL = "https://sourcegraph.com/api/"
+
+// apiRouter is used to generate the URLs of API requests.
+var apiRouter = NewAPIRouter()
+
+// url returns the URL of the API route with the given name, with the route
+// vars in vars, and with the fields of opt (a url-tagged option struct, or
+// nil) encoded in its querystring with github.com/google/go-querystring.
+func (c *Client) url(routeName string, vars map[string]string, opt interface{}) (*url.URL, error) {
+	var pairs []string
+	for name, val := range vars {
+		pairs = append(pairs, name, val)
+	}
+	route := apiRouter.Get(routeName)
+	if route == nil {
+		return nil, fmt.Errorf("no API route named %q", routeName)
+	}
+	u, err := route.URLPath(pairs...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Append the route's path to BaseURL's path (e.g., "/api/"). Resolving
+	// it as a relative URL would also remove "." and ".." segments, which
+	// can be part of route vars.
+	full := *c.BaseURL
+	full.Path = strings.TrimSuffix(full.Path, "/") + u.Path
+	full.RawPath, full.RawQuery, full.Fragment = "", "", ""
+	if opt != nil {
+		q, err := query.Values(opt)
+		if err != nil {
+			return nil, err
+		}
+		full.RawQuery = q.Encode()
+	}
+	return &full, nil
+}
+
+// NewRequest returns an API request for the URL u (from url).
+func (c *Client) NewRequest(method string, u *url.URL, body io.Reader) (*http.Request, error) {
+	return c.NewRequestContext(context.Background(), method, u, body)
+}
+
+// NewRequestContext is like NewRequest, but the request is cancelled (and Do
+// returns an error) when ctx is done.
+func (c *Client) NewRequestContext(ctx context.Context, method string, u *url.URL, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// Do sends an API request and decodes the response body into v (if it isn't
+// nil). If the API responds with an error, Do returns it as an
+// *ErrorResponse (see CheckResponse).
+func (c *Client) Do(req *http.Request, v interface{}) (*Response, error) {
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	resp := newResponse(httpResp)
+	if err := CheckResponse(httpResp); err != nil {
+		return resp, err
+	}
+	if v != nil {
+		err = unmarshalResponse(resp.Body, v)
+	}
+	return resp, err
+}
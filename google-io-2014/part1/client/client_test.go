@@ -0,0 +1,69 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sqs/mux"
+)
+
+// newTestServer returns a client for an API server that serves r under
+// /api/ (as the API handlers do), behind an http.ServeMux, which cleans
+// request paths.
+func newTestServer(t *testing.T, r *mux.Router) *Client {
+	m := http.NewServeMux()
+	m.Handle("/api/", http.StripPrefix("/api", r))
+	ts := httptest.NewServer(m)
+	t.Cleanup(ts.Close)
+
+	c := New(nil)
+	var err error
+	if c.BaseURL, err = url.Parse(ts.URL + "/api/"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCodeGet_units(t *testing.T) {
+	var got graph.DefKey
+	r := NewAPIRouter()
+	r.Get(DefRoute).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		v := mux.Vars(req)
+		got = graph.DefKey{Repo: v["Repo"], UnitType: v["UnitType"], Unit: UnitFromRouteVar(v["Unit"]), Path: v["Path"]}
+		w.Write([]byte("{}"))
+	})
+	r.Get(RepoRoute).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "routed to the repo route", http.StatusNotFound)
+	})
+	c := newTestServer(t, r)
+
+	for _, unit := range []string{".", "sub/pkg", "_", "_internal/x.js", "a/.b"} {
+		got = graph.DefKey{}
+		want := graph.DefKey{Repo: "github.com/gorilla/mux", UnitType: "go", Unit: unit, Path: "Router/ServeHTTP"}
+		if _, _, err := c.Code.Get(want, nil); err != nil {
+			t.Errorf("unit %q: %s", unit, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("unit %q: got request for %+v, want %+v", unit, got, want)
+		}
+	}
+}
+
+func TestClientURL_baseURLPath(t *testing.T) {
+	c := New(nil)
+	var err error
+	if c.BaseURL, err = url.Parse("https://example.com/api/v1/"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := c.url(DefRoute, defRouteVars(graph.DefKey{Repo: "r", UnitType: "go", Unit: ".", Path: "P"}), &CodeGetOptions{CommitID: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://example.com/api/v1/repos/r/.units/go/_/.defs/P?CommitID=c"; u.String() != want {
+		t.Errorf("got URL %s, want %s", u, want)
+	}
+}
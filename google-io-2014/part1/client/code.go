@@ -1,21 +1,327 @@
 package client
 
+import (
+	"context"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/callgraph"
+	"github.com/sourcegraph/talks/google-io-2014/codesearch"
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/graphdiff"
+)
+
 // START IFACE OMIT
 type CodeService interface {
-	Get(def DefSpec, opt *CodeGetOptions) (*Def, Response, error)
-	List(opt *CodeListDefOptions) ([]*Def, Response, error)
-	ListRefs(def DefSpec, opt *CodeListRefsOptions) ([]*Ref, Response, error)
+	Get(def graph.DefKey, opt *CodeGetOptions) (*Def, *Response, error)
+	List(opt *CodeListDefOptions) ([]*Def, *Response, error)
+	ListRefs(def graph.DefKey, opt *CodeListRefsOptions) ([]*Ref, *Response, error)
+	Diff(repo string, opt *CodeDiffOptions) (*graphdiff.Diff, *Response, error)
+	Callers(def graph.DefKey, opt *CallGraphOptions) (*DefCalls, *Response, error)
+	Callees(def graph.DefKey, opt *CallGraphOptions) (*DefCalls, *Response, error)
+	CallPaths(from graph.DefKey, opt *CallPathsOptions) ([]callgraph.Path, *Response, error)
+	Search(q *codesearch.Query) ([]*codesearch.Match, *Response, error)
 	// ...
+	// Context variants, which are cancelled when ctx is done. // OMIT
+	GetContext(ctx context.Context, def graph.DefKey, opt *CodeGetOptions) (*Def, *Response, error)                      // OMIT
+	ListContext(ctx context.Context, opt *CodeListDefOptions) ([]*Def, *Response, error)                                 // OMIT
+	ListRefsContext(ctx context.Context, def graph.DefKey, opt *CodeListRefsOptions) ([]*Ref, *Response, error)          // OMIT
+	DiffContext(ctx context.Context, repo string, opt *CodeDiffOptions) (*graphdiff.Diff, *Response, error)              // OMIT
+	CallersContext(ctx context.Context, def graph.DefKey, opt *CallGraphOptions) (*DefCalls, *Response, error)           // OMIT
+	CalleesContext(ctx context.Context, def graph.DefKey, opt *CallGraphOptions) (*DefCalls, *Response, error)           // OMIT
+	CallPathsContext(ctx context.Context, from graph.DefKey, opt *CallPathsOptions) ([]callgraph.Path, *Response, error) // OMIT
+	SearchContext(ctx context.Context, q *codesearch.Query) ([]*codesearch.Match, *Response, error)                      // OMIT
 }
 
 // END IFACE OMIT
 
-type Def struct{}
-type Ref struct{}
-type DefSpec struct{}
-type CodeGetOptions struct{}
-type CodeListDefOptions struct{}
-type CodeListRefsOptions struct{}
-type CodeDependency struct{}
+// Def and Ref are the graph types, as the API returns them.
+type Def struct{ graph.Def }
+type Ref struct{ graph.Ref }
+
+// defRouteVars returns the route vars of the API routes of def. Its CommitID
+// isn't a route var, so the methods that take a def use it as the options'
+// CommitID if that's empty.
+func defRouteVars(def graph.DefKey) map[string]string {
+	return map[string]string{"Repo": def.Repo, "UnitType": def.UnitType, "Unit": UnitRouteVar(def.Unit), "Path": def.Path}
+}
+
+// UnitRouteVar returns unit as it appears in the Unit var of API routes, and
+// UnitFromRouteVar reverses it. The unit ".", a repo's root dir (such as its
+// root Go package), is "_", because a "." path segment is removed when a URL
+// is resolved or its path is cleaned. Units that start with "_" get another
+// "_", so that they aren't mistaken for it.
+func UnitRouteVar(unit string) string {
+	if unit == "." || strings.HasPrefix(unit, "_") {
+		return "_" + strings.TrimPrefix(unit, ".")
+	}
+	return unit
+}
+
+func UnitFromRouteVar(v string) string {
+	if v == "_" {
+		return "."
+	}
+	return strings.TrimPrefix(v, "_")
+}
+
+// CodeGetOptions specifies the commit to get a def at. If CommitID is empty,
+// it's the latest commit of the def's repo that was analyzed.
+type CodeGetOptions struct {
+	CommitID string `url:",omitempty"`
+}
+
+// CodeListDefOptions specifies which defs to list, and the page of them. The
+// filters that are set must all match. Defs can be sorted by "path" (the
+// default, which sorts by unit type, unit and path) or "name".
+type CodeListDefOptions struct {
+	Repo     string   `url:",omitempty"`
+	CommitID string   `url:",omitempty"` // only used if Repo is set (latest commit if empty)
+	UnitType string   `url:",omitempty"`
+	Unit     string   `url:",omitempty"`
+	Name     string   `url:",omitempty"`
+	Kind     []string `url:",omitempty"`
+	Exported bool     `url:",omitempty"` // only list exported defs
+	ListOptions
+}
+
+// CodeListRefsOptions specifies the commit to list a def's refs at, which
+// kinds of refs to list (e.g., only lang.RefWrite to find where a variable is
+// assigned, or all kinds if empty), and the page of them. If CommitID is
+// empty, it's the latest commit that was analyzed.
+type CodeListRefsOptions struct {
+	CommitID string   `url:",omitempty"`
+	Kind     []string `url:",omitempty"`
+	ListOptions
+}
+
+// CodeDiffOptions specifies the two commits whose code graphs are compared.
+// Base is required, and Head is the latest commit that was analyzed if it's
+// empty.
+type CodeDiffOptions struct {
+	Base string `url:",omitempty"`
+	Head string `url:",omitempty"`
+}
+
+type codeService struct{ client *Client }
+
+func (c *codeService) Get(def graph.DefKey, opt *CodeGetOptions) (*Def, *Response, error) {
+	return c.GetContext(context.Background(), def, opt)
+}
+
+func (c *codeService) GetContext(ctx context.Context, def graph.DefKey, opt *CodeGetOptions) (*Def, *Response, error) {
+	if opt == nil {
+		opt = &CodeGetOptions{}
+	}
+	if opt.CommitID == "" {
+		opt = &CodeGetOptions{CommitID: def.CommitID}
+	}
+	url, err := c.client.url(DefRoute, defRouteVars(def), opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var def_ Def
+	resp, err := c.client.Do(req, &def_)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &def_, resp, nil
+}
+
+func (c *codeService) List(opt *CodeListDefOptions) ([]*Def, *Response, error) {
+	return c.ListContext(context.Background(), opt)
+}
 
-type codeService struct{}
+func (c *codeService) ListContext(ctx context.Context, opt *CodeListDefOptions) ([]*Def, *Response, error) {
+	url, err := c.client.url(DefsRoute, nil, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var defs []*Def
+	resp, err := c.client.Do(req, &defs)
+	if err != nil {
+		return nil, resp, err
+	}
+	return defs, resp, nil
+}
+
+func (c *codeService) ListRefs(def graph.DefKey, opt *CodeListRefsOptions) ([]*Ref, *Response, error) {
+	return c.ListRefsContext(context.Background(), def, opt)
+}
+
+func (c *codeService) ListRefsContext(ctx context.Context, def graph.DefKey, opt *CodeListRefsOptions) ([]*Ref, *Response, error) {
+	if opt == nil {
+		opt = &CodeListRefsOptions{}
+	}
+	if opt.CommitID == "" {
+		o := *opt
+		o.CommitID = def.CommitID
+		opt = &o
+	}
+	url, err := c.client.url(DefRefsRoute, defRouteVars(def), opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var refs []*Ref
+	resp, err := c.client.Do(req, &refs)
+	if err != nil {
+		return nil, resp, err
+	}
+	return refs, resp, nil
+}
+
+func (c *codeService) Diff(repo string, opt *CodeDiffOptions) (*graphdiff.Diff, *Response, error) {
+	return c.DiffContext(context.Background(), repo, opt)
+}
+
+func (c *codeService) DiffContext(ctx context.Context, repo string, opt *CodeDiffOptions) (*graphdiff.Diff, *Response, error) {
+	url, err := c.client.url(RepoDiffRoute, map[string]string{"Repo": repo}, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var diff graphdiff.Diff
+	resp, err := c.client.Do(req, &diff)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &diff, resp, nil
+}
+
+func (c *codeService) Callers(def graph.DefKey, opt *CallGraphOptions) (*DefCalls, *Response, error) {
+	return c.CallersContext(context.Background(), def, opt)
+}
+
+func (c *codeService) CallersContext(ctx context.Context, def graph.DefKey, opt *CallGraphOptions) (*DefCalls, *Response, error) {
+	return c.defCalls(ctx, DefCallersRoute, def, opt)
+}
+
+func (c *codeService) Callees(def graph.DefKey, opt *CallGraphOptions) (*DefCalls, *Response, error) {
+	return c.CalleesContext(context.Background(), def, opt)
+}
+
+func (c *codeService) CalleesContext(ctx context.Context, def graph.DefKey, opt *CallGraphOptions) (*DefCalls, *Response, error) {
+	return c.defCalls(ctx, DefCalleesRoute, def, opt)
+}
+
+func (c *codeService) defCalls(ctx context.Context, route string, def graph.DefKey, opt *CallGraphOptions) (*DefCalls, *Response, error) {
+	if opt == nil {
+		opt = &CallGraphOptions{}
+	}
+	if opt.CommitID == "" {
+		o := *opt
+		o.CommitID = def.CommitID
+		opt = &o
+	}
+	url, err := c.client.url(route, defRouteVars(def), opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var calls DefCalls
+	resp, err := c.client.Do(req, &calls)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &calls, resp, nil
+}
+
+func (c *codeService) CallPaths(from graph.DefKey, opt *CallPathsOptions) ([]callgraph.Path, *Response, error) {
+	return c.CallPathsContext(context.Background(), from, opt)
+}
+
+func (c *codeService) CallPathsContext(ctx context.Context, from graph.DefKey, opt *CallPathsOptions) ([]callgraph.Path, *Response, error) {
+	if opt == nil {
+		opt = &CallPathsOptions{}
+	}
+	if opt.CommitID == "" {
+		o := *opt
+		o.CommitID = from.CommitID
+		opt = &o
+	}
+	url, err := c.client.url(DefCallPathsRoute, defRouteVars(from), opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var paths []callgraph.Path
+	resp, err := c.client.Do(req, &paths)
+	if err != nil {
+		return nil, resp, err
+	}
+	return paths, resp, nil
+}
+
+func (c *codeService) Search(q *codesearch.Query) ([]*codesearch.Match, *Response, error) {
+	return c.SearchContext(context.Background(), q)
+}
+
+func (c *codeService) SearchContext(ctx context.Context, q *codesearch.Query) ([]*codesearch.Match, *Response, error) {
+	url, err := c.client.url(CodeSearchRoute, nil, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var matches []*codesearch.Match
+	resp, err := c.client.Do(req, &matches)
+	if err != nil {
+		return nil, resp, err
+	}
+	return matches, resp, nil
+}
+
+// CallGraphOptions specifies the commit whose call graph is used to list the
+// callers or callees of a def.
+type CallGraphOptions struct {
+	CommitID string `url:",omitempty"`
+
+	// Depth, if greater than 1, also lists the defs that reach (or are
+	// reached by) the def through up to Depth calls.
+	Depth int `url:",omitempty"`
+}
+
+// CallPathsOptions specifies the def (in the same repo) that call paths lead
+// to, and limits their length and number. ToUnitType is the from def's unit
+// type if it's empty.
+type CallPathsOptions struct {
+	CommitID   string `url:",omitempty"`
+	ToUnitType string `url:",omitempty"`
+	ToUnit     string
+	ToPath     string
+	Depth      int `url:",omitempty"`
+	Limit      int `url:",omitempty"`
+}
+
+// UnusedOptions specifies the commit to find unused defs in.
+type UnusedOptions struct {
+	CommitID string `url:",omitempty"`
+}
+
+// DefCalls lists the calls to or from a def.
+type DefCalls struct {
+	Calls      []*callgraph.Call   // direct calls, with call sites
+	Transitive []callgraph.Reached `json:",omitempty"` // only if CallGraphOptions.Depth > 1
+}
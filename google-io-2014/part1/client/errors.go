@@ -0,0 +1,98 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// An ErrorResponse is an error that the API responded with (in a non-2xx
+// response), such as a 404 for a repo that doesn't exist.
+type ErrorResponse struct {
+	Response *http.Response `json:"-"` // the HTTP response that the API returned
+
+	HTTPStatusCode int           `json:"-"`
+	Code           string        `json:",omitempty"` // machine-readable error code, such as "not_found"
+	Message        string        `json:",omitempty"`
+	Errors         []*FieldError `json:",omitempty"` // validation errors in the request's params
+}
+
+// A FieldError is a validation error in a request param (such as a field of
+// an option struct).
+type FieldError struct {
+	Field   string
+	Code    string `json:",omitempty"` // such as "missing" or "invalid"
+	Message string `json:",omitempty"`
+}
+
+func (r *ErrorResponse) Error() string {
+	msg := r.Message
+	if msg == "" {
+		msg = http.StatusText(r.HTTPStatusCode)
+	}
+	for _, fe := range r.Errors {
+		msg += fmt.Sprintf("; %s: %s", fe.Field, fe.Message)
+	}
+	if r.Response != nil && r.Response.Request != nil {
+		return fmt.Sprintf("%s %s: %d %s", r.Response.Request.Method, r.Response.Request.URL, r.HTTPStatusCode, msg)
+	}
+	return fmt.Sprintf("%d %s", r.HTTPStatusCode, msg)
+}
+
+// CheckResponse returns an *ErrorResponse if r is a non-2xx response, with
+// the error info in its JSON body (if any).
+func CheckResponse(r *http.Response) error {
+	if c := r.StatusCode; 200 <= c && c <= 299 {
+		return nil
+	}
+	errResp := &ErrorResponse{Response: r}
+	if body, err := ioutil.ReadAll(r.Body); err == nil && len(body) > 0 {
+		json.Unmarshal(body, errResp)
+	}
+	errResp.HTTPStatusCode = r.StatusCode
+	return errResp
+}
+
+// HTTPStatusCode returns the HTTP status code of the API error err, or 500
+// if err isn't an *ErrorResponse.
+func HTTPStatusCode(err error) int {
+	if e, ok := err.(*ErrorResponse); ok {
+		return e.HTTPStatusCode
+	}
+	return http.StatusInternalServerError
+}
+
+// IsNotFound reports whether err is an API error for something that doesn't
+// exist (a 404).
+func IsNotFound(err error) bool { return isStatus(err, http.StatusNotFound) }
+
+// IsUnauthorized reports whether err is an API error for a request that
+// needs authentication (a 401).
+func IsUnauthorized(err error) bool { return isStatus(err, http.StatusUnauthorized) }
+
+// IsForbidden reports whether err is an API error for a request that isn't
+// allowed (a 403).
+func IsForbidden(err error) bool { return isStatus(err, http.StatusForbidden) }
+
+// IsInvalid reports whether err is an API error for a request with invalid
+// params (a 400 or 422), whose Errors say which ones.
+func IsInvalid(err error) bool {
+	return isStatus(err, http.StatusBadRequest) || isStatus(err, http.StatusUnprocessableEntity)
+}
+
+func isStatus(err error, code int) bool {
+	e, ok := err.(*ErrorResponse)
+	return ok && e.HTTPStatusCode == code
+}
+
+// unmarshalResponse decodes the JSON response body into v. An empty body
+// leaves v unchanged.
+func unmarshalResponse(body io.Reader, v interface{}) error {
+	err := json.NewDecoder(body).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -1,13 +1,22 @@
 package client
 
-import "net/http"
+import (
+	"context"
+	"time"
+)
 
 // START IFACE OMIT
 type RepositoriesService interface {
-	Get(repo string, opt *RepoGetOptions) (*Repo, Response, error) // HL
-	List(opt *ListOptions) ([]*Repo, Response, error)
-	ListDependencies(repo string, opt *ListDependenciesOptions) ([]*Dep, Response, error) // OMIT
+	Get(repo string, opt *RepoGetOptions) (*Repo, *Response, error) // HL
+	List(opt *ListOptions) ([]*Repo, *Response, error)
+	ListDependencies(repo string, opt *ListDependenciesOptions) ([]*Dep, *Response, error) // OMIT
+	ListAuthors(repo string, opt *ListAuthorsOptions) ([]*Author, *Response, error)        // OMIT
 	// ...
+	// Context variants, which are cancelled when ctx is done. // OMIT
+	GetContext(ctx context.Context, repo string, opt *RepoGetOptions) (*Repo, *Response, error)                        // OMIT
+	ListContext(ctx context.Context, opt *ListOptions) ([]*Repo, *Response, error)                                     // OMIT
+	ListDependenciesContext(ctx context.Context, repo string, opt *ListDependenciesOptions) ([]*Dep, *Response, error) // OMIT
+	ListAuthorsContext(ctx context.Context, repo string, opt *ListAuthorsOptions) ([]*Author, *Response, error)        // OMIT
 }
 
 // START OPT OMIT
@@ -21,39 +30,194 @@ type RepoGetOptions struct {
 // END OPT OMIT
 // END IFACE OMIT
 
-// ListAuthors(repo string, opt *ListAuthorsOptions) ([]*Author, Response, error)
+type Repo struct {
+	URI       string
+	UpdatedAt *time.Time  `json:",omitempty"`
+	Stats     interface{} `json:",omitempty"`
+}
+
+// ListOptions specifies a page of a list, and how the list is sorted. The
+// Link header of the response links to the other pages.
+type ListOptions struct {
+	Page    int `url:",omitempty"` // starting at 1
+	PerPage int `url:",omitempty"` // DefaultPerPage if 0, and at most MaxPerPage
+
+	// Sort is the field to sort by, which depends on the list (e.g., "uri"
+	// or "updated" for repos), and Direction is "asc" or "desc".
+	Sort      string `url:",omitempty"`
+	Direction string `url:",omitempty"`
+}
+
+const (
+	DefaultPerPage = 30
+	MaxPerPage     = 100
+)
+
+// PageOrDefault returns Page, or 1 if it isn't set.
+func (o *ListOptions) PageOrDefault() int {
+	if o == nil || o.Page < 1 {
+		return 1
+	}
+	return o.Page
+}
+
+// PerPageOrDefault returns PerPage, or DefaultPerPage if it isn't set,
+// capped at MaxPerPage.
+func (o *ListOptions) PerPageOrDefault() int {
+	switch {
+	case o == nil || o.PerPage < 1:
+		return DefaultPerPage
+	case o.PerPage > MaxPerPage:
+		return MaxPerPage
+	}
+	return o.PerPage
+}
+
+// Offset returns the index of the first item on the page.
+func (o *ListOptions) Offset() int {
+	return (o.PageOrDefault() - 1) * o.PerPageOrDefault()
+}
+
+// EachPage calls list for each page of a list, starting at opt.Page and
+// following the Link header's next page (by setting opt.Page), until the
+// last page or until list returns an error. For example:
+//
+//	opt := &client.ListOptions{PerPage: 100}
+//	var repos []*client.Repo
+//	err := client.EachPage(opt, func() (*client.Response, error) {
+//		page, resp, err := c.Repositories.List(opt)
+//		repos = append(repos, page...)
+//		return resp, err
+//	})
+func EachPage(opt *ListOptions, list func() (*Response, error)) error {
+	for {
+		resp, err := list()
+		if err != nil {
+			return err
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// ListDependenciesOptions specifies the commit whose dependencies are listed,
+// and the page of them. They can be sorted by "unit" or "refs".
+type ListDependenciesOptions struct {
+	CommitID string `url:",omitempty"`
+	ListOptions
+}
+
+// ListAuthorsOptions specifies the commit whose defs are attributed to their
+// authors.
+type ListAuthorsOptions struct {
+	CommitID string `url:",omitempty"`
+}
 
-type Repo struct{ Stats interface{} }
-type ListOptions struct{}
-type ListDependenciesOptions struct{}
-type ListAuthorsOptions struct{}
-type Dep struct{}
-type Author struct{}
+// A Dep is a source unit that a repo's code imports, which is usually in
+// another repo.
+type Dep struct {
+	Repo     string `json:",omitempty"` // the repo that defines it, if known
+	UnitType string
+	Unit     string
+	Refs     int // number of refs to its defs (including imports)
+}
 
-type Response interface{}
+// An Author wrote (according to VCS blame) some of the defs in a repo.
+type Author struct {
+	Name  string
+	Email string
+	Defs  int // number of defs the author wrote some of
+	Bytes int // number of bytes of defs the author wrote
+}
 
 // START IMPL OMIT
 
-type repositoriesClient struct{ *http.Client }
+type repositoriesClient struct{ client *Client }
 
-func (c *repositoriesClient) Get(repo string, opt *RepoGetOptions) (*Repo, Response, error) {
-	resp, err := c.Client.Get(makeURL(repo, opt))
+func (c *repositoriesClient) Get(repo string, opt *RepoGetOptions) (*Repo, *Response, error) {
+	return c.GetContext(context.Background(), repo, opt)
+}
+
+func (c *repositoriesClient) GetContext(ctx context.Context, repo string, opt *RepoGetOptions) (*Repo, *Response, error) {
+	url, err := c.client.url(RepoRoute, map[string]string{"Repo": repo}, opt)
 	if err != nil {
-		return nil, resp, err
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
 	}
 	var repo_ Repo
-	err = unmarshalResponse(resp.Body, &repo_)
-	return &repo_, resp, err
+	resp, err := c.client.Do(req, &repo_)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &repo_, resp, nil
 }
 
 // END IMPL OMIT
 
-func (c *repositoriesClient) List(opt *ListOptions) ([]*Repo, Response, error) {
-	return nil, nil, nil
+func (c *repositoriesClient) List(opt *ListOptions) ([]*Repo, *Response, error) {
+	return c.ListContext(context.Background(), opt)
 }
-func (c *repositoriesClient) ListDependencies(repo string, opt *ListDependenciesOptions) ([]*Dep, Response, error) {
-	return nil, nil, nil
+
+func (c *repositoriesClient) ListContext(ctx context.Context, opt *ListOptions) ([]*Repo, *Response, error) {
+	url, err := c.client.url(ReposRoute, nil, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var repos []*Repo
+	resp, err := c.client.Do(req, &repos)
+	if err != nil {
+		return nil, resp, err
+	}
+	return repos, resp, nil
 }
 
-func makeURL(v ...interface{}) string          { return "" }
-func unmarshalResponse(v ...interface{}) error { return nil }
+func (c *repositoriesClient) ListDependencies(repo string, opt *ListDependenciesOptions) ([]*Dep, *Response, error) {
+	return c.ListDependenciesContext(context.Background(), repo, opt)
+}
+
+func (c *repositoriesClient) ListDependenciesContext(ctx context.Context, repo string, opt *ListDependenciesOptions) ([]*Dep, *Response, error) {
+	url, err := c.client.url(RepoDependenciesRoute, map[string]string{"Repo": repo}, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var deps []*Dep
+	resp, err := c.client.Do(req, &deps)
+	if err != nil {
+		return nil, resp, err
+	}
+	return deps, resp, nil
+}
+
+func (c *repositoriesClient) ListAuthors(repo string, opt *ListAuthorsOptions) ([]*Author, *Response, error) {
+	return c.ListAuthorsContext(context.Background(), repo, opt)
+}
+
+func (c *repositoriesClient) ListAuthorsContext(ctx context.Context, repo string, opt *ListAuthorsOptions) ([]*Author, *Response, error) {
+	url, err := c.client.url(RepoAuthorsRoute, map[string]string{"Repo": repo}, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := c.client.NewRequestContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var authors []*Author
+	resp, err := c.client.Do(req, &authors)
+	if err != nil {
+		return nil, resp, err
+	}
+	return authors, resp, nil
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Response is an API response. It wraps the HTTP response and exposes the
+// pagination, rate-limit and caching info in its headers, so that the
+// frontend can reuse it in its own responses.
+type Response struct {
+	*http.Response
+
+	// Pagination info from the Link header. Each is 0 if the response has no
+	// such link (e.g., NextPage is 0 on the last page).
+	NextPage  int
+	PrevPage  int
+	FirstPage int
+	LastPage  int
+
+	Rate Rate
+
+	// Caching info.
+	ETag         string
+	LastModified time.Time
+	CacheControl string
+}
+
+// Rate is the client's API rate limit, from the X-RateLimit-* headers.
+type Rate struct {
+	Limit     int       // requests allowed per period
+	Remaining int       // requests remaining in the current period
+	Reset     time.Time // when the current period ends
+}
+
+// Rate limit headers.
+const (
+	headerRateLimit     = "X-RateLimit-Limit"
+	headerRateRemaining = "X-RateLimit-Remaining"
+	headerRateReset     = "X-RateLimit-Reset" // Unix time
+)
+
+// newResponse wraps r and parses its headers.
+func newResponse(r *http.Response) *Response {
+	resp := &Response{Response: r}
+	resp.populatePageValues()
+	resp.populateRate()
+	resp.ETag = r.Header.Get("ETag")
+	resp.CacheControl = r.Header.Get("Cache-Control")
+	if t, err := http.ParseTime(r.Header.Get("Last-Modified")); err == nil {
+		resp.LastModified = t
+	}
+	return resp
+}
+
+// populatePageValues sets the page numbers of the links in the Link header,
+// such as:
+//
+//	Link: </api/repos?Page=3>; rel="next", </api/repos?Page=9>; rel="last"
+func (r *Response) populatePageValues() {
+	for _, link := range strings.Split(r.Header.Get("Link"), ",") {
+		segments := strings.Split(strings.TrimSpace(link), ";")
+		if len(segments) < 2 || !strings.HasPrefix(segments[0], "<") || !strings.HasSuffix(segments[0], ">") {
+			continue
+		}
+		u, err := url.Parse(segments[0][1 : len(segments[0])-1])
+		if err != nil {
+			continue
+		}
+		page, err := strconv.Atoi(u.Query().Get("Page"))
+		if err != nil {
+			continue
+		}
+		for _, segment := range segments[1:] {
+			switch strings.TrimSpace(segment) {
+			case `rel="next"`:
+				r.NextPage = page
+			case `rel="prev"`:
+				r.PrevPage = page
+			case `rel="first"`:
+				r.FirstPage = page
+			case `rel="last"`:
+				r.LastPage = page
+			}
+		}
+	}
+}
+
+func (r *Response) populateRate() {
+	if limit := r.Header.Get(headerRateLimit); limit != "" {
+		r.Rate.Limit, _ = strconv.Atoi(limit)
+	}
+	if remaining := r.Header.Get(headerRateRemaining); remaining != "" {
+		r.Rate.Remaining, _ = strconv.Atoi(remaining)
+	}
+	if reset := r.Header.Get(headerRateReset); reset != "" {
+		if v, _ := strconv.ParseInt(reset, 10, 64); v != 0 {
+			r.Rate.Reset = time.Unix(v, 0)
+		}
+	}
+}
@@ -4,11 +4,39 @@ import "github.com/sqs/mux"
 
 // START ROUTER OMIT
 
-const RepoRoute = "repo"
+const (
+	ReposRoute            = "repos"
+	RepoRoute             = "repo"
+	RepoDependenciesRoute = "repo.dependencies"
+	DefsRoute             = "defs"
+	DefRoute              = "def"
+	DefRefsRoute          = "def.refs"
+	DefCallersRoute       = "def.callers"
+	DefCalleesRoute       = "def.callees"
+	DefCallPathsRoute     = "def.call-paths"
+	RepoUnusedRoute       = "repo.unused"
+	RepoDiffRoute         = "repo.diff"
+	RepoAuthorsRoute      = "repo.authors"
+	CodeSearchRoute       = "code.search"
+)
 
 func NewAPIRouter() *mux.Router {
 	m := mux.NewRouter()
-	// Define a named route but don't mount a handler (yet)
+	// Define named routes but don't mount handlers (yet). More specific
+	// routes come first, since "/repos/{Repo:.*}" matches any repo subpath.
+	def := "/repos/{Repo:.*}/.units/{UnitType}/{Unit:.*}/.defs/{Path:.*}"
+	m.Path(def + "/.refs").Methods("GET").Name(DefRefsRoute)
+	m.Path(def + "/.callers").Methods("GET").Name(DefCallersRoute)
+	m.Path(def + "/.callees").Methods("GET").Name(DefCalleesRoute)
+	m.Path(def + "/.call-paths").Methods("GET").Name(DefCallPathsRoute)
+	m.Path(def).Methods("GET").Name(DefRoute)
+	m.Path("/.defs").Methods("GET").Name(DefsRoute)
+	m.Path("/.search").Methods("GET").Name(CodeSearchRoute)
+	m.Path("/repos/{Repo:.*}/.unused").Methods("GET").Name(RepoUnusedRoute)
+	m.Path("/repos/{Repo:.*}/.diff").Methods("GET").Name(RepoDiffRoute)
+	m.Path("/repos/{Repo:.*}/.authors").Methods("GET").Name(RepoAuthorsRoute)
+	m.Path("/repos/{Repo:.*}/.dependencies").Methods("GET").Name(RepoDependenciesRoute)
+	m.Path("/repos").Methods("GET").Name(ReposRoute)
 	m.Path("/repos/{Repo:.*}").Methods("GET").Name(RepoRoute)
 	return m
 }
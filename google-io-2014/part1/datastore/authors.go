@@ -0,0 +1,56 @@
+package datastore
+
+import (
+	"context"
+	"sort"
+
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+)
+
+// ListAuthors sums up the authorship (from VCS blame) of the defs in repo at
+// opt.CommitID, by author.
+func (s *reposStore) ListAuthors(repo string, opt *client.ListAuthorsOptions) ([]*client.Author, *client.Response, error) {
+	return s.ListAuthorsContext(context.Background(), repo, opt)
+}
+
+func (s *reposStore) ListAuthorsContext(ctx context.Context, repo string, opt *client.ListAuthorsOptions) ([]*client.Author, *client.Response, error) {
+	if opt == nil {
+		opt = &client.ListAuthorsOptions{}
+	}
+	graph := &GraphStore{s.dbh}
+	defs, err := graph.DefsContext(ctx, repo, opt.CommitID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var authors []*client.Author
+	byEmail := make(map[string]*client.Author)
+	for _, def := range defs {
+		if def.Authorship == nil {
+			continue
+		}
+		for _, da := range def.Authorship.Authors {
+			a, ok := byEmail[da.Email]
+			if !ok {
+				a = &client.Author{Name: da.Name, Email: da.Email}
+				byEmail[da.Email] = a
+				authors = append(authors, a)
+			}
+			a.Defs++
+			a.Bytes += da.Bytes
+		}
+	}
+	sort.Sort(authorsByBytes(authors))
+	return authors, nil, nil
+}
+
+type authorsByBytes []*client.Author
+
+func (v authorsByBytes) Len() int      { return len(v) }
+func (v authorsByBytes) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v authorsByBytes) Less(i, j int) bool {
+	if v[i].Bytes != v[j].Bytes {
+		return v[i].Bytes > v[j].Bytes
+	}
+	return v[i].Email < v[j].Email
+}
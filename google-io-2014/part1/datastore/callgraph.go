@@ -0,0 +1,68 @@
+package datastore
+
+import (
+	"context"
+
+	"github.com/sourcegraph/talks/google-io-2014/callgraph"
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+)
+
+// Callers lists the calls to def in the call graph of its repo at
+// opt.CommitID (or the latest commit, if it's empty).
+func (s *codeStore) Callers(def graph.DefKey, opt *client.CallGraphOptions) (*client.DefCalls, *client.Response, error) {
+	return s.CallersContext(context.Background(), def, opt)
+}
+
+func (s *codeStore) CallersContext(ctx context.Context, def graph.DefKey, opt *client.CallGraphOptions) (*client.DefCalls, *client.Response, error) {
+	return s.defCalls(ctx, def, opt, (*callgraph.Graph).Callers, (*callgraph.Graph).TransitiveCallers)
+}
+
+// Callees lists the calls made by def in the call graph of its repo at
+// opt.CommitID (or the latest commit, if it's empty).
+func (s *codeStore) Callees(def graph.DefKey, opt *client.CallGraphOptions) (*client.DefCalls, *client.Response, error) {
+	return s.CalleesContext(context.Background(), def, opt)
+}
+
+func (s *codeStore) CalleesContext(ctx context.Context, def graph.DefKey, opt *client.CallGraphOptions) (*client.DefCalls, *client.Response, error) {
+	return s.defCalls(ctx, def, opt, (*callgraph.Graph).Callees, (*callgraph.Graph).TransitiveCallees)
+}
+
+func (s *codeStore) defCalls(ctx context.Context, def graph.DefKey, opt *client.CallGraphOptions,
+	direct func(*callgraph.Graph, graph.DefKey) []*callgraph.Call,
+	transitive func(*callgraph.Graph, graph.DefKey, int) []callgraph.Reached) (*client.DefCalls, *client.Response, error) {
+	if opt == nil {
+		opt = &client.CallGraphOptions{}
+	}
+	g, err := s.graph.CallGraphContext(ctx, def.Repo, opt.CommitID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	calls := &client.DefCalls{Calls: direct(g, def)}
+	if opt.Depth > 1 {
+		calls.Transitive = transitive(g, def, opt.Depth)
+	}
+	return calls, nil, nil
+}
+
+// CallPaths lists the call paths from one def to another in the same repo.
+func (s *codeStore) CallPaths(from graph.DefKey, opt *client.CallPathsOptions) ([]callgraph.Path, *client.Response, error) {
+	return s.CallPathsContext(context.Background(), from, opt)
+}
+
+func (s *codeStore) CallPathsContext(ctx context.Context, from graph.DefKey, opt *client.CallPathsOptions) ([]callgraph.Path, *client.Response, error) {
+	if opt == nil || opt.ToPath == "" {
+		return nil, nil, invalidParam("ToPath", "the def that call paths lead to is required")
+	}
+	g, err := s.graph.CallGraphContext(ctx, from.Repo, opt.CommitID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	to := graph.DefKey{Repo: from.Repo, UnitType: opt.ToUnitType, Unit: opt.ToUnit, Path: opt.ToPath}
+	if to.UnitType == "" {
+		to.UnitType = from.UnitType
+	}
+	return g.Paths(from, to, opt.Depth, opt.Limit), nil, nil
+}
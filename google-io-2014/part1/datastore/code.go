@@ -0,0 +1,209 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/codesearch"
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/graphdiff"
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+)
+
+type codeStore struct {
+	graph  *GraphStore
+	search *codesearch.Index
+}
+
+// defSortColumns are the columns that defs can be sorted by (the keys are
+// CodeListDefOptions.Sort values).
+var defSortColumns = map[string]string{"path": "unit_type, unit, path", "name": "name"}
+
+// Get gets def in its repo at opt.CommitID (or the latest commit, if it's
+// empty).
+func (s *codeStore) Get(def graph.DefKey, opt *client.CodeGetOptions) (*client.Def, *client.Response, error) {
+	return s.GetContext(context.Background(), def, opt)
+}
+
+func (s *codeStore) GetContext(ctx context.Context, def graph.DefKey, opt *client.CodeGetOptions) (*client.Def, *client.Response, error) {
+	if opt == nil {
+		opt = &client.CodeGetOptions{}
+	}
+	commitID, err := s.graph.resolveCommit(ctx, def.Repo, opt.CommitID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var defs []*client.Def
+	sql := "SELECT * FROM def WHERE repo=$1 AND commit_id=$2 AND unit_type=$3 AND unit=$4 AND path=$5;"
+	if err := s.graph.dbh.QueryContext(ctx, &defs, sql, def.Repo, commitID, def.UnitType, def.Unit, def.Path); err != nil {
+		return nil, nil, err
+	}
+	if len(defs) == 0 {
+		return nil, nil, notFound("def %s not found in %s", def.Path, def.Unit)
+	}
+	return defs[0], nil, nil
+}
+
+// List lists the defs that match the filters in opt, a page at a time.
+func (s *codeStore) List(opt *client.CodeListDefOptions) ([]*client.Def, *client.Response, error) {
+	return s.ListContext(context.Background(), opt)
+}
+
+func (s *codeStore) ListContext(ctx context.Context, opt *client.CodeListDefOptions) ([]*client.Def, *client.Response, error) {
+	if opt == nil {
+		opt = &client.CodeListDefOptions{}
+	}
+	sortBy := opt.Sort
+	if sortBy == "" {
+		sortBy = "path"
+	}
+	columns, ok := defSortColumns[sortBy]
+	if !ok {
+		return nil, nil, invalidSort(opt.Sort)
+	}
+	desc, err := isDesc(opt.Direction, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+
+	var w where
+	if opt.Repo != "" {
+		commitID, err := s.graph.resolveCommit(ctx, opt.Repo, opt.CommitID)
+		if err != nil {
+			return nil, nil, err
+		}
+		w.add("repo=$%d", opt.Repo)
+		w.add("commit_id=$%d", commitID)
+	}
+	if opt.UnitType != "" {
+		w.add("unit_type=$%d", opt.UnitType)
+	}
+	if opt.Unit != "" {
+		w.add("unit=$%d", opt.Unit)
+	}
+	if opt.Name != "" {
+		w.add("name=$%d", opt.Name)
+	}
+	w.in("kind", opt.Kind)
+	if opt.Exported {
+		w.add("exported=$%d", true)
+	}
+
+	var total int
+	if err := s.graph.dbh.QueryContext(ctx, &total, "SELECT count(*) FROM def"+w.String()+";", w.args...); err != nil {
+		return nil, nil, err
+	}
+	var defs []*client.Def
+	sql := fmt.Sprintf("SELECT * FROM def%s ORDER BY %s %s, repo, unit_type, unit, path LIMIT $%d OFFSET $%d;", w.String(), columns, dir, len(w.args)+1, len(w.args)+2)
+	if err := s.graph.dbh.QueryContext(ctx, &defs, sql, append(w.args, opt.PerPageOrDefault(), opt.Offset())...); err != nil {
+		return nil, nil, err
+	}
+	return defs, pageResponse(&opt.ListOptions, total), nil
+}
+
+// ListRefs lists the refs to def in its repo at opt.CommitID (or the latest
+// commit, if it's empty), optionally only those of the kinds in opt.Kind, a
+// page at a time. They are sorted by file and position.
+func (s *codeStore) ListRefs(def graph.DefKey, opt *client.CodeListRefsOptions) ([]*client.Ref, *client.Response, error) {
+	return s.ListRefsContext(context.Background(), def, opt)
+}
+
+func (s *codeStore) ListRefsContext(ctx context.Context, def graph.DefKey, opt *client.CodeListRefsOptions) ([]*client.Ref, *client.Response, error) {
+	if opt == nil {
+		opt = &client.CodeListRefsOptions{}
+	}
+	commitID, err := s.graph.resolveCommit(ctx, def.Repo, opt.CommitID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var w where
+	w.add("repo=$%d", def.Repo)
+	w.add("commit_id=$%d", commitID)
+	w.add("def_repo=$%d", def.Repo)
+	w.add("def_unit_type=$%d", def.UnitType)
+	w.add("def_unit=$%d", def.Unit)
+	w.add("def_path=$%d", def.Path)
+	w.in("kind", opt.Kind)
+
+	var total int
+	if err := s.graph.dbh.QueryContext(ctx, &total, "SELECT count(*) FROM ref"+w.String()+";", w.args...); err != nil {
+		return nil, nil, err
+	}
+	var refs []*client.Ref
+	sql := fmt.Sprintf("SELECT * FROM ref%s ORDER BY file, start, \"end\" LIMIT $%d OFFSET $%d;", w.String(), len(w.args)+1, len(w.args)+2)
+	if err := s.graph.dbh.QueryContext(ctx, &refs, sql, append(w.args, opt.PerPageOrDefault(), opt.Offset())...); err != nil {
+		return nil, nil, err
+	}
+	return refs, pageResponse(&opt.ListOptions, total), nil
+}
+
+// Diff compares the code graphs of repo at opt.Base and opt.Head (or the
+// latest commit, if Head is empty).
+func (s *codeStore) Diff(repo string, opt *client.CodeDiffOptions) (*graphdiff.Diff, *client.Response, error) {
+	return s.DiffContext(context.Background(), repo, opt)
+}
+
+func (s *codeStore) DiffContext(ctx context.Context, repo string, opt *client.CodeDiffOptions) (*graphdiff.Diff, *client.Response, error) {
+	if opt == nil || opt.Base == "" {
+		return nil, nil, invalidParam("Base", "the base commit to compare against is required")
+	}
+	base, err := s.load(ctx, repo, opt.Base)
+	if err != nil {
+		return nil, nil, err
+	}
+	head, err := s.load(ctx, repo, opt.Head)
+	if err != nil {
+		return nil, nil, err
+	}
+	return graphdiff.Compute(base, head), nil, nil
+}
+
+func (s *codeStore) load(ctx context.Context, repo, commitID string) (*graphdiff.Graph, error) {
+	defs, err := s.graph.DefsContext(ctx, repo, commitID)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := s.graph.RefsContext(ctx, repo, commitID)
+	if err != nil {
+		return nil, err
+	}
+	return &graphdiff.Graph{Defs: defs, Refs: refs}, nil
+}
+
+// A where is the WHERE clause of an SQL query, and its args.
+type where struct {
+	conds []string
+	args  []interface{}
+}
+
+// add adds the condition cond, whose "$%d" is replaced by the placeholder of
+// arg.
+func (w *where) add(cond string, arg interface{}) {
+	w.args = append(w.args, arg)
+	w.conds = append(w.conds, fmt.Sprintf(cond, len(w.args)))
+}
+
+// in adds the condition that column is one of vals, if vals isn't empty.
+func (w *where) in(column string, vals []string) {
+	if len(vals) == 0 {
+		return
+	}
+	placeholders := make([]string, len(vals))
+	for i, v := range vals {
+		w.args = append(w.args, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(w.args))
+	}
+	w.conds = append(w.conds, fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", ")))
+}
+
+func (w *where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
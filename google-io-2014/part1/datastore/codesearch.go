@@ -0,0 +1,54 @@
+package datastore
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/sourcegraph/talks/google-io-2014/codesearch"
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+)
+
+// CodeSearchDir is the dir of the code search index.
+var CodeSearchDir = "codesearch"
+
+// Search searches the contents of the files in the code search index.
+func (s *codeStore) Search(q *codesearch.Query) ([]*codesearch.Match, *client.Response, error) {
+	return s.SearchContext(context.Background(), q)
+}
+
+func (s *codeStore) SearchContext(ctx context.Context, q *codesearch.Query) ([]*codesearch.Match, *client.Response, error) {
+	if q == nil || q.Pattern == "" {
+		return nil, nil, invalidParam("Pattern", "a search pattern is required")
+	}
+	if q.Regexp {
+		if _, err := regexp.Compile(q.Pattern); err != nil {
+			return nil, nil, invalidParam("Pattern", err.Error())
+		}
+	}
+	if _, err := regexp.Compile(q.Path); err != nil {
+		return nil, nil, invalidParam("Path", err.Error())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	matches, err := s.search.Search(q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if matches == nil {
+		matches = []*codesearch.Match{}
+	}
+	return matches, nil, nil
+}
+
+// IndexCommit adds the files of repo at commitID, checked out in dir, to the
+// code search index, with the defs of the graph stored for that commit. It
+// must be called after a repo's graph is stored, so that searches find the
+// repo's latest code.
+func (s *DataStore) IndexCommit(ctx context.Context, repo, commitID, dir string) error {
+	defs, err := s.Graph.DefsContext(ctx, repo, commitID)
+	if err != nil {
+		return err
+	}
+	return s.CodeSearch.IndexCommit(repo, commitID, dir, defs)
+}
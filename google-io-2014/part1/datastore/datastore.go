@@ -1,33 +1,56 @@
 package datastore
 
-import "sourcegraph.com/sourcegraph/srcgraph/client"
+import (
+	"context"
+
+	"github.com/sourcegraph/talks/google-io-2014/codesearch"
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+)
 
 type DBHandle struct{}
 
+func (h DBHandle) Query(v interface{}, sql string, args ...interface{}) error {
+	return h.QueryContext(context.Background(), v, sql, args...)
+}
+
 // dummy
-func (_ DBHandle) Query(v interface{}, sql string, args ...interface{}) error {}
+func (_ DBHandle) QueryContext(ctx context.Context, v interface{}, sql string, args ...interface{}) error {
+	return nil
+}
 
 // START OMIT
 
 func New() *DataStore {
-	return &DataStore{&reposStore{}}
+	graph := &GraphStore{}
+	search := codesearch.NewIndex(CodeSearchDir)
+	return &DataStore{Repositories: &reposStore{}, Code: &codeStore{graph, search}, Graph: graph, CodeSearch: search}
 }
 
 type DataStore struct {
 	Repositories client.RepositoriesService // reuse interface
+	Code         client.CodeService
+	Graph        *GraphStore
+	CodeSearch   *codesearch.Index
 }
 
 type reposStore struct{ dbh DBHandle }
 
-func (s *reposStore) Get(repo string, opt *client.RepoGetOptions) (*client.Repo, client.Response, error) {
-	var repo *client.Repo // reuse Repo type
-	if err := s.dbh.Query(&repo, "SELECT * FROM repo WHERE uri=$1;", repo); err != nil {
+func (s *reposStore) Get(repo string, opt *client.RepoGetOptions) (*client.Repo, *client.Response, error) {
+	return s.GetContext(context.Background(), repo, opt)
+}
+
+func (s *reposStore) GetContext(ctx context.Context, repo string, opt *client.RepoGetOptions) (*client.Repo, *client.Response, error) {
+	var repo_ *client.Repo // reuse Repo type
+	if err := s.dbh.QueryContext(ctx, &repo_, "SELECT * FROM repo WHERE uri=$1;", repo); err != nil {
 		return nil, nil, err
 	}
-	if opt.Stat { // handle params
-		repo.Stats = s.getStats(repo)
+	if repo_ == nil {
+		return nil, nil, notFound("repo %s not found", repo)
+	}
+	if opt != nil && opt.Stats { // handle params
+		repo_.Stats = s.getStats(repo)
 	}
-	return repo, nil, nil
+	return repo_, nil, nil
 }
 
 // END OMIT
@@ -0,0 +1,84 @@
+package datastore
+
+import (
+	"context"
+
+	"github.com/sourcegraph/talks/google-io-2014/callgraph"
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// GraphStore reads the defs and refs that analyzers produced for a repo at a
+// commit. An empty commit ID means the latest commit of the repo whose graph
+// was stored. Its ...Context methods cancel their queries when ctx is done.
+type GraphStore struct{ dbh DBHandle }
+
+// resolveCommit returns commitID, or if it's empty, the latest commit of repo
+// whose graph was stored (and a 404 error if there is none).
+func (s *GraphStore) resolveCommit(ctx context.Context, repo, commitID string) (string, error) {
+	if commitID != "" {
+		return commitID, nil
+	}
+	var commitIDs []string
+	if err := s.dbh.QueryContext(ctx, &commitIDs, "SELECT commit_id FROM graph WHERE repo=$1 ORDER BY stored_at DESC LIMIT 1;", repo); err != nil {
+		return "", err
+	}
+	if len(commitIDs) == 0 {
+		return "", notFound("repo %s has no stored graphs", repo)
+	}
+	return commitIDs[0], nil
+}
+
+func (s *GraphStore) Defs(repo, commitID string) ([]*graph.Def, error) {
+	return s.DefsContext(context.Background(), repo, commitID)
+}
+
+func (s *GraphStore) DefsContext(ctx context.Context, repo, commitID string) ([]*graph.Def, error) {
+	commitID, err := s.resolveCommit(ctx, repo, commitID)
+	if err != nil {
+		return nil, err
+	}
+	var defs []*graph.Def
+	if err := s.dbh.QueryContext(ctx, &defs, "SELECT * FROM def WHERE repo=$1 AND commit_id=$2;", repo, commitID); err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// Refs returns the refs in repo at commitID (which may point to defs in
+// other repos).
+func (s *GraphStore) Refs(repo, commitID string) ([]*graph.Ref, error) {
+	return s.RefsContext(context.Background(), repo, commitID)
+}
+
+func (s *GraphStore) RefsContext(ctx context.Context, repo, commitID string) ([]*graph.Ref, error) {
+	commitID, err := s.resolveCommit(ctx, repo, commitID)
+	if err != nil {
+		return nil, err
+	}
+	var refs []*graph.Ref
+	if err := s.dbh.QueryContext(ctx, &refs, "SELECT * FROM ref WHERE repo=$1 AND commit_id=$2;", repo, commitID); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// CallGraph returns the call graph of the defs in repo at commitID.
+func (s *GraphStore) CallGraph(repo, commitID string) (*callgraph.Graph, error) {
+	return s.CallGraphContext(context.Background(), repo, commitID)
+}
+
+func (s *GraphStore) CallGraphContext(ctx context.Context, repo, commitID string) (*callgraph.Graph, error) {
+	commitID, err := s.resolveCommit(ctx, repo, commitID)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := s.DefsContext(ctx, repo, commitID)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := s.RefsContext(ctx, repo, commitID)
+	if err != nil {
+		return nil, err
+	}
+	return callgraph.New(defs, refs), nil
+}
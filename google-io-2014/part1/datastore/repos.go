@@ -0,0 +1,201 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+	"github.com/sourcegraph/talks/google-io-2014/part1/client"
+)
+
+// repoSortColumns are the columns that repos can be sorted by (the keys are
+// ListOptions.Sort values).
+var repoSortColumns = map[string]string{"uri": "uri", "updated": "updated_at"}
+
+// List lists repos, a page (opt) at a time.
+func (s *reposStore) List(opt *client.ListOptions) ([]*client.Repo, *client.Response, error) {
+	return s.ListContext(context.Background(), opt)
+}
+
+func (s *reposStore) ListContext(ctx context.Context, opt *client.ListOptions) ([]*client.Repo, *client.Response, error) {
+	if opt == nil {
+		opt = &client.ListOptions{}
+	}
+	sortBy := opt.Sort
+	if sortBy == "" {
+		sortBy = "uri"
+	}
+	column, ok := repoSortColumns[sortBy]
+	if !ok {
+		return nil, nil, invalidSort(opt.Sort)
+	}
+	desc, err := isDesc(opt.Direction, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+
+	var total int
+	if err := s.dbh.QueryContext(ctx, &total, "SELECT count(*) FROM repo;"); err != nil {
+		return nil, nil, err
+	}
+	var repos []*client.Repo
+	sql := fmt.Sprintf("SELECT * FROM repo ORDER BY %s %s, uri LIMIT $1 OFFSET $2;", column, dir)
+	if err := s.dbh.QueryContext(ctx, &repos, sql, opt.PerPageOrDefault(), opt.Offset()); err != nil {
+		return nil, nil, err
+	}
+	return repos, pageResponse(opt, total), nil
+}
+
+// ListDependencies lists the units that the code in repo at opt.CommitID
+// imports, a page at a time. They are sorted by unit (by default) or by the
+// number of refs to them ("refs", most first by default).
+func (s *reposStore) ListDependencies(repo string, opt *client.ListDependenciesOptions) ([]*client.Dep, *client.Response, error) {
+	return s.ListDependenciesContext(context.Background(), repo, opt)
+}
+
+func (s *reposStore) ListDependenciesContext(ctx context.Context, repo string, opt *client.ListDependenciesOptions) ([]*client.Dep, *client.Response, error) {
+	if opt == nil {
+		opt = &client.ListDependenciesOptions{}
+	}
+	var desc bool
+	var err error
+	switch opt.Sort {
+	case "", "unit":
+		desc, err = isDesc(opt.Direction, false)
+	case "refs":
+		desc, err = isDesc(opt.Direction, true)
+	default:
+		return nil, nil, invalidSort(opt.Sort)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gs := &GraphStore{s.dbh}
+	refs, err := gs.RefsContext(ctx, repo, opt.CommitID)
+	if err != nil {
+		return nil, nil, err
+	}
+	byUnit := make(map[graph.UnitKey]*client.Dep)
+	var deps []*client.Dep
+	for _, ref := range refs {
+		k := graph.UnitKey{UnitType: ref.DefUnitType, Unit: ref.DefUnit}
+		if ref.Kind == graph.RefImport && ref.DefRepo != repo && byUnit[k] == nil {
+			byUnit[k] = &client.Dep{UnitType: k.UnitType, Unit: k.Unit}
+			deps = append(deps, byUnit[k])
+		}
+	}
+	for _, ref := range refs {
+		if dep := byUnit[graph.UnitKey{UnitType: ref.DefUnitType, Unit: ref.DefUnit}]; dep != nil {
+			dep.Refs++
+			if dep.Repo == "" {
+				dep.Repo = ref.DefRepo
+			}
+		}
+	}
+
+	var less sort.Interface = depsByUnit(deps)
+	if opt.Sort == "refs" {
+		less = depsByRefs(deps)
+	}
+	if desc {
+		less = sort.Reverse(less)
+	}
+	sort.Sort(less)
+
+	resp := pageResponse(&opt.ListOptions, len(deps))
+	start, end := opt.Offset(), opt.Offset()+opt.PerPageOrDefault()
+	if start > len(deps) {
+		start = len(deps)
+	}
+	if end > len(deps) {
+		end = len(deps)
+	}
+	return deps[start:end], resp, nil
+}
+
+// pageResponse returns a Response with the pagination info of the page opt
+// of a list of total items, which the API handlers send as a Link header.
+func pageResponse(opt *client.ListOptions, total int) *client.Response {
+	page, perPage := opt.PageOrDefault(), opt.PerPageOrDefault()
+	last := (total + perPage - 1) / perPage
+	if last < 1 {
+		last = 1
+	}
+	resp := &client.Response{}
+	if page > 1 {
+		resp.FirstPage, resp.PrevPage = 1, page-1
+		if resp.PrevPage > last {
+			resp.PrevPage = last
+		}
+	}
+	if page < last {
+		resp.NextPage, resp.LastPage = page+1, last
+	}
+	return resp
+}
+
+// isDesc reports whether direction is "desc", or returns dflt if it's
+// empty.
+func isDesc(direction string, dflt bool) (bool, error) {
+	switch direction {
+	case "":
+		return dflt, nil
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	}
+	return false, invalidParam("Direction", fmt.Sprintf("direction %q isn't asc or desc", direction))
+}
+
+func invalidSort(sort string) error {
+	return invalidParam("Sort", fmt.Sprintf("can't sort by %q", sort))
+}
+
+func invalidParam(field, msg string) error {
+	return &client.ErrorResponse{
+		HTTPStatusCode: http.StatusBadRequest,
+		Code:           "invalid",
+		Message:        msg,
+		Errors:         []*client.FieldError{{Field: field, Code: "invalid", Message: msg}},
+	}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &client.ErrorResponse{
+		HTTPStatusCode: http.StatusNotFound,
+		Code:           "not_found",
+		Message:        fmt.Sprintf(format, args...),
+	}
+}
+
+type depsByUnit []*client.Dep
+
+func (v depsByUnit) Len() int      { return len(v) }
+func (v depsByUnit) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v depsByUnit) Less(i, j int) bool {
+	if v[i].UnitType != v[j].UnitType {
+		return v[i].UnitType < v[j].UnitType
+	}
+	return v[i].Unit < v[j].Unit
+}
+
+// depsByRefs sorts deps by the number of refs to them (fewest first), then
+// by unit.
+type depsByRefs []*client.Dep
+
+func (v depsByRefs) Len() int      { return len(v) }
+func (v depsByRefs) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v depsByRefs) Less(i, j int) bool {
+	if v[i].Refs != v[j].Refs {
+		return v[i].Refs < v[j].Refs
+	}
+	return depsByUnit(v).Less(i, j)
+}
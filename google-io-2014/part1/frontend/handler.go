@@ -1,6 +1,7 @@
 package frontend
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/sourcegraph/talks/google-io-2014/part1/client"
@@ -21,7 +22,7 @@ func serveRepo(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	repo, resp, err := apiclient.Repositories.Get(routeVars["Repo"], &opt) // reuse API client // HL
+	repo, resp, err := apiclient.Repositories.GetContext(r.Context(), routeVars["Repo"], &opt) // reuse API client // HL
 	if err != nil {
 		return err
 	}
@@ -32,4 +33,23 @@ func serveRepo(w http.ResponseWriter, r *http.Request) error {
 // END OMIT
 
 // dummy
-func executeTemplate(name string, data interface{}, resp client.Response) error { return nil }
+func executeTemplate(name string, data interface{}, resp *client.Response) error { return nil }
+
+// handleErr serves a frontend page, and responds with an error page if it
+// fails. API errors are mapped to the page's status, so that (e.g.) a repo
+// that the API can't find is a 404 page.
+type handleErr func(http.ResponseWriter, *http.Request) error
+
+func (h handleErr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := h(w, r)
+	switch {
+	case err == nil:
+	case client.IsNotFound(err):
+		http.NotFound(w, r)
+	case client.IsUnauthorized(err), client.IsForbidden(err), client.IsInvalid(err):
+		http.Error(w, err.(*client.ErrorResponse).Message, client.HTTPStatusCode(err))
+	default:
+		log.Printf("%s: %s", r.URL, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,94 @@
+// Package unused finds unexported (or module-private) defs that nothing
+// references, so they can be cleaned up.
+package unused
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// Find returns the defs that are neither exported nor entry points, and that
+// have no incoming refs other than from within their own bodies (e.g.,
+// recursive calls). Methods that implement an interface method (those with a
+// graph.RefImpl ref) are used through the interface. Defs are returned sorted
+// by repo, file and position.
+func Find(defs []*graph.Def, refs []*graph.Ref) []*graph.Def {
+	used := make(map[graph.DefKey]bool)
+	for _, ref := range refs {
+		if ref.Kind == graph.RefImpl {
+			used[graph.DefKey{Repo: ref.Repo, UnitType: ref.UnitType, Unit: ref.Unit, Path: ref.Enclosing}] = true
+		}
+		if ref.DefRepo == ref.Repo && ref.DefUnitType == ref.UnitType && ref.DefUnit == ref.Unit && (ref.Enclosing == ref.DefPath || strings.HasPrefix(ref.Enclosing, ref.DefPath+"/")) {
+			continue // self-reference
+		}
+		used[ref.DefKey()] = true
+	}
+
+	var unused []*graph.Def
+	for _, def := range defs {
+		if def.Exported || IsEntryPoint(def) || used[def.DefKey.WithoutCommit()] {
+			continue
+		}
+		unused = append(unused, def)
+	}
+	sort.Sort(byPosition(unused))
+	return unused
+}
+
+// IsEntryPoint reports whether def is used implicitly, by the language
+// runtime or test tooling, even if nothing refers to it: Go main and init
+// funcs and tests, and defs in JavaScript test files.
+func IsEntryPoint(def *graph.Def) bool {
+	switch def.UnitType {
+	case "go":
+		if def.Kind != "func" {
+			return false
+		}
+		if def.Name == "main" || def.Name == "init" {
+			return true
+		}
+		if strings.HasSuffix(def.File, "_test.go") {
+			for _, prefix := range []string{"Test", "Benchmark", "Example", "Fuzz"} {
+				if strings.HasPrefix(def.Name, prefix) {
+					return true
+				}
+			}
+		}
+	case "js":
+		return isJSTestFile(def.File)
+	}
+	return false
+}
+
+// isJSTestFile reports whether file is run by a JavaScript test runner, such
+// as "foo.test.js", "foo_test.js" or a file in a "test" or "__tests__" dir.
+func isJSTestFile(file string) bool {
+	base := path.Base(file)
+	name := strings.TrimSuffix(base, path.Ext(base))
+	if strings.HasSuffix(name, ".test") || strings.HasSuffix(name, ".spec") || strings.HasSuffix(name, "_test") {
+		return true
+	}
+	for _, dir := range strings.Split(path.Dir(file), "/") {
+		if dir == "test" || dir == "tests" || dir == "__tests__" {
+			return true
+		}
+	}
+	return false
+}
+
+type byPosition []*graph.Def
+
+func (v byPosition) Len() int      { return len(v) }
+func (v byPosition) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v byPosition) Less(i, j int) bool {
+	if v[i].Repo != v[j].Repo {
+		return v[i].Repo < v[j].Repo
+	}
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	return v[i].DefStart < v[j].DefStart
+}
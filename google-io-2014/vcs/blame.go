@@ -0,0 +1,141 @@
+// Package vcs reads history from local git repositories.
+package vcs
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Hunk is a range of a file that was last changed by a single commit.
+type Hunk struct {
+	CommitID    string
+	Author      string
+	AuthorEmail string
+	Date        time.Time
+	Start, End  int // byte offsets in the file
+}
+
+// BlameFile returns the hunks of file (relative to dir, which must be in a git
+// repository) at revision rev, in order. If rev is empty, the working tree
+// version of the file is blamed, and uncommitted changes are attributed to a
+// commit ID of all zeros.
+func BlameFile(dir, rev, file string) ([]*Hunk, error) {
+	args := []string{"blame", "--porcelain"}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	out, err := git(dir, append(args, "--", file)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlame(out)
+}
+
+type commitInfo struct {
+	author, email string
+	date          time.Time
+}
+
+// parseBlame parses the output of "git blame --porcelain". Each line of the
+// file is preceded by a header line "<commit> <orig line> <final line>
+// [<group size>]"; the first time a commit appears, its author and other
+// info follow on "key value" lines. The line itself is prefixed with a tab.
+func parseBlame(out []byte) ([]*Hunk, error) {
+	var hunks []*Hunk
+	commits := make(map[string]*commitInfo)
+	var commitID string
+	offset := 0
+
+	// Don't use bufio.Scanner, which would strip the "\r" of CRLF lines
+	// and throw off the offsets.
+	for _, b := range bytes.Split(out, []byte("\n")) {
+		line := string(b)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			if commitID == "" {
+				return nil, fmt.Errorf("git blame: file line without header")
+			}
+			end := offset + len(line) // minus the tab, plus the newline
+			if n := len(hunks); n > 0 && hunks[n-1].CommitID == commitID && hunks[n-1].End == offset {
+				hunks[n-1].End = end
+			} else {
+				c := commits[commitID]
+				hunks = append(hunks, &Hunk{
+					CommitID:    commitID,
+					Author:      c.author,
+					AuthorEmail: c.email,
+					Date:        c.date,
+					Start:       offset,
+					End:         end,
+				})
+			}
+			offset = end
+			commitID = ""
+			continue
+		}
+
+		if commitID == "" {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || !isCommitID(fields[0]) {
+				return nil, fmt.Errorf("git blame: bad header line %q", line)
+			}
+			commitID = fields[0]
+			if commits[commitID] == nil {
+				commits[commitID] = &commitInfo{}
+			}
+			continue
+		}
+
+		c := commits[commitID]
+		key, val := line, ""
+		if i := strings.Index(line, " "); i != -1 {
+			key, val = line[:i], line[i+1:]
+		}
+		switch key {
+		case "author":
+			c.author = val
+		case "author-mail":
+			c.email = strings.TrimSuffix(strings.TrimPrefix(val, "<"), ">")
+		case "author-time":
+			sec, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("git blame: bad author-time %q", val)
+			}
+			c.date = time.Unix(sec, 0).UTC()
+		}
+	}
+	return hunks, nil
+}
+
+// isCommitID reports whether s is a full commit ID: 40 hex digits (SHA-1),
+// or 64 in repositories that use SHA-256.
+func isCommitID(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// git runs a git command in dir and returns its output.
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %s (%s)", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
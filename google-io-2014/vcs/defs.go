@@ -0,0 +1,98 @@
+package vcs
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/sourcegraph/talks/google-io-2014/graph"
+)
+
+// BlameDefs sets the Authorship of each def from the blame of its
+// DefStart–DefEnd range at revision rev (or the working tree, if rev is
+// empty). Def files are relative to dir, which must be in a git repository.
+// Defs in files that git doesn't track (at rev) are left alone.
+func BlameDefs(dir, rev string, defs []*graph.Def) error {
+	tracked, err := trackedFiles(dir, rev)
+	if err != nil {
+		return err
+	}
+
+	byFile := make(map[string][]*graph.Def)
+	var files []string
+	for _, def := range defs {
+		if !tracked[def.File] {
+			continue
+		}
+		if _, seen := byFile[def.File]; !seen {
+			files = append(files, def.File)
+		}
+		byFile[def.File] = append(byFile[def.File], def)
+	}
+
+	for _, file := range files {
+		hunks, err := BlameFile(dir, rev, file)
+		if err != nil {
+			return err
+		}
+		for _, def := range byFile[file] {
+			def.Authorship = authorship(hunks, def.DefStart, def.DefEnd)
+		}
+	}
+	return nil
+}
+
+// authorship summarizes the hunks that overlap the byte range [start, end).
+func authorship(hunks []*Hunk, start, end int) *graph.Authorship {
+	a := &graph.Authorship{}
+	byEmail := make(map[string]*graph.DefAuthor)
+	// Hunks are in order, so find the first one that ends after start.
+	i := sort.Search(len(hunks), func(i int) bool { return hunks[i].End > start })
+	for ; i < len(hunks) && hunks[i].Start < end; i++ {
+		h := hunks[i]
+		from, to := h.Start, h.End
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		da, ok := byEmail[h.AuthorEmail]
+		if !ok {
+			da = &graph.DefAuthor{Name: h.Author, Email: h.AuthorEmail}
+			byEmail[h.AuthorEmail] = da
+			a.Authors = append(a.Authors, da)
+		}
+		da.Bytes += to - from
+		if a.LastCommitID == "" || h.Date.After(a.LastModified) {
+			a.LastCommitID, a.LastModified = h.CommitID, h.Date
+		}
+	}
+	sort.Stable(authorsByBytes(a.Authors))
+	return a
+}
+
+type authorsByBytes []*graph.DefAuthor
+
+func (v authorsByBytes) Len() int           { return len(v) }
+func (v authorsByBytes) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v authorsByBytes) Less(i, j int) bool { return v[i].Bytes > v[j].Bytes }
+
+// trackedFiles returns the set of files (relative to dir) that git tracks at
+// rev, or in the index if rev is empty.
+func trackedFiles(dir, rev string) (map[string]bool, error) {
+	args := []string{"ls-files", "-z"}
+	if rev != "" {
+		args = []string{"ls-tree", "-r", "-z", "--name-only", rev}
+	}
+	out, err := git(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]bool)
+	for _, f := range bytes.Split(out, []byte{0}) {
+		if len(f) > 0 {
+			files[string(f)] = true
+		}
+	}
+	return files, nil
+}
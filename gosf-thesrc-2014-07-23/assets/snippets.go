@@ -1,4 +1,5 @@
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
@@ -18,6 +19,10 @@ type PostsService interface {
 	List(opt *PostListOptions) ([]*Post, error)
 
 	Submit(post *Post) (created bool, err error)
+	// Context variants, which are cancelled when ctx is done. // OMIT
+	GetContext(ctx context.Context, id int) (*Post, error)                   // OMIT
+	ListContext(ctx context.Context, opt *PostListOptions) ([]*Post, error)  // OMIT
+	SubmitContext(ctx context.Context, post *Post) (created bool, err error) // OMIT
 }
 
 // END POSTS_INTERFACE OMIT
@@ -183,3 +188,45 @@ func (s *MockPostsService) Get(id int) (*Post, error) {
 // ...
 
 // END POSTS_MOCK OMIT
+
+// Context variants: a cancelled frontend request cancels its API request, and
+// the API request's context cancels its SQL query.
+
+func (c *postsClient) GetContext(ctx context.Context, id int) (*Post, error) {
+	url, _ := s.client.url(router.Post, map[string]string{"ID": strconv.Itoa(id)}, nil)
+
+	request, _ := s.client.NewRequest("GET", url.String(), nil)
+
+	response, _ := s.client.Do(request.WithContext(ctx))
+
+	var post *Post
+	json.NewDecoder(response.Body).Decode(&post)
+
+	return post, nil
+}
+
+func (s *postsStore) GetContext(ctx context.Context, id int) (*Post, error) {
+	var post *Post
+	s.db.SelectContext(ctx, &post, "SELECT * FROM post WHERE id=$1", id)
+	return post, nil
+}
+
+func servePostContext(w http.ResponseWriter, r *http.Request) error {
+	id, _ := strconv.Atoi(mux.Vars(r)["ID"])
+
+	post, _ := store.Posts.GetContext(r.Context(), id)
+
+	return writeJSON(w, post)
+}
+
+func (s *MockPostsService) GetContext(ctx context.Context, id int) (*Post, error) {
+	return s.Get(id)
+}
+
+func (s *MockPostsService) ListContext(ctx context.Context, opt *PostListOptions) ([]*Post, error) {
+	return s.List(opt)
+}
+
+func (s *MockPostsService) SubmitContext(ctx context.Context, post *Post) (bool, error) {
+	return s.Submit(post)
+}